@@ -2,19 +2,24 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"github.com/grokkos/ether-tx-parser/internal/api/http/handler"
 	"github.com/grokkos/ether-tx-parser/internal/api/http/server"
 	"github.com/grokkos/ether-tx-parser/internal/application/parser"
+	"github.com/grokkos/ether-tx-parser/internal/domain/repository"
 	"github.com/grokkos/ether-tx-parser/internal/infastructure/ethereum"
 	"github.com/grokkos/ether-tx-parser/internal/infastructure/storage"
 	"github.com/grokkos/ether-tx-parser/pkg/config"
 	"github.com/grokkos/ether-tx-parser/pkg/logger"
+	_ "github.com/lib/pq"
 	"go.uber.org/zap"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -31,17 +36,91 @@ func main() {
 	defer logger.Sync()
 
 	// Initialize dependencies
-	client := ethereum.NewClient(cfg.Ethereum.RPCURL)
+	retry := ethereum.RetryPolicy{
+		Attempts:  cfg.Ethereum.RetryAttempts,
+		BaseDelay: cfg.Ethereum.RetryDelay,
+	}
+
+	var client repository.EthereumClient
+	var pool *ethereum.Pool
+	if len(cfg.Ethereum.Endpoints) > 0 {
+		endpoints := make([]ethereum.Endpoint, 0, len(cfg.Ethereum.Endpoints))
+		for _, endpoint := range cfg.Ethereum.Endpoints {
+			endpoints = append(endpoints, ethereum.Endpoint{URL: endpoint.URL, Weight: endpoint.Weight})
+		}
+		pool = ethereum.NewPool(endpoints, retry, cfg.Ethereum.RequestTimeout,
+			cfg.Ethereum.HealthCheckInterval, cfg.Ethereum.MaxBlockLag)
+		client = pool
+	} else {
+		client = ethereum.NewClient(cfg.Ethereum.RPCURL, retry, cfg.Ethereum.RequestTimeout)
+	}
 	if client == nil {
 		log.Fatal("Failed to initialize Ethereum client")
 	}
 	
-	store := storage.NewMemoryStore()
-	if store == nil {
-		log.Fatal("Failed to initialize storage")
+	retention := storage.WithRetention(storage.RetentionPolicy{
+		MaxPerAddress: cfg.Storage.Retention.MaxPerAddress,
+		MaxAgeBlocks:  cfg.Storage.Retention.MaxAgeBlocks,
+		MaxAge:        cfg.Storage.Retention.MaxAge,
+		MaxBytes:      cfg.Storage.Retention.MaxBytes,
+	})
+	var store repository.Store
+	// closeStore is called once everything using the store has stopped
+	closeStore := func() error { return nil }
+	switch cfg.Storage.Type {
+	case "memory":
+		store = storage.NewMemoryStore(retention)
+	case "file":
+		fileStore, err := storage.NewFileStore(cfg.Storage.Path, cfg.Storage.SnapshotInterval, retention)
+		if err != nil {
+			log.Fatalf("Failed to open file store: %v", err)
+		}
+		closeStore = fileStore.Close
+		store = fileStore
+	case "sql":
+		if !slices.Contains(sql.Drivers(), cfg.Storage.Driver) {
+			log.Fatalf("Invalid storage.driver %q: want one of %v (sqlite3 needs a cgo build)",
+				cfg.Storage.Driver, sql.Drivers())
+		}
+		sqlStore, err := storage.NewSQLStore(context.Background(), cfg.Storage.Driver, cfg.Storage.DSN)
+		if err != nil {
+			log.Fatalf("Failed to open SQL store: %v", err)
+		}
+		closeStore = sqlStore.Close
+		store = sqlStore
+		if cfg.Storage.Retention != (config.RetentionConfig{}) {
+			logger.Warn("storage.retention is ignored by the SQL store")
+		}
+	default:
+		log.Fatalf("Invalid storage.type %q: want memory, file or sql", cfg.Storage.Type)
+	}
+
+	startPolicy, err := parser.ParseStartPolicy(cfg.Parser.StartBlock)
+	if err != nil {
+		log.Fatalf("Invalid parser.start_block: %v", err)
+	}
+	traceMode, err := parser.ParseTraceMode(cfg.Parser.Tracing)
+	if err != nil {
+		log.Fatalf("Invalid parser.tracing: %v", err)
+	}
+	options := []parser.Option{
+		parser.WithConfirmationDepth(cfg.Parser.ConfirmationDepth),
+		parser.WithBatchSize(cfg.Parser.BatchSize),
+		parser.WithWorkers(cfg.Parser.Workers),
+		parser.WithStartPolicy(startPolicy),
+		parser.WithMaxResumeGap(cfg.Parser.MaxResumeGap),
+		parser.WithTracing(traceMode),
+		parser.WithAutoSubscribeContracts(cfg.Parser.AutoSubscribeContracts),
+	}
+	if cfg.Parser.CheckpointPath != "" {
+		checkpoint, err := storage.NewFileCheckpoint(cfg.Parser.CheckpointPath)
+		if err != nil {
+			log.Fatalf("Failed to initialize checkpoint: %v", err)
+		}
+		options = append(options, parser.WithCheckpoint(checkpoint))
 	}
 
-	service := parser.NewService(store, client)
+	service := parser.NewService(store, client, options...)
 	if service == nil {
 		log.Fatal("Failed to initialize parser service")
 	}
@@ -51,13 +130,32 @@ func main() {
 	if parserHandler == nil {
 		log.Fatal("Failed to initialize parser handler")
 	}
-	srv := server.NewServer(parserHandler)
+	var rpcHandler *handler.RPCHandler
+	if pool != nil {
+		rpcHandler = handler.NewRPCHandler(pool)
+	}
+	srv := server.NewServer(parserHandler, rpcHandler, cfg.Server.RequestTimeout)
 	srv.SetupRoutes()
 
 	// Create a context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// workers tracks the goroutines that must stop before the store closes
+	var workers sync.WaitGroup
+	run := func(work func()) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			work()
+		}()
+	}
+
+	// Keep endpoint health up to date while the service runs
+	if pool != nil {
+		run(func() { pool.Start(ctx) })
+	}
+
 	// Handle graceful shutdown
 	go func() {
 		sigChan := make(chan os.Signal, 1)
@@ -67,44 +165,54 @@ func main() {
 		cancel()
 	}()
 
+	// Follow new heads over WebSocket when configured; polling covers the rest
+	var heads repository.HeadSubscriber
+	if cfg.Ethereum.WSURL != "" {
+		heads = ethereum.NewWSClient(cfg.Ethereum.WSURL, retry, cfg.Ethereum.RequestTimeout)
+	}
+
 	// Start parsing blocks in a goroutine
-	go func() {
-		ticker := time.NewTicker(15 * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				logger.Info("Stopping block parser")
-				return
-			case <-ticker.C:
-				if err := service.ParseBlocks(); err != nil {
-					logger.Error("Error parsing blocks", zap.Error(err))
-				}
-			}
-		}
-	}()
+	run(func() { service.Watch(ctx, heads, cfg.Parser.PollInterval) })
+	run(func() { service.RunBackfills(ctx) })
 
 	// Start HTTP server
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 	logger.Info("Starting server", zap.String("address", addr))
 
 	server := &http.Server{
-		Addr:    addr,
-		Handler: srv,
+		Addr:              addr,
+		Handler:           srv,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	// Server shutdown on context cancellation
-	go func() {
+	// Server shutdown on context cancellation; in-flight requests finish
+	// before the store closes
+	run(func() {
 		<-ctx.Done()
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		if err := server.Shutdown(shutdownCtx); err != nil {
 			logger.Error("Server shutdown error", zap.Error(err))
 		}
-	}()
+	})
 
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
-		logger.Fatal("Server error", zap.Error(err))
+	serveErr := server.ListenAndServe()
+	if serveErr == http.ErrServerClosed {
+		serveErr = nil
+	}
+	if serveErr != nil {
+		logger.Error("Server error", zap.Error(serveErr))
+	}
+
+	// Wait for parsing to stop at a block boundary, so no commit is in
+	// flight when the store closes
+	cancel()
+	workers.Wait()
+	if err := closeStore(); err != nil {
+		logger.Error("Failed to close store", zap.Error(err))
+	}
+	if serveErr != nil {
+		logger.Sync()
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,6 @@
+//go:build cgo
+
+package main
+
+// The SQLite driver wraps the C library, so only cgo builds register it.
+import _ "github.com/mattn/go-sqlite3"
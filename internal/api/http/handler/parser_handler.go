@@ -2,25 +2,68 @@ package handler
 
 import (
 	"encoding/json"
+	stderrors "errors"
 	"github.com/grokkos/ether-tx-parser/internal/application/parser"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"github.com/grokkos/ether-tx-parser/pkg/logger"
+	"go.uber.org/zap"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type ParserHandler struct {
 	service *parser.Service
+	logger  *zap.Logger
 }
 
 func NewParserHandler(service *parser.Service) *ParserHandler {
-	return &ParserHandler{service: service}
+	return &ParserHandler{
+		service: service,
+		logger:  logger.GetLogger(),
+	}
 }
 
+// SubscribeRequest subscribes an address. FromBlock or FromTime (RFC 3339 or
+// Unix seconds) additionally schedules a backfill of the address's earlier history.
 type SubscribeRequest struct {
-	Address string `json:"address"`
+	Address   string `json:"address"`
+	FromBlock *int   `json:"from_block,omitempty"`
+	FromTime  string `json:"from_time,omitempty"`
+}
+
+type SubscribeResponse struct {
+	Success  bool                `json:"success"`
+	Backfill *entity.BackfillJob `json:"backfill,omitempty"`
+}
+
+// UploadABIRequest registers the JSON ABI of the contract at Address.
+type UploadABIRequest struct {
+	Address string          `json:"address"`
+	ABI     json.RawMessage `json:"abi"`
+}
+
+type UploadABIResponse struct {
+	Success bool `json:"success"`
+	Methods int  `json:"methods"`
+}
+
+type BlockAtTimeResponse struct {
+	BlockNumber int    `json:"block_number"`
+	Hash        string `json:"hash"`
+	Timestamp   int64  `json:"timestamp"`
 }
 
 func (h *ParserHandler) GetCurrentBlock(w http.ResponseWriter, r *http.Request) {
-	block := h.service.GetCurrentBlock()
-	err := json.NewEncoder(w).Encode(map[string]int{"current_block": block})
+	block, err := h.service.GetCurrentBlock(r.Context())
+	if err != nil {
+		h.internalError(w, "Failed to get current block", err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(map[string]int{"current_block": block})
 	if err != nil {
 		return
 	}
@@ -38,8 +81,235 @@ func (h *ParserHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	success := h.service.Subscribe(req.Address)
-	err := json.NewEncoder(w).Encode(map[string]bool{"success": success})
+	if req.FromBlock != nil && req.FromTime != "" {
+		http.Error(w, "Only one of from_block and from_time may be set", http.StatusBadRequest)
+		return
+	}
+	var fromTime time.Time
+	if req.FromTime != "" {
+		parsed, err := parseTime(req.FromTime)
+		if err != nil {
+			http.Error(w, "Invalid from_time parameter", http.StatusBadRequest)
+			return
+		}
+		fromTime = parsed
+	}
+	if req.FromBlock != nil && *req.FromBlock < 0 {
+		http.Error(w, "Invalid from_block parameter", http.StatusBadRequest)
+		return
+	}
+
+	success, err := h.service.Subscribe(r.Context(), req.Address)
+	if err != nil {
+		h.internalError(w, "Failed to subscribe address", err)
+		return
+	}
+
+	response := SubscribeResponse{Success: success}
+	if success && (req.FromBlock != nil || !fromTime.IsZero()) {
+		var fromBlock int
+		if req.FromBlock != nil {
+			fromBlock = *req.FromBlock
+		}
+		job, err := h.service.ScheduleBackfill(r.Context(), req.Address, fromBlock, fromTime)
+		if err != nil {
+			var appErr *errors.AppError
+			if stderrors.As(err, &appErr) && appErr.Type == errors.ErrorTypeValidation {
+				http.Error(w, appErr.Message, http.StatusBadRequest)
+				return
+			}
+			h.internalError(w, "Failed to schedule backfill", err)
+			return
+		}
+		response.Backfill = &job
+	}
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+func (h *ParserHandler) GetTokenTransfers(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "Address parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	transfers, err := h.service.GetTokenTransfers(r.Context(), address)
+	if err != nil {
+		h.internalError(w, "Failed to get token transfers", err)
+		return
+	}
+	if !h.markTruncated(w, r, address) {
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(transfers)
+	if err != nil {
+		return
+	}
+}
+
+func (h *ParserHandler) GetNFTTransfers(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "Address parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	transfers, err := h.service.GetNFTTransfers(r.Context(), address)
+	if err != nil {
+		h.internalError(w, "Failed to get NFT transfers", err)
+		return
+	}
+	if !h.markTruncated(w, r, address) {
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(transfers)
+	if err != nil {
+		return
+	}
+}
+
+func (h *ParserHandler) GetInternalTransfers(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "Address parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	transfers, err := h.service.GetInternalTransfers(r.Context(), address)
+	if err != nil {
+		h.internalError(w, "Failed to get internal transfers", err)
+		return
+	}
+	if !h.markTruncated(w, r, address) {
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(newInternalTransferResponses(transfers))
+	if err != nil {
+		return
+	}
+}
+
+func (h *ParserHandler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "Address parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	withdrawals, err := h.service.GetWithdrawals(r.Context(), address)
+	if err != nil {
+		h.internalError(w, "Failed to get withdrawals", err)
+		return
+	}
+	if !h.markTruncated(w, r, address) {
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(newWithdrawalResponses(withdrawals))
+	if err != nil {
+		return
+	}
+}
+
+// ContractABI uploads a contract's ABI on POST and returns the uploaded ABI
+// for ?address= on GET.
+func (h *ParserHandler) ContractABI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getABI(w, r)
+	case http.MethodPost:
+		h.uploadABI(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ParserHandler) uploadABI(w http.ResponseWriter, r *http.Request) {
+	var req UploadABIRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.ABI) == 0 {
+		http.Error(w, "abi is required", http.StatusBadRequest)
+		return
+	}
+
+	methods, err := h.service.UploadABI(r.Context(), req.Address, req.ABI)
+	if err != nil {
+		var appErr *errors.AppError
+		if stderrors.As(err, &appErr) && appErr.Type == errors.ErrorTypeValidation {
+			message := appErr.Message
+			if appErr.Err != nil {
+				// Say what is wrong with the ABI
+				message += ": " + appErr.Err.Error()
+			}
+			http.Error(w, message, http.StatusBadRequest)
+			return
+		}
+		h.internalError(w, "Failed to upload ABI", err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(UploadABIResponse{Success: true, Methods: methods})
+	if err != nil {
+		return
+	}
+}
+
+func (h *ParserHandler) getABI(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "Address parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	data, ok, err := h.service.GetABI(r.Context(), address)
+	if err != nil {
+		h.internalError(w, "Failed to get ABI", err)
+		return
+	}
+	if !ok {
+		http.Error(w, "No ABI uploaded for address", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		return
+	}
+}
+
+// GetBackfills reports backfill jobs: a single job with ?id=, otherwise all
+// jobs, optionally limited to one ?address=.
+func (h *ParserHandler) GetBackfills(w http.ResponseWriter, r *http.Request) {
+	if idParam := r.URL.Query().Get("id"); idParam != "" {
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+			return
+		}
+		job, ok := h.service.GetBackfill(r.Context(), id)
+		if !ok {
+			http.Error(w, "Backfill job not found", http.StatusNotFound)
+			return
+		}
+		err = json.NewEncoder(w).Encode(job)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	jobs := h.service.ListBackfills(r.Context(), r.URL.Query().Get("address"))
+	err := json.NewEncoder(w).Encode(jobs)
 	if err != nil {
 		return
 	}
@@ -52,9 +322,180 @@ func (h *ParserHandler) GetTransactions(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	transactions := h.service.GetTransactions(address)
-	err := json.NewEncoder(w).Encode(transactions)
+	filter, err := transactionFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transactions, err := h.service.GetTransactions(r.Context(), address, filter)
+	if err != nil {
+		h.internalError(w, "Failed to get transactions", err)
+		return
+	}
+	if !h.markTruncated(w, r, address) {
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(newTransactionResponses(transactions))
+	if err != nil {
+		return
+	}
+}
+
+// GetTransactionSummary totals the address's transactions, accepting the
+// same filters as GetTransactions.
+func (h *ParserHandler) GetTransactionSummary(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "Address parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := transactionFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	summary, err := h.service.GetTransactionSummary(r.Context(), address, filter)
+	if err != nil {
+		h.internalError(w, "Failed to summarize transactions", err)
+		return
+	}
+	if !h.markTruncated(w, r, address) {
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(newTransactionSummaryResponse(summary))
 	if err != nil {
 		return
 	}
 }
+
+// historyTruncatedHeader is set on history responses when retention evicted
+// some of the address's older records.
+const historyTruncatedHeader = "X-History-Truncated"
+
+// markTruncated sets historyTruncatedHeader when the address's history is
+// incomplete. It reports false after writing an error response.
+func (h *ParserHandler) markTruncated(w http.ResponseWriter, r *http.Request, address string) bool {
+	truncated, err := h.service.IsHistoryTruncated(r.Context(), address)
+	if err != nil {
+		h.internalError(w, "Failed to check history retention", err)
+		return false
+	}
+	if truncated {
+		w.Header().Set(historyTruncatedHeader, "true")
+	}
+	return true
+}
+
+// GetBlockAtTime maps ?time= (RFC 3339 or Unix seconds) to the block whose
+// timestamp is nearest to it.
+func (h *ParserHandler) GetBlockAtTime(w http.ResponseWriter, r *http.Request) {
+	param := r.URL.Query().Get("time")
+	if param == "" {
+		http.Error(w, "Time parameter is required", http.StatusBadRequest)
+		return
+	}
+	t, err := parseTime(param)
+	if err != nil {
+		http.Error(w, "Invalid time parameter", http.StatusBadRequest)
+		return
+	}
+
+	header, err := h.service.BlockAtTime(r.Context(), t)
+	if err != nil {
+		h.internalError(w, "Failed to find block", err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(BlockAtTimeResponse{
+		BlockNumber: header.Number,
+		Hash:        header.Hash,
+		Timestamp:   header.Timestamp,
+	})
+	if err != nil {
+		return
+	}
+}
+
+// transactionFilter reads the transaction filter from the query string.
+// Values are wei, or decimal amounts with a gwei or ether suffix; times are
+// RFC 3339 or Unix seconds.
+func transactionFilter(r *http.Request) (entity.TransactionFilter, error) {
+	var filter entity.TransactionFilter
+	query := r.URL.Query()
+	if minStatus := query.Get("min_status"); minStatus != "" {
+		status, ok := entity.ParseTransactionStatus(minStatus)
+		if !ok {
+			return filter, stderrors.New("Invalid min_status parameter")
+		}
+		filter.MinStatus = status
+	}
+	if excludeReverted := query.Get("exclude_reverted"); excludeReverted != "" {
+		exclude, err := strconv.ParseBool(excludeReverted)
+		if err != nil {
+			return filter, stderrors.New("Invalid exclude_reverted parameter")
+		}
+		filter.ExcludeReverted = exclude
+	}
+	if minValue := query.Get("min_value"); minValue != "" {
+		value, err := ethereum.ParseAmount(minValue)
+		if err != nil {
+			return filter, stderrors.New("Invalid min_value parameter")
+		}
+		filter.MinValue = value
+	}
+	if maxValue := query.Get("max_value"); maxValue != "" {
+		value, err := ethereum.ParseAmount(maxValue)
+		if err != nil {
+			return filter, stderrors.New("Invalid max_value parameter")
+		}
+		filter.MaxValue = value
+	}
+	if fromBlock := query.Get("from_block"); fromBlock != "" {
+		block, err := strconv.Atoi(fromBlock)
+		if err != nil || block < 0 {
+			return filter, stderrors.New("Invalid from_block parameter")
+		}
+		filter.FromBlock = block
+	}
+	if toBlock := query.Get("to_block"); toBlock != "" {
+		block, err := strconv.Atoi(toBlock)
+		if err != nil || block < 0 {
+			return filter, stderrors.New("Invalid to_block parameter")
+		}
+		filter.ToBlock = block
+	}
+	if fromTime := query.Get("from_time"); fromTime != "" {
+		t, err := parseTime(fromTime)
+		if err != nil {
+			return filter, stderrors.New("Invalid from_time parameter")
+		}
+		filter.FromTime = t
+	}
+	if toTime := query.Get("to_time"); toTime != "" {
+		t, err := parseTime(toTime)
+		if err != nil {
+			return filter, stderrors.New("Invalid to_time parameter")
+		}
+		filter.ToTime = t
+	}
+	return filter, nil
+}
+
+// parseTime accepts an RFC 3339 time or a Unix timestamp in seconds.
+func parseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// internalError logs the cause and answers with a generic 500.
+func (h *ParserHandler) internalError(w http.ResponseWriter, message string, err error) {
+	h.logger.Error(message, zap.Error(err))
+	http.Error(w, message, http.StatusInternalServerError)
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"math/big"
+)
+
+// Amount is an exact amount of wei along with its value in ether and gwei.
+// All three are decimal strings so no precision is lost to JSON numbers.
+type Amount struct {
+	Wei   string
+	Ether string
+	Gwei  string
+}
+
+func newAmount(wei *big.Int) Amount {
+	if wei == nil {
+		wei = new(big.Int)
+	}
+	return Amount{
+		Wei:   wei.String(),
+		Ether: ethereum.FormatUnits(wei, ethereum.EtherDecimals),
+		Gwei:  ethereum.FormatUnits(wei, ethereum.GweiDecimals),
+	}
+}
+
+// TransactionResponse is a transaction with its Value formatted as an Amount.
+type TransactionResponse struct {
+	entity.Transaction
+	Value Amount
+}
+
+func newTransactionResponses(transactions []entity.Transaction) []TransactionResponse {
+	responses := make([]TransactionResponse, len(transactions))
+	for i, tx := range transactions {
+		responses[i] = TransactionResponse{Transaction: tx, Value: newAmount(tx.Value)}
+	}
+	return responses
+}
+
+// InternalTransferResponse is an internal transfer with its Value formatted
+// as an Amount.
+type InternalTransferResponse struct {
+	entity.InternalTransfer
+	Value Amount
+}
+
+func newInternalTransferResponses(transfers []entity.InternalTransfer) []InternalTransferResponse {
+	responses := make([]InternalTransferResponse, len(transfers))
+	for i, transfer := range transfers {
+		responses[i] = InternalTransferResponse{InternalTransfer: transfer, Value: newAmount(transfer.Value)}
+	}
+	return responses
+}
+
+// TransactionSummaryResponse is a transaction summary with its totals
+// formatted as Amounts.
+type TransactionSummaryResponse struct {
+	Address  string
+	Count    int
+	Received Amount
+	Sent     Amount
+	FeesPaid Amount
+}
+
+func newTransactionSummaryResponse(summary entity.TransactionSummary) TransactionSummaryResponse {
+	return TransactionSummaryResponse{
+		Address:  summary.Address,
+		Count:    summary.Count,
+		Received: newAmount(summary.Received),
+		Sent:     newAmount(summary.Sent),
+		FeesPaid: newAmount(summary.FeesPaid),
+	}
+}
+
+// WithdrawalResponse is a withdrawal with its Amount in wei, ether and gwei.
+type WithdrawalResponse struct {
+	entity.Withdrawal
+	Amount Amount
+}
+
+func newWithdrawalResponses(withdrawals []entity.Withdrawal) []WithdrawalResponse {
+	responses := make([]WithdrawalResponse, len(withdrawals))
+	for i, withdrawal := range withdrawals {
+		responses[i] = WithdrawalResponse{Withdrawal: withdrawal, Amount: newAmount(withdrawal.Amount)}
+	}
+	return responses
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"net/http"
+)
+
+// EndpointPool exposes the health of a multi-endpoint RPC client.
+type EndpointPool interface {
+	Status() []ethereum.EndpointStatus
+}
+
+type RPCHandler struct {
+	pool EndpointPool
+}
+
+func NewRPCHandler(pool EndpointPool) *RPCHandler {
+	return &RPCHandler{pool: pool}
+}
+
+func (h *RPCHandler) GetEndpoints(w http.ResponseWriter, r *http.Request) {
+	err := json.NewEncoder(w).Encode(h.pool.Status())
+	if err != nil {
+		return
+	}
+}
@@ -1,28 +1,55 @@
 package server
 
 import (
+	"context"
+	"expvar"
 	"github.com/grokkos/ether-tx-parser/internal/api/http/handler"
 	"net/http"
+	"time"
 )
 
 type Server struct {
-	handler *handler.ParserHandler
-	mux     *http.ServeMux
+	handler        *handler.ParserHandler
+	rpcHandler     *handler.RPCHandler
+	mux            *http.ServeMux
+	requestTimeout time.Duration
 }
 
-func NewServer(handler *handler.ParserHandler) *Server {
+// NewServer wires the HTTP handlers. rpcHandler may be nil when the service
+// talks to a single RPC endpoint rather than a pool. Every request's context
+// carries a deadline of requestTimeout.
+func NewServer(handler *handler.ParserHandler, rpcHandler *handler.RPCHandler, requestTimeout time.Duration) *Server {
 	return &Server{
-		handler: handler,
-		mux:     http.NewServeMux(),
+		handler:        handler,
+		rpcHandler:     rpcHandler,
+		mux:            http.NewServeMux(),
+		requestTimeout: requestTimeout,
 	}
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.requestTimeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), s.requestTimeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
 	s.mux.ServeHTTP(w, r)
 }
 
 func (s *Server) SetupRoutes() {
 	s.mux.HandleFunc("/block", s.handler.GetCurrentBlock)
+	s.mux.HandleFunc("/block-at-time", s.handler.GetBlockAtTime)
 	s.mux.HandleFunc("/subscribe", s.handler.Subscribe)
 	s.mux.HandleFunc("/transactions", s.handler.GetTransactions)
+	s.mux.HandleFunc("/transactions/summary", s.handler.GetTransactionSummary)
+	s.mux.HandleFunc("/token-transfers", s.handler.GetTokenTransfers)
+	s.mux.HandleFunc("/nft-transfers", s.handler.GetNFTTransfers)
+	s.mux.HandleFunc("/internal-transfers", s.handler.GetInternalTransfers)
+	s.mux.HandleFunc("/withdrawals", s.handler.GetWithdrawals)
+	s.mux.HandleFunc("/backfills", s.handler.GetBackfills)
+	s.mux.HandleFunc("/abis", s.handler.ContractABI)
+	s.mux.Handle("/debug/vars", expvar.Handler())
+	if s.rpcHandler != nil {
+		s.mux.HandleFunc("/rpc/endpoints", s.rpcHandler.GetEndpoints)
+	}
 }
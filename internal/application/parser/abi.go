@@ -0,0 +1,190 @@
+package parser
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"github.com/grokkos/ether-tx-parser/pkg/ethereum/abi"
+	"go.uber.org/zap"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// contractABIs holds the parsed ABI of every registered contract by
+// lowercase address. It is loaded from the store once and kept current by
+// UploadABI, so addresses without an ABI are a map miss and never cached.
+type contractABIs struct {
+	mutex  sync.RWMutex
+	abis   map[string]*abi.ABI
+	loaded bool
+}
+
+func newContractABIs() *contractABIs {
+	return &contractABIs{abis: make(map[string]*abi.ABI)}
+}
+
+// UploadABI registers the JSON ABI of the contract at address, replacing any
+// earlier one, and returns how many functions it defines. Transactions
+// calling the contract are decoded with it from then on, including ones
+// already stored.
+func (s *Service) UploadABI(ctx context.Context, address string, data []byte) (int, error) {
+	if len(address) != 42 || address[:2] != "0x" {
+		return 0, errors.NewValidationError("invalid contract address", nil)
+	}
+	contract, err := abi.Parse(data)
+	if err != nil {
+		return 0, errors.NewValidationError("invalid ABI", err)
+	}
+
+	if err := s.store.SaveContractABI(ctx, address, data); err != nil {
+		return 0, errors.NewStorageError("failed to save ABI", err)
+	}
+
+	s.abis.mutex.Lock()
+	s.abis.abis[strings.ToLower(address)] = contract
+	s.abis.mutex.Unlock()
+
+	s.logger.Info("Registered contract ABI",
+		zap.String("address", address),
+		zap.Int("methods", contract.Methods()),
+	)
+	return contract.Methods(), nil
+}
+
+// GetABI returns the JSON ABI uploaded for the contract at address.
+func (s *Service) GetABI(ctx context.Context, address string) ([]byte, bool, error) {
+	data, ok, err := s.store.GetContractABI(ctx, address)
+	if err != nil {
+		return nil, false, errors.NewStorageError("failed to get ABI", err)
+	}
+	return data, ok, nil
+}
+
+// contractABI returns the parsed ABI uploaded for address, or nil.
+func (s *Service) contractABI(ctx context.Context, address string) (*abi.ABI, error) {
+	s.abis.mutex.RLock()
+	contract, loaded := s.abis.abis[strings.ToLower(address)], s.abis.loaded
+	s.abis.mutex.RUnlock()
+	if loaded {
+		return contract, nil
+	}
+
+	if err := s.loadABIs(ctx); err != nil {
+		return nil, err
+	}
+	s.abis.mutex.RLock()
+	defer s.abis.mutex.RUnlock()
+	return s.abis.abis[strings.ToLower(address)], nil
+}
+
+// loadABIs parses the stored ABIs into the registry. ABIs uploaded meanwhile
+// are kept, as they are newer than what the store returned.
+func (s *Service) loadABIs(ctx context.Context) error {
+	stored, err := s.store.GetContractABIs(ctx)
+	if err != nil {
+		return errors.NewStorageError("failed to get ABIs", err)
+	}
+
+	s.abis.mutex.Lock()
+	defer s.abis.mutex.Unlock()
+	if s.abis.loaded {
+		return nil
+	}
+	for address, data := range stored {
+		address = strings.ToLower(address)
+		if _, ok := s.abis.abis[address]; ok {
+			continue
+		}
+		// Stored ABIs were validated on upload
+		contract, err := abi.Parse(data)
+		if err != nil {
+			s.logger.Warn("Skipping invalid stored ABI",
+				zap.String("address", address),
+				zap.Error(err),
+			)
+			continue
+		}
+		s.abis.abis[address] = contract
+	}
+	s.abis.loaded = true
+	return nil
+}
+
+// decodeCall decodes the transaction's input with the called contract's
+// uploaded ABI, or else the built-in selector table. It returns nil for plain
+// transfers, unknown functions and input that does not match the function.
+func (s *Service) decodeCall(ctx context.Context, tx entity.Transaction) (*entity.DecodedCall, error) {
+	input, err := hex.DecodeString(strings.TrimPrefix(tx.Input, "0x"))
+	if err != nil || len(input) < 4 {
+		return nil, nil
+	}
+
+	var method abi.Method
+	found := false
+	source := entity.DecodeSourceContract
+	if tx.To != "" {
+		contract, err := s.contractABI(ctx, tx.To)
+		if err != nil {
+			return nil, err
+		}
+		method, found = contract.MethodBySelector(input)
+	}
+	if !found {
+		source = entity.DecodeSourceBuiltin
+		if method, found = abi.LookupSelector(input); !found {
+			return nil, nil
+		}
+	}
+
+	values, err := method.DecodeInput(input)
+	if err != nil {
+		s.logger.Debug("Input does not match the called function",
+			zap.String("hash", tx.Hash),
+			zap.String("signature", method.Signature),
+			zap.Error(err),
+		)
+		return nil, nil
+	}
+
+	return &entity.DecodedCall{
+		Method:    method.Name,
+		Signature: method.Signature,
+		Selector:  method.SelectorHex(),
+		Source:    source,
+		Args:      decodedArgs(method.Inputs, values),
+	}, nil
+}
+
+func decodedArgs(args []abi.Argument, values []interface{}) []entity.DecodedArg {
+	decoded := make([]entity.DecodedArg, len(args))
+	for i, arg := range args {
+		decoded[i] = entity.DecodedArg{
+			Name:  arg.Name,
+			Type:  arg.Type.String(),
+			Value: decodedValue(arg.Type, values[i]),
+		}
+	}
+	return decoded
+}
+
+// decodedValue converts a decoded value into its JSON-friendly form.
+func decodedValue(typ abi.Type, value interface{}) interface{} {
+	switch v := value.(type) {
+	case *big.Int:
+		return v.String()
+	case []byte:
+		return "0x" + hex.EncodeToString(v)
+	case []interface{}:
+		if typ.Kind == abi.TupleKind {
+			return decodedArgs(typ.Components, v)
+		}
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = decodedValue(*typ.Elem, item)
+		}
+		return items
+	}
+	return value
+}
@@ -0,0 +1,369 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBackfillQueueSize bounds how many backfill jobs may wait to run.
+const defaultBackfillQueueSize = 64
+
+// backfills tracks historical backfill jobs. Jobs run one at a time, in the
+// order they were scheduled, so history scans never crowd out live parsing.
+type backfills struct {
+	mutex  sync.RWMutex
+	jobs   map[int]*entity.BackfillJob
+	nextID int
+	queue  chan int
+}
+
+func newBackfills() *backfills {
+	return &backfills{
+		jobs:  make(map[int]*entity.BackfillJob),
+		queue: make(chan int, defaultBackfillQueueSize),
+	}
+}
+
+// update applies change to a job under the lock and returns a copy.
+func (b *backfills) update(id int, change func(job *entity.BackfillJob)) entity.BackfillJob {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	job := b.jobs[id]
+	change(job)
+	return *job
+}
+
+// ScheduleBackfill queues a job that scans history for the address's
+// transactions, starting at fromBlock or, when fromTime is set, at the first
+// block produced at or after it. The scan ends at the block live parsing has
+// reached when the job starts, so together they cover the whole range; before
+// live parsing has started it ends at the last confirmed block.
+func (s *Service) ScheduleBackfill(ctx context.Context, address string, fromBlock int, fromTime time.Time) (entity.BackfillJob, error) {
+	if err := ctx.Err(); err != nil {
+		return entity.BackfillJob{}, err
+	}
+	if fromBlock < 0 {
+		return entity.BackfillJob{}, errors.NewValidationError("from_block must not be negative", nil)
+	}
+
+	s.backfills.mutex.Lock()
+	defer s.backfills.mutex.Unlock()
+
+	job := &entity.BackfillJob{
+		ID:        s.backfills.nextID + 1,
+		Address:   strings.ToLower(address),
+		Status:    entity.BackfillQueued,
+		FromBlock: fromBlock,
+		CreatedAt: time.Now().UTC(),
+	}
+	if !fromTime.IsZero() {
+		from := fromTime.UTC()
+		job.FromTime = &from
+	}
+
+	select {
+	case s.backfills.queue <- job.ID:
+	default:
+		return entity.BackfillJob{}, errors.NewValidationError("too many backfill jobs queued", nil)
+	}
+	s.backfills.nextID = job.ID
+	s.backfills.jobs[job.ID] = job
+
+	s.logger.Info("Scheduled backfill",
+		zap.Int("job_id", job.ID),
+		zap.String("address", job.Address),
+		zap.Int("from_block", fromBlock),
+		zap.Timep("from_time", job.FromTime),
+	)
+	return *job, nil
+}
+
+// GetBackfill returns the job with the given ID.
+func (s *Service) GetBackfill(ctx context.Context, id int) (entity.BackfillJob, bool) {
+	s.backfills.mutex.RLock()
+	defer s.backfills.mutex.RUnlock()
+
+	job, ok := s.backfills.jobs[id]
+	if !ok {
+		return entity.BackfillJob{}, false
+	}
+	return *job, true
+}
+
+// ListBackfills returns the jobs in scheduling order, limited to one address
+// when address is not empty.
+func (s *Service) ListBackfills(ctx context.Context, address string) []entity.BackfillJob {
+	s.backfills.mutex.RLock()
+	defer s.backfills.mutex.RUnlock()
+
+	jobs := []entity.BackfillJob{}
+	for _, job := range s.backfills.jobs {
+		if address == "" || strings.EqualFold(job.Address, address) {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs
+}
+
+// RunBackfills executes queued backfill jobs until the context is cancelled.
+// A job interrupted by cancellation is marked cancelled; jobs still waiting
+// in the queue stay queued.
+func (s *Service) RunBackfills(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.backfills.queue:
+			s.runBackfill(ctx, id)
+		}
+	}
+}
+
+func (s *Service) runBackfill(ctx context.Context, id int) {
+	job := s.backfills.update(id, func(job *entity.BackfillJob) {
+		started := time.Now().UTC()
+		job.Status = entity.BackfillRunning
+		job.StartedAt = &started
+	})
+
+	err := s.backfill(ctx, job)
+
+	job = s.backfills.update(id, func(job *entity.BackfillJob) {
+		finished := time.Now().UTC()
+		job.FinishedAt = &finished
+		switch {
+		case err == nil:
+			job.Status = entity.BackfillCompleted
+		case ctx.Err() != nil:
+			job.Status = entity.BackfillCancelled
+		default:
+			job.Status = entity.BackfillFailed
+			job.Error = err.Error()
+		}
+	})
+
+	if err != nil && ctx.Err() == nil {
+		s.logger.Error("Backfill failed",
+			zap.Int("job_id", id),
+			zap.String("address", job.Address),
+			zap.Int("processed_block", job.ProcessedBlock),
+			zap.Error(err),
+		)
+		return
+	}
+	s.logger.Info("Backfill finished",
+		zap.Int("job_id", id),
+		zap.String("address", job.Address),
+		zap.String("status", string(job.Status)),
+		zap.Int("found", job.Found),
+		zap.Int("added", job.Added),
+	)
+}
+
+// backfill scans the job's range in batches and merges what it finds, so
+// transactions live parsing already stored are not duplicated. It fetches
+// through its own fetchState and leaves subscriptions alone, so scanning
+// history never changes how live blocks are processed.
+func (s *Service) backfill(ctx context.Context, job entity.BackfillJob) error {
+	to, err := s.store.GetCurrentBlock(ctx)
+	if err != nil {
+		return errors.NewStorageError("failed to get current block", err)
+	}
+	if to == 0 {
+		// Live parsing has not started yet, so no stored headers guard
+		// against reorgs; cover history up to the confirmed blocks only
+		latest, err := s.latestBlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		if to = latest - s.confirmationDepth; to < 0 {
+			to = 0
+		}
+	}
+
+	from := job.FromBlock
+	if job.FromTime != nil {
+		if from, err = s.blockAtTime(ctx, *job.FromTime); err != nil {
+			return err
+		}
+	}
+
+	s.backfills.update(job.ID, func(job *entity.BackfillJob) {
+		job.FromBlock = from
+		job.ToBlock = to
+		job.ProcessedBlock = from - 1
+	})
+
+	// Receipt and tracing APIs this job finds missing on old blocks stay
+	// enabled for live parsing
+	state := s.fetch.fork()
+	match := func(addresses ...string) (bool, error) {
+		for _, address := range addresses {
+			if strings.EqualFold(address, job.Address) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	for start := from; start <= to; start += s.batchSize {
+		end := start + s.batchSize - 1
+		if end > to {
+			end = to
+		}
+
+		blocks, err := s.fetchBlocks(ctx, start, end)
+		if err != nil {
+			return errors.NewEthereumError(fmt.Sprintf("failed to fetch blocks %d-%d", start, end), err)
+		}
+
+		var batch backfillBatch
+		for i, block := range blocks {
+			transactions, err := extractTransactions(start+i, block, match)
+			if err != nil {
+				return err
+			}
+			if err := s.attachReceipts(ctx, state, start+i, block, transactions); err != nil {
+				return err
+			}
+			batch.transactions = append(batch.transactions, transactions...)
+
+			transfers, err := extractTokenTransfers(start+i, block, match)
+			if err != nil {
+				return err
+			}
+			batch.tokenTransfers = append(batch.tokenTransfers, transfers...)
+
+			nfts, err := extractNFTTransfers(start+i, block, match)
+			if err != nil {
+				return err
+			}
+			batch.nftTransfers = append(batch.nftTransfers, nfts...)
+
+			internal, err := s.traceInternalTransfers(ctx, state, start+i, block, match)
+			if err != nil {
+				return err
+			}
+			batch.internalTransfers = append(batch.internalTransfers, internal...)
+
+			withdrawals, err := extractWithdrawals(start+i, block, match)
+			if err != nil {
+				return err
+			}
+			batch.withdrawals = append(batch.withdrawals, withdrawals...)
+		}
+
+		added, err := s.mergeBackfillBatch(ctx, job.Address, start, blocks, batch)
+		if err != nil {
+			return err
+		}
+
+		s.backfills.update(job.ID, func(job *entity.BackfillJob) {
+			job.ProcessedBlock = end
+			job.Found += batch.size()
+			job.Added += added
+		})
+	}
+	return nil
+}
+
+// backfillBatch holds the records a backfill found in one batch of blocks.
+type backfillBatch struct {
+	transactions      []entity.Transaction
+	tokenTransfers    []entity.TokenTransfer
+	nftTransfers      []entity.NFTTransfer
+	internalTransfers []entity.InternalTransfer
+	withdrawals       []entity.Withdrawal
+}
+
+func (b backfillBatch) size() int {
+	return len(b.transactions) + len(b.tokenTransfers) + len(b.nftTransfers) +
+		len(b.internalTransfers) + len(b.withdrawals)
+}
+
+// mergeBackfillBatch checks the batch's blocks against the chain live parsing
+// has stored and merges the batch into the address's history, returning how
+// many records were new. The check and the merge run without a rollback in
+// between, so records from a block that was reorganized away are never
+// merged after live parsing already discarded that block.
+func (s *Service) mergeBackfillBatch(ctx context.Context, address string, first int, blocks []*Block, batch backfillBatch) (int, error) {
+	s.rollbackMutex.RLock()
+	defer s.rollbackMutex.RUnlock()
+
+	if err := s.verifyBackfillBlocks(ctx, first, blocks); err != nil {
+		return 0, err
+	}
+
+	added := 0
+	if len(batch.transactions) > 0 {
+		n, err := s.store.MergeTransactions(ctx, address, batch.transactions)
+		if err != nil {
+			return 0, errors.NewStorageError("failed to merge transactions", err)
+		}
+		added += n
+	}
+	if len(batch.tokenTransfers) > 0 {
+		n, err := s.store.MergeTokenTransfers(ctx, address, batch.tokenTransfers)
+		if err != nil {
+			return 0, errors.NewStorageError("failed to merge token transfers", err)
+		}
+		added += n
+	}
+	if len(batch.nftTransfers) > 0 {
+		n, err := s.store.MergeNFTTransfers(ctx, address, batch.nftTransfers)
+		if err != nil {
+			return 0, errors.NewStorageError("failed to merge NFT transfers", err)
+		}
+		added += n
+	}
+	if len(batch.internalTransfers) > 0 {
+		n, err := s.store.MergeInternalTransfers(ctx, address, batch.internalTransfers)
+		if err != nil {
+			return 0, errors.NewStorageError("failed to merge internal transfers", err)
+		}
+		added += n
+	}
+	if len(batch.withdrawals) > 0 {
+		n, err := s.store.MergeWithdrawals(ctx, address, batch.withdrawals)
+		if err != nil {
+			return 0, errors.NewStorageError("failed to merge withdrawals", err)
+		}
+		added += n
+	}
+	return added, nil
+}
+
+// verifyBackfillBlocks fails when a fetched block is not the one live parsing
+// stored at its height: a different stored hash, or no header at all above
+// the current block after a rollback. Blocks whose headers were already
+// pruned are older than any reorg the parser handles.
+func (s *Service) verifyBackfillBlocks(ctx context.Context, first int, blocks []*Block) error {
+	current, err := s.store.GetCurrentBlock(ctx)
+	if err != nil {
+		return errors.NewStorageError("failed to get current block", err)
+	}
+
+	for i, block := range blocks {
+		blockNum := first + i
+		header, ok, err := s.store.GetBlockHeader(ctx, blockNum)
+		if err != nil {
+			return errors.NewStorageError("failed to get block header", err)
+		}
+		if ok && !strings.EqualFold(header.Hash, block.Hash) || !ok && blockNum > current {
+			return errors.NewEthereumError(
+				fmt.Sprintf("block %d was reorganized during the backfill", blockNum), nil)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"go.uber.org/zap"
+)
+
+type Block struct {
+	Number       string             `json:"number"`
+	Hash         string             `json:"hash"`
+	ParentHash   string             `json:"parentHash"`
+	Timestamp    string             `json:"timestamp"`
+	Transactions []BlockTransaction `json:"transactions"`
+	// Withdrawals is empty for blocks before Shanghai
+	Withdrawals []blockWithdrawal `json:"withdrawals"`
+
+	// Logs holds the block's token and NFT transfer events, fetched separately
+	Logs []rpcLog `json:"-"`
+}
+
+// BlockTransaction is a transaction object as returned inside a full block.
+// Quantities are hex strings; optional ones are empty when not applicable.
+type BlockTransaction struct {
+	Hash                 string `json:"hash"`
+	From                 string `json:"from"`
+	To                   string `json:"to"`
+	Value                string `json:"value"`
+	Nonce                string `json:"nonce"`
+	Gas                  string `json:"gas"`
+	GasPrice             string `json:"gasPrice"`
+	MaxFeePerGas         string `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas"`
+	Input                string `json:"input"`
+	Type                 string `json:"type"`
+	ChainID              string `json:"chainId"`
+	TransactionIndex     string `json:"transactionIndex"`
+}
+
+// toEntity converts the node's transaction into an entity.Transaction.
+func (tx BlockTransaction) toEntity(blockNum int, block *Block) (entity.Transaction, error) {
+	transaction := entity.Transaction{
+		Hash:                 tx.Hash,
+		From:                 tx.From,
+		To:                   tx.To,
+		BlockNumber:          blockNum,
+		GasPrice:             tx.GasPrice,
+		MaxFeePerGas:         tx.MaxFeePerGas,
+		MaxPriorityFeePerGas: tx.MaxPriorityFeePerGas,
+		Input:                tx.Input,
+		BlockHash:            block.Hash,
+	}
+
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"nonce", tx.Nonce}, {"gas", tx.Gas}, {"type", tx.Type}, {"chainId", tx.ChainID},
+		{"transactionIndex", tx.TransactionIndex}, {"timestamp", block.Timestamp},
+	}
+	quantities := make([]uint64, len(fields))
+	for i, field := range fields {
+		quantity, err := parseQuantity(field.value)
+		if err != nil {
+			return entity.Transaction{}, errors.NewValidationError(
+				fmt.Sprintf("invalid %s in transaction %s", field.name, tx.Hash), err)
+		}
+		quantities[i] = quantity
+	}
+
+	value, err := ethereum.ParseQuantity(tx.Value)
+	if err != nil {
+		return entity.Transaction{}, errors.NewValidationError(
+			fmt.Sprintf("invalid value in transaction %s", tx.Hash), err)
+	}
+	transaction.Value = value
+
+	transaction.Nonce = quantities[0]
+	transaction.Gas = quantities[1]
+	transaction.Type = int(quantities[2])
+	transaction.ChainID = quantities[3]
+	transaction.TransactionIndex = int(quantities[4])
+	transaction.BlockTimestamp = int64(quantities[5])
+	return transaction, nil
+}
+
+// parseQuantity decodes a hex quantity; an absent quantity is zero.
+func parseQuantity(value string) (uint64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	var quantity uint64
+	if _, err := fmt.Sscanf(value, "0x%x", &quantity); err != nil {
+		return 0, err
+	}
+	return quantity, nil
+}
+
+func (s *Service) fetchBlock(ctx context.Context, blockNum int, fullTransactions bool) (*Block, error) {
+	blockResponse, err := s.client.MakeRPCCall(ctx, "eth_getBlockByNumber",
+		[]interface{}{fmt.Sprintf("0x%x", blockNum), fullTransactions})
+	if err != nil {
+		return nil, errors.NewEthereumError("failed to get block", err)
+	}
+
+	if result, ok := blockResponse.Result.(map[string]interface{}); ok && !fullTransactions {
+		// Without full transactions the node lists bare hashes, which do not
+		// decode into Block; callers asking for headers only never use them
+		header := make(map[string]interface{}, len(result))
+		for key, value := range result {
+			if key != "transactions" {
+				header[key] = value
+			}
+		}
+		blockResponse = &ethereum.JSONRPCResponse{Result: header}
+	}
+
+	return decodeBlock(blockResponse)
+}
+
+// fetchBlocks requests the blocks from first to last together with their
+// transfer logs. It returns the contiguous prefix of blocks that could
+// be fetched completely; the returned error describes the first block that
+// could not.
+func (s *Service) fetchBlocks(ctx context.Context, first, last int) ([]*Block, error) {
+	blocks, err := s.fetchBlockBodies(ctx, first, last)
+	fetched, logsErr := s.fetchLogs(ctx, first, blocks)
+	if logsErr != nil {
+		return blocks[:fetched], logsErr
+	}
+	return blocks, err
+}
+
+// fetchBlockBodies requests the blocks from first to last in a single batch.
+// It returns the contiguous prefix of blocks that could be fetched; entries
+// that failed inside the batch are retried individually before giving up, and
+// the returned error describes the first block that could not be fetched.
+func (s *Service) fetchBlockBodies(ctx context.Context, first, last int) ([]*Block, error) {
+	if first == last {
+		block, err := s.fetchBlock(ctx, first, true)
+		if err != nil {
+			return nil, err
+		}
+		return []*Block{block}, nil
+	}
+
+	requests := make([]ethereum.JSONRPCRequest, 0, last-first+1)
+	for blockNum := first; blockNum <= last; blockNum++ {
+		requests = append(requests, ethereum.JSONRPCRequest{
+			Method: "eth_getBlockByNumber",
+			Params: []interface{}{fmt.Sprintf("0x%x", blockNum), true},
+		})
+	}
+
+	responses, err := s.client.BatchRPCCall(ctx, requests)
+	if err != nil {
+		return nil, errors.NewEthereumError("failed to get block batch", err)
+	}
+
+	blocks := make([]*Block, 0, len(responses))
+	for i, response := range responses {
+		blockNum := first + i
+
+		var block *Block
+		if response.Error == nil {
+			block, err = decodeBlock(response)
+		}
+		if response.Error != nil || err != nil {
+			s.logger.Debug("Batch entry failed, retrying individually",
+				zap.Int("block_number", blockNum),
+				zap.Any("rpc_error", response.Error),
+				zap.Error(err),
+			)
+			if block, err = s.fetchBlock(ctx, blockNum, true); err != nil {
+				return blocks, err
+			}
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
+// decodeBlock converts a block result into a Block. A null result means the
+// node does not have the block yet.
+func decodeBlock(response *ethereum.JSONRPCResponse) (*Block, error) {
+	if response.Result == nil {
+		return nil, errors.NewEthereumError("block not available", nil)
+	}
+
+	blockData, err := json.Marshal(response.Result)
+	if err != nil {
+		return nil, errors.NewUnexpectedError("error marshaling block data", err)
+	}
+
+	var block Block
+	if err := json.Unmarshal(blockData, &block); err != nil {
+		return nil, errors.NewValidationError("error unmarshaling block", err)
+	}
+
+	return &block, nil
+}
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"time"
+)
+
+// BlockAtTime returns the header of the block whose timestamp is nearest to
+// t, preferring the earlier block on a tie. Times before genesis map to block
+// 0 and times after the head to the head.
+func (s *Service) BlockAtTime(ctx context.Context, t time.Time) (entity.BlockHeader, error) {
+	after, err := s.blockAtTime(ctx, t)
+	if err != nil {
+		return entity.BlockHeader{}, err
+	}
+	if after == 0 {
+		return s.blockHeader(ctx, 0)
+	}
+
+	before, err := s.blockHeader(ctx, after-1)
+	if err != nil {
+		return entity.BlockHeader{}, err
+	}
+	latest, err := s.latestBlockNumber(ctx)
+	if err != nil {
+		return entity.BlockHeader{}, err
+	}
+	if after > latest {
+		return before, nil
+	}
+
+	next, err := s.blockHeader(ctx, after)
+	if err != nil {
+		return entity.BlockHeader{}, err
+	}
+	if next.Timestamp-t.Unix() < t.Unix()-before.Timestamp {
+		return next, nil
+	}
+	return before, nil
+}
+
+// blockAtTime returns the first block produced at or after t, or the block
+// after the head when t is in the future.
+func (s *Service) blockAtTime(ctx context.Context, t time.Time) (int, error) {
+	latest, err := s.latestBlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	target := t.Unix()
+	low, high := 0, latest+1
+	for low < high {
+		mid := low + (high-low)/2
+		header, err := s.blockHeader(ctx, mid)
+		if err != nil {
+			return 0, err
+		}
+		if header.Timestamp < target {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	return low, nil
+}
+
+// blockHeader returns the header of the given block, from the header store
+// when it recorded the block's timestamp and from the node otherwise.
+func (s *Service) blockHeader(ctx context.Context, blockNum int) (entity.BlockHeader, error) {
+	header, ok, err := s.store.GetBlockHeader(ctx, blockNum)
+	if err != nil {
+		return entity.BlockHeader{}, errors.NewStorageError("failed to get block header", err)
+	}
+	if ok && header.Timestamp != 0 {
+		return header, nil
+	}
+
+	block, err := s.fetchBlock(ctx, blockNum, false)
+	if err != nil {
+		return entity.BlockHeader{}, err
+	}
+	return headerOf(blockNum, block)
+}
+
+// headerOf builds the header recorded for a fetched block.
+func headerOf(blockNum int, block *Block) (entity.BlockHeader, error) {
+	timestamp, err := parseQuantity(block.Timestamp)
+	if err != nil {
+		return entity.BlockHeader{}, errors.NewValidationError(fmt.Sprintf("invalid timestamp for block %d", blockNum), err)
+	}
+	return entity.BlockHeader{
+		Number:     blockNum,
+		Hash:       block.Hash,
+		ParentHash: block.ParentHash,
+		Timestamp:  int64(timestamp),
+	}, nil
+}
@@ -0,0 +1,40 @@
+package parser
+
+import (
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// deployedContracts returns the contracts created by transactions whose
+// sender is accepted by deployer, when auto-subscription is enabled. They are
+// subscribed by the block's commit, so a failed commit leaves no
+// subscription behind and a rollback removes them again. Transactions must
+// have their receipts attached.
+func (s *Service) deployedContracts(transactions []entity.Transaction, deployer matchFunc) ([]string, error) {
+	if !s.autoSubscribeContracts {
+		return nil, nil
+	}
+
+	var contracts []string
+	for _, tx := range transactions {
+		if tx.CreatedContract == "" {
+			continue
+		}
+		matched, err := deployer(tx.From)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+
+		contracts = append(contracts, strings.ToLower(tx.CreatedContract))
+		s.logger.Info("Subscribing deployed contract",
+			zap.String("contract", tx.CreatedContract),
+			zap.String("deployer", tx.From),
+			zap.String("hash", tx.Hash),
+		)
+	}
+	return contracts, nil
+}
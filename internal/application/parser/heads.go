@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// chainHeads holds the most recent block numbers the node reported for the
+// latest, safe and finalized tags.
+type chainHeads struct {
+	latest    int
+	safe      int
+	finalized int
+}
+
+// statusOf derives how settled a block is from the configured confirmation
+// depth and the node's safe and finalized tags.
+func (s *Service) statusOf(blockNum int, heads chainHeads) entity.TransactionStatus {
+	switch {
+	case heads.finalized > 0 && blockNum <= heads.finalized:
+		return entity.StatusFinalized
+	case heads.safe > 0 && blockNum <= heads.safe:
+		return entity.StatusSafe
+	case heads.latest-blockNum+1 >= s.confirmationDepth:
+		return entity.StatusConfirmed
+	default:
+		return entity.StatusUnconfirmed
+	}
+}
+
+func (s *Service) currentHeads() chainHeads {
+	s.headsMutex.RLock()
+	defer s.headsMutex.RUnlock()
+	return s.heads
+}
+
+// updateHeads records the latest block and queries the node's safe and
+// finalized tags. Nodes without tag support simply leave them unset.
+func (s *Service) updateHeads(ctx context.Context, latestBlock int) {
+	heads := chainHeads{latest: latestBlock}
+	for tag, target := range map[string]*int{"safe": &heads.safe, "finalized": &heads.finalized} {
+		number, err := s.fetchTaggedBlockNumber(ctx, tag)
+		if err != nil {
+			s.logger.Debug("Block tag unavailable",
+				zap.String("tag", tag),
+				zap.Error(err),
+			)
+			continue
+		}
+		*target = number
+	}
+
+	s.headsMutex.Lock()
+	s.heads = heads
+	s.headsMutex.Unlock()
+}
+
+func (s *Service) fetchTaggedBlockNumber(ctx context.Context, tag string) (int, error) {
+	response, err := s.client.MakeRPCCall(ctx, "eth_getBlockByNumber", []interface{}{tag, false})
+	if err != nil {
+		return 0, err
+	}
+
+	block, err := decodeBlock(response)
+	if err != nil {
+		return 0, err
+	}
+
+	var number int
+	if _, err := fmt.Sscanf(block.Number, "0x%x", &number); err != nil {
+		return 0, errors.NewValidationError("invalid block number format", err)
+	}
+	return number, nil
+}
@@ -0,0 +1,11 @@
+package parser
+
+import "expvar"
+
+// Parser metrics, published under /debug/vars.
+var (
+	// resumeGapBlocks is how many blocks behind the head the last resume was.
+	resumeGapBlocks = expvar.NewInt("parser_resume_gap_blocks")
+	// checkpointBlock is the block in the last saved checkpoint.
+	checkpointBlock = expvar.NewInt("parser_checkpoint_block")
+)
@@ -0,0 +1,195 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"go.uber.org/zap"
+	"math/big"
+	"strings"
+)
+
+const (
+	// transferSingleTopic is keccak256("TransferSingle(address,address,address,uint256,uint256)").
+	transferSingleTopic = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"
+	// transferBatchTopic is keccak256("TransferBatch(address,address,address,uint256[],uint256[])").
+	transferBatchTopic = "0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb"
+)
+
+// extractNFTTransfers decodes the block's ERC-721 and ERC-1155 transfer
+// events accepted by match. Events that do not follow the standard layout are
+// skipped.
+func extractNFTTransfers(blockNum int, block *Block, match matchFunc) ([]entity.NFTTransfer, error) {
+	var transfers []entity.NFTTransfer
+	for _, log := range block.Logs {
+		if log.Removed {
+			continue
+		}
+
+		transfer, ok := decodeNFTTransfer(log)
+		if !ok {
+			continue
+		}
+
+		matched, err := match(transfer.From, transfer.To)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+
+		decoded, err := log.toEntity()
+		if err != nil {
+			return nil, errors.NewValidationError(
+				fmt.Sprintf("invalid log in transaction %s", log.TransactionHash), err)
+		}
+		transfer.Contract = log.Address
+		transfer.TransactionHash = log.TransactionHash
+		transfer.LogIndex = decoded.LogIndex
+		transfer.BlockNumber = blockNum
+		transfer.BlockHash = block.Hash
+		transfers = append(transfers, transfer)
+	}
+	return transfers, nil
+}
+
+// decodeNFTTransfer decodes the parties, token IDs and quantities of an NFT
+// transfer event.
+func decodeNFTTransfer(log rpcLog) (entity.NFTTransfer, bool) {
+	if len(log.Topics) == 0 {
+		return entity.NFTTransfer{}, false
+	}
+
+	switch strings.ToLower(log.Topics[0]) {
+	case transferTopic:
+		// ERC-721 indexes the token ID, which tells it apart from ERC-20
+		if len(log.Topics) != 4 {
+			return entity.NFTTransfer{}, false
+		}
+		from, okFrom := topicAddress(log.Topics[1])
+		to, okTo := topicAddress(log.Topics[2])
+		tokenID, okID := wordToInt(log.Topics[3])
+		if !okFrom || !okTo || !okID {
+			return entity.NFTTransfer{}, false
+		}
+		return entity.NFTTransfer{
+			Standard:   entity.StandardERC721,
+			From:       from,
+			To:         to,
+			TokenIDs:   []string{tokenID.String()},
+			Quantities: []string{"1"},
+		}, true
+
+	case transferSingleTopic, transferBatchTopic:
+		if len(log.Topics) != 4 {
+			return entity.NFTTransfer{}, false
+		}
+		operator, okOperator := topicAddress(log.Topics[1])
+		from, okFrom := topicAddress(log.Topics[2])
+		to, okTo := topicAddress(log.Topics[3])
+		if !okOperator || !okFrom || !okTo {
+			return entity.NFTTransfer{}, false
+		}
+
+		var ids, quantities []*big.Int
+		var ok bool
+		if strings.EqualFold(log.Topics[0], transferSingleTopic) {
+			ids, quantities, ok = decodeSingle(log.Data)
+		} else {
+			ids, quantities, ok = decodeBatch(log.Data)
+		}
+		if !ok {
+			return entity.NFTTransfer{}, false
+		}
+
+		return entity.NFTTransfer{
+			Standard:   entity.StandardERC1155,
+			Operator:   operator,
+			From:       from,
+			To:         to,
+			TokenIDs:   decimalStrings(ids),
+			Quantities: decimalStrings(quantities),
+		}, true
+	}
+	return entity.NFTTransfer{}, false
+}
+
+// decodeSingle decodes TransferSingle data: one id and one value.
+func decodeSingle(data string) ([]*big.Int, []*big.Int, bool) {
+	words, ok := dataWords(data)
+	if !ok || len(words) != 2 {
+		return nil, nil, false
+	}
+	return words[:1], words[1:], true
+}
+
+// decodeBatch decodes TransferBatch data: two ABI-encoded uint256 arrays of
+// equal length.
+func decodeBatch(data string) ([]*big.Int, []*big.Int, bool) {
+	words, ok := dataWords(data)
+	if !ok || len(words) < 2 {
+		return nil, nil, false
+	}
+	ids, okIDs := wordArray(words, words[0])
+	quantities, okQuantities := wordArray(words, words[1])
+	if !okIDs || !okQuantities || len(ids) != len(quantities) {
+		return nil, nil, false
+	}
+	return ids, quantities, true
+}
+
+// wordArray reads a dynamic uint256 array whose length word sits at the
+// given byte offset.
+func wordArray(words []*big.Int, offset *big.Int) ([]*big.Int, bool) {
+	if !offset.IsInt64() || offset.Int64()%32 != 0 {
+		return nil, false
+	}
+	start := offset.Int64() / 32
+	if start >= int64(len(words)) || !words[start].IsInt64() {
+		return nil, false
+	}
+	length := words[start].Int64()
+	if length > int64(len(words))-start-1 {
+		return nil, false
+	}
+	return words[start+1 : start+1+length], true
+}
+
+// dataWords splits log data into 32-byte unsigned integers.
+func dataWords(data string) ([]*big.Int, bool) {
+	hex := strings.TrimPrefix(data, "0x")
+	if len(hex) == 0 || len(hex)%64 != 0 {
+		return nil, false
+	}
+	words := make([]*big.Int, 0, len(hex)/64)
+	for i := 0; i < len(hex); i += 64 {
+		word, ok := new(big.Int).SetString(hex[i:i+64], 16)
+		if !ok {
+			return nil, false
+		}
+		words = append(words, word)
+	}
+	return words, true
+}
+
+func decimalStrings(values []*big.Int) []string {
+	strs := make([]string, len(values))
+	for i, value := range values {
+		strs[i] = value.String()
+	}
+	return strs
+}
+
+func (s *Service) GetNFTTransfers(ctx context.Context, address string) ([]entity.NFTTransfer, error) {
+	s.logger.Debug("Retrieving NFT transfers",
+		zap.String("address", address),
+	)
+
+	transfers, err := s.store.GetNFTTransfers(ctx, address)
+	if err != nil {
+		return nil, errors.NewStorageError("failed to get NFT transfers", err)
+	}
+	return transfers, nil
+}
@@ -0,0 +1,78 @@
+package parser
+
+import "github.com/grokkos/ether-tx-parser/internal/domain/repository"
+
+// Option customizes a Service at construction time.
+type Option func(*Service)
+
+// WithConfirmationDepth sets how many blocks, including its own, a
+// transaction's block needs before the transaction counts as confirmed.
+func WithConfirmationDepth(depth int) Option {
+	return func(s *Service) {
+		if depth > 0 {
+			s.confirmationDepth = depth
+		}
+	}
+}
+
+// WithBatchSize sets how many blocks are fetched per JSON-RPC batch.
+func WithBatchSize(size int) Option {
+	return func(s *Service) {
+		if size > 0 {
+			s.batchSize = size
+		}
+	}
+}
+
+// WithWorkers sets how many block batches are fetched concurrently. Blocks
+// are still committed one at a time in block order.
+func WithWorkers(workers int) Option {
+	return func(s *Service) {
+		if workers > 0 {
+			s.workers = workers
+		}
+	}
+}
+
+// WithCheckpoint saves the last committed block to checkpoint so a restart
+// can resume from it.
+func WithCheckpoint(checkpoint repository.Checkpoint) Option {
+	return func(s *Service) {
+		s.checkpoint = checkpoint
+	}
+}
+
+// WithStartPolicy sets where parsing begins when the service starts.
+func WithStartPolicy(policy StartPolicy) Option {
+	return func(s *Service) {
+		s.startPolicy = policy
+	}
+}
+
+// WithMaxResumeGap sets how many blocks behind the head a resumed checkpoint
+// may be before a warning is logged. Zero disables the warning.
+func WithMaxResumeGap(blocks int) Option {
+	return func(s *Service) {
+		if blocks >= 0 {
+			s.maxResumeGap = blocks
+		}
+	}
+}
+
+// WithTracing records internal transfers using the given tracing API. A node
+// that does not support it leaves tracing disabled rather than failing.
+func WithTracing(mode TraceMode) Option {
+	return func(s *Service) {
+		if mode != "" {
+			s.traceMode = mode
+		}
+	}
+}
+
+// WithAutoSubscribeContracts subscribes every contract that a subscribed
+// address deploys, so the contract's own transactions are tracked too.
+func WithAutoSubscribeContracts(enabled bool) Option {
+	return func(s *Service) {
+		s.autoSubscribeContracts = enabled
+	}
+}
@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// fetchResult is the outcome of fetching one batch of consecutive blocks.
+// blocks holds the contiguous prefix that could be fetched; err describes the
+// first block that could not.
+type fetchResult struct {
+	first  int
+	blocks []*Block
+	err    error
+}
+
+// runPipeline fetches the blocks from first to last with a pool of workers and
+// commits them strictly in block order from a single goroutine. It returns
+// the next block to process: last+1 when the range is done, or the block
+// after the common ancestor when a reorg rewound the cursor. A failed batch
+// stops the pipeline so no later block is ever committed ahead of it.
+func (s *Service) runPipeline(ctx context.Context, first, last int) (int, error) {
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := (last - first + s.batchSize) / s.batchSize
+	results := make([]chan fetchResult, batches)
+	for i := range results {
+		results[i] = make(chan fetchResult, 1)
+	}
+
+	// window bounds how many batches may be fetched ahead of the committer
+	window := make(chan struct{}, 2*s.workers)
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < s.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start := first + i*s.batchSize
+				end := start + s.batchSize - 1
+				if end > last {
+					end = last
+				}
+				blocks, err := s.fetchBlocks(fetchCtx, start, end)
+				results[i] <- fetchResult{first: start, blocks: blocks, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := 0; i < batches; i++ {
+			select {
+			case window <- struct{}{}:
+			case <-fetchCtx.Done():
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-fetchCtx.Done():
+				return
+			}
+		}
+	}()
+
+	// Stop the workers before returning so none outlives the pipeline
+	defer wg.Wait()
+	defer cancel()
+
+	for i := 0; i < batches; i++ {
+		var result fetchResult
+		select {
+		case result = <-results[i]:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		<-window
+
+		next, err := s.applyBlocks(ctx, result.first, result.blocks)
+		if err != nil {
+			return 0, err
+		}
+		if ctx.Err() != nil {
+			s.logger.Info("Block parsing cancelled",
+				zap.Int("last_processed_block", next-1),
+			)
+			return next, ctx.Err()
+		}
+		if next < result.first+len(result.blocks) {
+			// A reorg rewound the cursor; everything fetched ahead is stale
+			return next, nil
+		}
+
+		if result.err != nil {
+			failed := result.first + len(result.blocks)
+			s.logger.Error("Failed to fetch block",
+				zap.Int("block_number", failed),
+				zap.Error(result.err),
+			)
+			return 0, errors.NewEthereumError(fmt.Sprintf("failed to process block %d", failed), result.err)
+		}
+	}
+
+	return last + 1, nil
+}
@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// blockReceipt is a transaction receipt as returned by the node.
+type blockReceipt struct {
+	TransactionHash   string   `json:"transactionHash"`
+	BlockHash         string   `json:"blockHash"`
+	Status            string   `json:"status"`
+	GasUsed           string   `json:"gasUsed"`
+	EffectiveGasPrice string   `json:"effectiveGasPrice"`
+	CumulativeGasUsed string   `json:"cumulativeGasUsed"`
+	ContractAddress   string   `json:"contractAddress"`
+	Logs              []rpcLog `json:"logs"`
+}
+
+func (r blockReceipt) toEntity() (*entity.Receipt, error) {
+	receipt := &entity.Receipt{
+		Status:            entity.ReceiptStatusUnknown,
+		EffectiveGasPrice: r.EffectiveGasPrice,
+		ContractAddress:   r.ContractAddress,
+		Logs:              make([]entity.Log, 0, len(r.Logs)),
+	}
+
+	var err error
+	if r.Status != "" {
+		status, err := parseQuantity(r.Status)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status: %v", err)
+		}
+		receipt.Status = int(status)
+	}
+	if receipt.GasUsed, err = parseQuantity(r.GasUsed); err != nil {
+		return nil, fmt.Errorf("invalid gasUsed: %v", err)
+	}
+	if receipt.CumulativeGasUsed, err = parseQuantity(r.CumulativeGasUsed); err != nil {
+		return nil, fmt.Errorf("invalid cumulativeGasUsed: %v", err)
+	}
+
+	for _, log := range r.Logs {
+		decoded, err := log.toEntity()
+		if err != nil {
+			return nil, err
+		}
+		receipt.Logs = append(receipt.Logs, decoded)
+	}
+	return receipt, nil
+}
+
+// attachReceipts fetches the receipts of the block's matched transactions and
+// sets them on the transactions.
+func (s *Service) attachReceipts(ctx context.Context, state *fetchState, blockNum int, block *Block, transactions []entity.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	receipts, err := s.fetchReceipts(ctx, state, blockNum, transactions)
+	if err != nil {
+		return err
+	}
+
+	for i := range transactions {
+		raw, ok := receipts[strings.ToLower(transactions[i].Hash)]
+		if !ok {
+			return errors.NewEthereumError(
+				fmt.Sprintf("receipt missing for transaction %s", transactions[i].Hash), nil)
+		}
+		if block.Hash != "" && !strings.EqualFold(raw.BlockHash, block.Hash) {
+			// The block was replaced between fetching it and its receipts
+			return errors.NewEthereumError(
+				fmt.Sprintf("receipt for transaction %s belongs to another block", transactions[i].Hash), nil)
+		}
+
+		receipt, err := raw.toEntity()
+		if err != nil {
+			return errors.NewValidationError(
+				fmt.Sprintf("invalid receipt for transaction %s", transactions[i].Hash), err)
+		}
+		transactions[i].Receipt = receipt
+		if transactions[i].IsContractCreation() && !transactions[i].Reverted() {
+			transactions[i].CreatedContract = receipt.ContractAddress
+		}
+	}
+	return nil
+}
+
+// fetchReceipts returns the receipts keyed by lowercase transaction hash. It
+// uses eth_getBlockReceipts and falls back to one eth_getTransactionReceipt
+// per transaction, for good on this fetch path, once the node turns out not
+// to support it.
+func (s *Service) fetchReceipts(ctx context.Context, state *fetchState, blockNum int, transactions []entity.Transaction) (map[string]blockReceipt, error) {
+	if !state.blockReceiptsUnsupported.Load() {
+		receipts, err := s.fetchBlockReceipts(ctx, blockNum)
+		if err == nil {
+			return receipts, nil
+		}
+		if !ethereum.IsMethodUnsupported(err, "eth_getBlockReceipts") {
+			return nil, errors.NewEthereumError(fmt.Sprintf("failed to get receipts for block %d", blockNum), err)
+		}
+		state.blockReceiptsUnsupported.Store(true)
+		s.logger.Info("eth_getBlockReceipts unavailable, fetching receipts per transaction",
+			zap.Error(err),
+		)
+	}
+	return s.fetchTransactionReceipts(ctx, transactions)
+}
+
+func (s *Service) fetchBlockReceipts(ctx context.Context, blockNum int) (map[string]blockReceipt, error) {
+	response, err := s.client.MakeRPCCall(ctx, "eth_getBlockReceipts",
+		[]interface{}{fmt.Sprintf("0x%x", blockNum)})
+	if err != nil {
+		return nil, err
+	}
+
+	var list []blockReceipt
+	if err := decodeResult(response, &list); err != nil {
+		return nil, err
+	}
+
+	receipts := make(map[string]blockReceipt, len(list))
+	for _, receipt := range list {
+		receipts[strings.ToLower(receipt.TransactionHash)] = receipt
+	}
+	return receipts, nil
+}
+
+func (s *Service) fetchTransactionReceipts(ctx context.Context, transactions []entity.Transaction) (map[string]blockReceipt, error) {
+	requests := make([]ethereum.JSONRPCRequest, 0, len(transactions))
+	for _, tx := range transactions {
+		requests = append(requests, ethereum.JSONRPCRequest{
+			Method: "eth_getTransactionReceipt",
+			Params: []interface{}{tx.Hash},
+		})
+	}
+
+	responses, err := s.client.BatchRPCCall(ctx, requests)
+	if err != nil {
+		return nil, errors.NewEthereumError("failed to get transaction receipts", err)
+	}
+
+	receipts := make(map[string]blockReceipt, len(responses))
+	for i, response := range responses {
+		if response.Error != nil {
+			return nil, errors.NewEthereumError(
+				fmt.Sprintf("failed to get receipt for transaction %s", transactions[i].Hash), response.Error)
+		}
+		var receipt blockReceipt
+		if err := decodeResult(response, &receipt); err != nil {
+			return nil, errors.NewEthereumError(
+				fmt.Sprintf("failed to get receipt for transaction %s", transactions[i].Hash), err)
+		}
+		receipts[strings.ToLower(receipt.TransactionHash)] = receipt
+	}
+	return receipts, nil
+}
+
+// decodeResult converts a response's result into out. A null result means
+// the node does not have the data yet.
+func decodeResult(response *ethereum.JSONRPCResponse, out interface{}) error {
+	if response.Result == nil {
+		return errors.NewEthereumError("result not available", nil)
+	}
+
+	data, err := json.Marshal(response.Result)
+	if err != nil {
+		return errors.NewUnexpectedError("error marshaling result", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return errors.NewValidationError("error unmarshaling result", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// isReorg reports whether the fetched block does not build on the block we
+// previously processed at the preceding height.
+func (s *Service) isReorg(ctx context.Context, blockNum int, block *Block) (bool, error) {
+	parent, ok, err := s.store.GetBlockHeader(ctx, blockNum-1)
+	if err != nil {
+		return false, errors.NewStorageError("failed to get block header", err)
+	}
+	if !ok || parent.Hash == "" || block.ParentHash == "" {
+		return false, nil
+	}
+	return parent.Hash != block.ParentHash, nil
+}
+
+// findCommonAncestor walks back from the given block until the stored header
+// matches the canonical chain and returns that block number.
+func (s *Service) findCommonAncestor(ctx context.Context, from int) (int, error) {
+	for blockNum := from; blockNum > from-s.reorgDepth; blockNum-- {
+		header, ok, err := s.store.GetBlockHeader(ctx, blockNum)
+		if err != nil {
+			return 0, errors.NewStorageError("failed to get block header", err)
+		}
+		if !ok {
+			// Nothing older is remembered, so this is as far back as we can verify
+			s.logger.Warn("No stored header to verify reorg against",
+				zap.Int("block_number", blockNum),
+			)
+			return blockNum, nil
+		}
+
+		canonical, err := s.fetchBlock(ctx, blockNum, false)
+		if err != nil {
+			return 0, errors.NewEthereumError(fmt.Sprintf("failed to fetch canonical block %d", blockNum), err)
+		}
+
+		if canonical.Hash == header.Hash {
+			return blockNum, nil
+		}
+	}
+
+	return 0, errors.NewEthereumError(
+		fmt.Sprintf("chain reorganization deeper than %d blocks", s.reorgDepth), nil)
+}
+
+// rollback discards everything recorded above the common ancestor.
+func (s *Service) rollback(ctx context.Context, ancestor int) error {
+	s.rollbackMutex.Lock()
+	defer s.rollbackMutex.Unlock()
+
+	if err := s.store.RollbackTo(ctx, ancestor); err != nil {
+		return errors.NewStorageError("failed to roll back orphaned blocks", err)
+	}
+	if err := s.store.SetCurrentBlock(ctx, ancestor); err != nil {
+		return errors.NewStorageError("failed to rewind current block", err)
+	}
+
+	header, ok, err := s.store.GetBlockHeader(ctx, ancestor)
+	if err != nil {
+		return errors.NewStorageError("failed to get block header", err)
+	}
+	if !ok {
+		header = entity.BlockHeader{Number: ancestor}
+	}
+	return s.saveCheckpoint(ctx, header)
+}
@@ -1,72 +1,230 @@
 package parser
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
 	"github.com/grokkos/ether-tx-parser/internal/domain/repository"
 	"github.com/grokkos/ether-tx-parser/pkg/errors"
 	"github.com/grokkos/ether-tx-parser/pkg/logger"
 	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+// defaultReorgDepth is how many recent block headers are kept for detecting
+// chain reorganizations. A reorg deeper than this aborts parsing.
+const defaultReorgDepth = 64
+
+// defaultConfirmationDepth is the number of blocks after which a transaction
+// is considered confirmed when no other depth is configured.
+const defaultConfirmationDepth = 12
+
+// defaultBatchSize is how many blocks are requested per JSON-RPC batch.
+const defaultBatchSize = 10
+
+// defaultWorkers is how many batches are fetched concurrently.
+const defaultWorkers = 4
+
 type Service struct {
-	store  repository.Store
-	client repository.EthereumClient
-	logger *zap.Logger
+	store             repository.Store
+	client            repository.EthereumClient
+	logger            *zap.Logger
+	reorgDepth        int
+	confirmationDepth int
+	batchSize         int
+	workers           int
+
+	heads      chainHeads
+	headsMutex sync.RWMutex
+
+	backfills *backfills
+	abis      *contractABIs
+	// rollbackMutex keeps a rollback from running between a backfill checking
+	// its blocks against the stored headers and merging them
+	rollbackMutex sync.RWMutex
+
+	checkpoint   repository.Checkpoint
+	startPolicy  StartPolicy
+	maxResumeGap int
+	// started is set once the start policy has been applied
+	started bool
+
+	// traceMode is the configured tracing mode
+	traceMode TraceMode
+	// fetch tracks the node APIs live parsing uses
+	fetch *fetchState
+
+	// autoSubscribeContracts subscribes contracts deployed by subscribed addresses
+	autoSubscribeContracts bool
 }
 
-func NewService(store repository.Store, client repository.EthereumClient) *Service {
-	return &Service{
-		store:  store,
-		client: client,
-		logger: logger.GetLogger(),
+func NewService(store repository.Store, client repository.EthereumClient, opts ...Option) *Service {
+	s := &Service{
+		store:             store,
+		client:            client,
+		logger:            logger.GetLogger(),
+		reorgDepth:        defaultReorgDepth,
+		confirmationDepth: defaultConfirmationDepth,
+		batchSize:         defaultBatchSize,
+		workers:           defaultWorkers,
+		backfills:         newBackfills(),
+		abis:              newContractABIs(),
+		startPolicy:       StartPolicy{Mode: StartCheckpoint},
+		traceMode:         TraceOff,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	tracer := s.traceMode
+	if tracer == TraceAuto {
+		tracer = TraceDebug
+	}
+	s.fetch = &fetchState{}
+	s.fetch.tracer.Store(tracer)
+	return s
+}
+
+// fetchState tracks which optional node APIs a fetch path uses. Live parsing
+// and each backfill keep their own, so what a backfill runs into on old
+// blocks never changes how live blocks are fetched.
+type fetchState struct {
+	// tracer holds the TraceMode in use, which drops to trace_block or
+	// TraceOff once the node turns out not to offer it
+	tracer atomic.Value
+	// blockReceiptsUnsupported is set once the node rejected eth_getBlockReceipts
+	blockReceiptsUnsupported atomic.Bool
 }
 
-func (s *Service) GetCurrentBlock() int {
-	return s.store.GetCurrentBlock()
+// fork returns a copy of the state for another fetch path.
+func (f *fetchState) fork() *fetchState {
+	forked := &fetchState{}
+	forked.tracer.Store(f.tracer.Load())
+	forked.blockReceiptsUnsupported.Store(f.blockReceiptsUnsupported.Load())
+	return forked
 }
 
-func (s *Service) Subscribe(address string) bool {
+func (s *Service) GetCurrentBlock(ctx context.Context) (int, error) {
+	block, err := s.store.GetCurrentBlock(ctx)
+	if err != nil {
+		return 0, errors.NewStorageError("failed to get current block", err)
+	}
+	return block, nil
+}
+
+func (s *Service) Subscribe(ctx context.Context, address string) (bool, error) {
 	// Validate Ethereum address format
 	if len(address) != 42 || address[:2] != "0x" {
 		s.logger.Warn("Invalid ethereum address format",
 			zap.String("address", address),
 		)
-		return false
+		return false, nil
 	}
 
 	s.logger.Info("Subscribing to address",
 		zap.String("address", address),
 	)
-	return s.store.Subscribe(address)
+	subscribed, err := s.store.Subscribe(ctx, address)
+	if err != nil {
+		return false, errors.NewStorageError("failed to subscribe address", err)
+	}
+	return subscribed, nil
 }
 
-func (s *Service) GetTransactions(address string) []entity.Transaction {
+func (s *Service) GetTransactions(ctx context.Context, address string, filter entity.TransactionFilter) ([]entity.Transaction, error) {
 	s.logger.Debug("Retrieving transactions",
 		zap.String("address", address),
+		zap.String("min_status", string(filter.MinStatus)),
 	)
-	return s.store.GetTransactions(address)
+
+	stored, err := s.store.GetTransactions(ctx, address)
+	if err != nil {
+		return nil, errors.NewStorageError("failed to get transactions", err)
+	}
+
+	heads := s.currentHeads()
+	transactions := []entity.Transaction{}
+	for _, tx := range stored {
+		tx.Status = s.statusOf(tx.BlockNumber, heads)
+		if !filter.Matches(tx) {
+			continue
+		}
+		if tx.Decoded, err = s.decodeCall(ctx, tx); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, tx)
+	}
+	return transactions, nil
 }
 
-type Block struct {
-	Transactions []struct {
-		Hash  string `json:"hash"`
-		From  string `json:"from"`
-		To    string `json:"to"`
-		Value string `json:"value"`
-	} `json:"transactions"`
+// IsHistoryTruncated reports whether the store evicted some of the address's
+// transactions under its retention policy.
+func (s *Service) IsHistoryTruncated(ctx context.Context, address string) (bool, error) {
+	truncated, err := s.store.IsHistoryTruncated(ctx, address)
+	if err != nil {
+		return false, errors.NewStorageError("failed to check history retention", err)
+	}
+	return truncated, nil
 }
 
-func (s *Service) ParseBlocks() error {
-	// Get latest block number
-	response, err := s.client.MakeRPCCall("eth_blockNumber", []interface{}{})
+// ParseBlocks processes every block between the current block and the chain
+// head. Cancelling the context stops parsing at the next block boundary; a
+// block that has started being applied is always applied completely.
+func (s *Service) ParseBlocks(ctx context.Context) error {
+	latestBlock, err := s.latestBlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+
+	currentBlock, err := s.store.GetCurrentBlock(ctx)
+	if err != nil {
+		return errors.NewStorageError("failed to get current block", err)
+	}
+	if !s.started {
+		start, err := s.resolveStart(ctx, latestBlock)
+		if err != nil {
+			return err
+		}
+		if start != currentBlock {
+			if err := s.store.SetCurrentBlock(ctx, start); err != nil {
+				return errors.NewStorageError("failed to set current block", err)
+			}
+			currentBlock = start
+		}
+		s.started = true
+	}
+
+	s.logger.Info("Starting block processing",
+		zap.Int("current_block", currentBlock),
+		zap.Int("latest_block", latestBlock),
+	)
+
+	s.updateHeads(ctx, latestBlock)
+
+	// Process blocks through the fetch pipeline; a reorg restarts it from the
+	// common ancestor
+	blockNum := currentBlock + 1
+	for blockNum <= latestBlock {
+		next, err := s.runPipeline(ctx, blockNum, latestBlock)
+		if err != nil {
+			return err
+		}
+		blockNum = next
+	}
+
+	return nil
+}
+
+// latestBlockNumber asks the node for the number of its latest block.
+func (s *Service) latestBlockNumber(ctx context.Context) (int, error) {
+	response, err := s.client.MakeRPCCall(ctx, "eth_blockNumber", []interface{}{})
 	if err != nil {
 		s.logger.Error("Failed to get latest block number",
 			zap.Error(err),
 		)
-		return errors.NewEthereumError("failed to get latest block number", err)
+		return 0, errors.NewEthereumError("failed to get latest block number", err)
 	}
 
 	blockNumberStr, ok := response.Result.(string)
@@ -74,76 +232,207 @@ func (s *Service) ParseBlocks() error {
 		s.logger.Error("Invalid block number format",
 			zap.Any("response", response),
 		)
-		return errors.NewValidationError("invalid block number format", nil)
+		return 0, errors.NewValidationError("invalid block number format", nil)
 	}
 
 	var latestBlock int
 	fmt.Sscanf(blockNumberStr, "0x%x", &latestBlock)
+	return latestBlock, nil
+}
 
-	currentBlock := s.store.GetCurrentBlock()
-	if currentBlock == 0 {
-		currentBlock = latestBlock - 10
-	}
+// applyBlocks processes consecutive blocks starting at first and returns the
+// next block number to fetch. When a reorg is detected the orphaned blocks
+// are rolled back and the block after the common ancestor is returned.
+func (s *Service) applyBlocks(ctx context.Context, first int, blocks []*Block) (int, error) {
+	for i, block := range blocks {
+		blockNum := first + i
+		if ctx.Err() != nil {
+			// Stop at the block boundary; the caller reports the cancellation
+			return blockNum, nil
+		}
 
-	s.logger.Info("Starting block processing",
-		zap.Int("current_block", currentBlock),
-		zap.Int("latest_block", latestBlock),
-	)
+		reorg, err := s.isReorg(ctx, blockNum, block)
+		if err != nil {
+			return 0, err
+		}
+		if reorg {
+			ancestor, err := s.findCommonAncestor(ctx, blockNum-1)
+			if err != nil {
+				return 0, err
+			}
+			if ancestor == blockNum-1 {
+				// The node reports a parent we already agree with; its view is
+				// still settling, so retry on the next run instead of looping.
+				return 0, errors.NewEthereumError(
+					fmt.Sprintf("inconsistent parent hash for block %d", blockNum), nil)
+			}
 
-	// Process blocks
-	for blockNum := currentBlock + 1; blockNum <= latestBlock; blockNum++ {
-		if err := s.processBlock(blockNum); err != nil {
-			s.logger.Error("Failed to process block",
+			s.logger.Warn("Chain reorganization detected, rolling back",
 				zap.Int("block_number", blockNum),
-				zap.Error(err),
+				zap.Int("common_ancestor", ancestor),
 			)
-			return errors.NewEthereumError(fmt.Sprintf("failed to process block %d", blockNum), err)
+			if err := s.rollback(context.WithoutCancel(ctx), ancestor); err != nil {
+				return 0, err
+			}
+
+			// Re-process the canonical branch starting after the ancestor
+			return ancestor + 1, nil
 		}
 
-		s.store.SetCurrentBlock(blockNum)
+		// Once a block is started it is applied completely, even on shutdown
+		if err := s.commitBlock(context.WithoutCancel(ctx), blockNum, block); err != nil {
+			return 0, err
+		}
 		s.logger.Debug("Processed block successfully",
 			zap.Int("block_number", blockNum),
 		)
 	}
 
-	return nil
+	return first + len(blocks), nil
 }
 
-func (s *Service) processBlock(blockNum int) error {
-	blockResponse, err := s.client.MakeRPCCall("eth_getBlockByNumber",
-		[]interface{}{fmt.Sprintf("0x%x", blockNum), true})
+// commitBlock stores the block's relevant records together with its header
+// and the advanced current block, then saves the checkpoint.
+func (s *Service) commitBlock(ctx context.Context, blockNum int, block *Block) error {
+	header, err := headerOf(blockNum, block)
 	if err != nil {
-		return errors.NewEthereumError("failed to get block", err)
+		return err
+	}
+	commit, err := s.processBlock(ctx, blockNum, block)
+	if err != nil {
+		return err
+	}
+	commit.Header = header
+
+	if err := s.store.CommitBlock(ctx, commit); err != nil {
+		return errors.NewStorageError("failed to commit block", err)
 	}
+	if err := s.store.PruneBlockHeaders(ctx, blockNum-s.reorgDepth); err != nil {
+		return errors.NewStorageError("failed to prune block headers", err)
+	}
+	return s.saveCheckpoint(ctx, header)
+}
 
-	blockData, err := json.Marshal(blockResponse.Result)
+// processBlock collects the block's records relevant to subscribed addresses
+// and the deployed contracts the commit subscribes. Records after the
+// deployment are matched against those contracts as well.
+func (s *Service) processBlock(ctx context.Context, blockNum int, block *Block) (entity.BlockCommit, error) {
+	var commit entity.BlockCommit
+	match := func(addresses ...string) (bool, error) {
+		for _, address := range addresses {
+			for _, contract := range commit.Subscriptions {
+				if strings.EqualFold(address, contract) {
+					return true, nil
+				}
+			}
+		}
+		return s.isRelevant(ctx, addresses...)
+	}
+
+	transactions, err := extractTransactions(blockNum, block, match)
 	if err != nil {
-		return errors.NewUnexpectedError("error marshaling block data", err)
+		return commit, err
+	}
+	if err := s.attachReceipts(ctx, s.fetch, blockNum, block, transactions); err != nil {
+		return commit, err
 	}
 
-	var block Block
-	if err := json.Unmarshal(blockData, &block); err != nil {
-		return errors.NewValidationError("error unmarshaling block", err)
+	// Subscribed first in the commit, so their creation is stored for them
+	commit.Subscriptions, err = s.deployedContracts(transactions, match)
+	if err != nil {
+		return commit, err
 	}
 
-	for _, tx := range block.Transactions {
-		if s.store.IsSubscribed(tx.From) || s.store.IsSubscribed(tx.To) {
-			s.logger.Debug("Found relevant transaction",
-				zap.String("hash", tx.Hash),
-				zap.String("from", tx.From),
-				zap.String("to", tx.To),
-			)
+	for _, transaction := range transactions {
+		s.logger.Debug("Found relevant transaction",
+			zap.String("hash", transaction.Hash),
+			zap.String("from", transaction.From),
+			zap.String("to", transaction.To),
+		)
+	}
+	commit.Transactions = transactions
 
-			transaction := entity.Transaction{
-				Hash:        tx.Hash,
-				From:        tx.From,
-				To:          tx.To,
-				Value:       tx.Value,
-				BlockNumber: blockNum,
+	commit.TokenTransfers, err = extractTokenTransfers(blockNum, block, match)
+	if err != nil {
+		return commit, err
+	}
+	for _, transfer := range commit.TokenTransfers {
+		s.logger.Debug("Found relevant token transfer",
+			zap.String("token", transfer.Token),
+			zap.String("hash", transfer.TransactionHash),
+			zap.Int("log_index", transfer.LogIndex),
+		)
+	}
+
+	commit.NFTTransfers, err = extractNFTTransfers(blockNum, block, match)
+	if err != nil {
+		return commit, err
+	}
+	for _, transfer := range commit.NFTTransfers {
+		s.logger.Debug("Found relevant NFT transfer",
+			zap.String("contract", transfer.Contract),
+			zap.String("hash", transfer.TransactionHash),
+			zap.Int("log_index", transfer.LogIndex),
+		)
+	}
+
+	commit.InternalTransfers, err = s.traceInternalTransfers(ctx, s.fetch, blockNum, block, match)
+	if err != nil {
+		return commit, err
+	}
+	for _, transfer := range commit.InternalTransfers {
+		s.logger.Debug("Found relevant internal transfer",
+			zap.String("hash", transfer.TransactionHash),
+			zap.Ints("trace_path", transfer.TracePath),
+		)
+	}
+
+	commit.Withdrawals, err = extractWithdrawals(blockNum, block, match)
+	if err != nil {
+		return commit, err
+	}
+	for _, withdrawal := range commit.Withdrawals {
+		s.logger.Debug("Found relevant withdrawal",
+			zap.Uint64("index", withdrawal.Index),
+			zap.String("address", withdrawal.Address),
+		)
+	}
+	return commit, nil
+}
+
+// matchFunc reports whether a transaction between the given addresses should
+// be kept.
+type matchFunc func(addresses ...string) (bool, error)
+
+// extractTransactions returns the block's transactions accepted by match.
+func extractTransactions(blockNum int, block *Block, match matchFunc) ([]entity.Transaction, error) {
+	var transactions []entity.Transaction
+	for _, tx := range block.Transactions {
+		matched, err := match(tx.From, tx.To)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			transaction, err := tx.toEntity(blockNum, block)
+			if err != nil {
+				return nil, err
 			}
-			s.store.AddTransaction(transaction)
+			transactions = append(transactions, transaction)
 		}
 	}
+	return transactions, nil
+}
 
-	return nil
+// isRelevant reports whether any of the addresses is subscribed.
+func (s *Service) isRelevant(ctx context.Context, addresses ...string) (bool, error) {
+	for _, address := range addresses {
+		subscribed, err := s.store.IsSubscribed(ctx, address)
+		if err != nil {
+			return false, errors.NewStorageError("failed to check subscription", err)
+		}
+		if subscribed {
+			return true, nil
+		}
+	}
+	return false, nil
 }
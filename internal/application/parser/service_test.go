@@ -1,11 +1,21 @@
 package parser
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
 	"github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"github.com/grokkos/ether-tx-parser/pkg/ethereum/abi"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // MockStore is our test implementation of the Store interface
@@ -13,44 +23,356 @@ type MockStore struct {
 	currentBlock int
 	subscribers  map[string]bool
 	transactions map[string][]entity.Transaction
+	headers      map[int]entity.BlockHeader
+	// tokenTransfers is keyed by address as given, without normalizing
+	tokenTransfers map[string][]entity.TokenTransfer
+	nftTransfers   map[string][]entity.NFTTransfer
+	// internalTransfers is keyed by address as given, without normalizing
+	internalTransfers map[string][]entity.InternalTransfer
+	withdrawals       map[string][]entity.Withdrawal
+	abis              map[string][]byte
+	// commitSubscriptions maps addresses subscribed by CommitBlock to the block
+	commitSubscriptions map[string]int
+	// committed records every block number passed to SetCurrentBlock,
+	// including by CommitBlock
+	committed []int
+	// onCommit, when set, is invoked after the current block is advanced
+	onCommit func(block int)
+	// commitErr, when set, fails CommitBlock before anything is stored
+	commitErr error
+	// truncated is reported by IsHistoryTruncated
+	truncated map[string]bool
 }
 
 func NewMockStore() *MockStore {
 	return &MockStore{
-		subscribers:  make(map[string]bool),
-		transactions: make(map[string][]entity.Transaction),
+		subscribers:         make(map[string]bool),
+		transactions:        make(map[string][]entity.Transaction),
+		headers:             make(map[int]entity.BlockHeader),
+		tokenTransfers:      make(map[string][]entity.TokenTransfer),
+		nftTransfers:        make(map[string][]entity.NFTTransfer),
+		internalTransfers:   make(map[string][]entity.InternalTransfer),
+		withdrawals:         make(map[string][]entity.Withdrawal),
+		abis:                make(map[string][]byte),
+		commitSubscriptions: make(map[string]int),
 	}
 }
 
 // Implement all Store interface methods
-func (m *MockStore) GetCurrentBlock() int {
-	return m.currentBlock
+func (m *MockStore) GetCurrentBlock(ctx context.Context) (int, error) {
+	return m.currentBlock, nil
 }
 
-func (m *MockStore) SetCurrentBlock(block int) {
+func (m *MockStore) SetCurrentBlock(ctx context.Context, block int) error {
 	m.currentBlock = block
+	m.committed = append(m.committed, block)
+	if m.onCommit != nil {
+		m.onCommit(block)
+	}
+	return nil
 }
 
-func (m *MockStore) Subscribe(address string) bool {
+func (m *MockStore) Subscribe(ctx context.Context, address string) (bool, error) {
 	m.subscribers[address] = true
-	return true
+	delete(m.commitSubscriptions, address)
+	return true, nil
+}
+
+func (m *MockStore) IsSubscribed(ctx context.Context, address string) (bool, error) {
+	return m.subscribers[address], nil
 }
 
-func (m *MockStore) IsSubscribed(address string) bool {
-	return m.subscribers[address]
+func (m *MockStore) GetSubscriptions(ctx context.Context) ([]string, error) {
+	addresses := []string{}
+	for address := range m.subscribers {
+		addresses = append(addresses, strings.ToLower(address))
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+func (m *MockStore) GetTransactions(ctx context.Context, address string) ([]entity.Transaction, error) {
+	return m.transactions[address], nil
 }
 
-func (m *MockStore) GetTransactions(address string) []entity.Transaction {
-	return m.transactions[address]
+func (m *MockStore) IsHistoryTruncated(ctx context.Context, address string) (bool, error) {
+	return m.truncated[address], nil
 }
 
-func (m *MockStore) AddTransaction(tx entity.Transaction) {
+func (m *MockStore) AddTransaction(ctx context.Context, tx entity.Transaction) error {
 	if m.subscribers[tx.From] {
-		m.transactions[tx.From] = append(m.transactions[tx.From], tx)
+		m.transactions[tx.From] = upsertMock(m.transactions[tx.From], tx, sameHash(tx))
+	}
+	to := tx.To
+	if tx.IsContractCreation() {
+		to = tx.CreatedContract
+	}
+	if m.subscribers[to] {
+		m.transactions[to] = upsertMock(m.transactions[to], tx, sameHash(tx))
+	}
+	return nil
+}
+
+func (m *MockStore) MergeTransactions(ctx context.Context, address string, txs []entity.Transaction) (int, error) {
+	added := 0
+	for _, tx := range txs {
+		known := false
+		for _, existing := range m.transactions[address] {
+			known = known || existing.Hash == tx.Hash
+		}
+		if !known {
+			m.transactions[address] = append(m.transactions[address], tx)
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (m *MockStore) AddTokenTransfer(ctx context.Context, transfer entity.TokenTransfer) error {
+	if m.subscribers[transfer.From] {
+		m.tokenTransfers[transfer.From] = upsertMock(m.tokenTransfers[transfer.From], transfer, sameLog(transfer))
+	}
+	if m.subscribers[transfer.To] {
+		m.tokenTransfers[transfer.To] = upsertMock(m.tokenTransfers[transfer.To], transfer, sameLog(transfer))
+	}
+	return nil
+}
+
+func (m *MockStore) MergeTokenTransfers(ctx context.Context, address string, transfers []entity.TokenTransfer) (int, error) {
+	added := 0
+	for _, transfer := range transfers {
+		known := false
+		for _, existing := range m.tokenTransfers[address] {
+			known = known || (existing.TransactionHash == transfer.TransactionHash && existing.LogIndex == transfer.LogIndex)
+		}
+		if !known {
+			m.tokenTransfers[address] = append(m.tokenTransfers[address], transfer)
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (m *MockStore) GetTokenTransfers(ctx context.Context, address string) ([]entity.TokenTransfer, error) {
+	return m.tokenTransfers[address], nil
+}
+
+func (m *MockStore) AddNFTTransfer(ctx context.Context, transfer entity.NFTTransfer) error {
+	if m.subscribers[transfer.From] {
+		m.nftTransfers[transfer.From] = upsertMock(m.nftTransfers[transfer.From], transfer, sameNFTLog(transfer))
+	}
+	if m.subscribers[transfer.To] {
+		m.nftTransfers[transfer.To] = upsertMock(m.nftTransfers[transfer.To], transfer, sameNFTLog(transfer))
+	}
+	return nil
+}
+
+func (m *MockStore) MergeNFTTransfers(ctx context.Context, address string, transfers []entity.NFTTransfer) (int, error) {
+	added := 0
+	for _, transfer := range transfers {
+		known := false
+		for _, existing := range m.nftTransfers[address] {
+			known = known || (existing.TransactionHash == transfer.TransactionHash && existing.LogIndex == transfer.LogIndex)
+		}
+		if !known {
+			m.nftTransfers[address] = append(m.nftTransfers[address], transfer)
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (m *MockStore) GetNFTTransfers(ctx context.Context, address string) ([]entity.NFTTransfer, error) {
+	return m.nftTransfers[address], nil
+}
+
+func (m *MockStore) AddInternalTransfer(ctx context.Context, transfer entity.InternalTransfer) error {
+	if m.subscribers[transfer.From] {
+		m.internalTransfers[transfer.From] = upsertMock(m.internalTransfers[transfer.From], transfer, sameTrace(transfer))
+	}
+	if m.subscribers[transfer.To] {
+		m.internalTransfers[transfer.To] = upsertMock(m.internalTransfers[transfer.To], transfer, sameTrace(transfer))
+	}
+	return nil
+}
+
+func (m *MockStore) MergeInternalTransfers(ctx context.Context, address string, transfers []entity.InternalTransfer) (int, error) {
+	added := 0
+	for _, transfer := range transfers {
+		known := false
+		for _, existing := range m.internalTransfers[address] {
+			known = known || (existing.TransactionHash == transfer.TransactionHash && reflect.DeepEqual(existing.TracePath, transfer.TracePath))
+		}
+		if !known {
+			m.internalTransfers[address] = append(m.internalTransfers[address], transfer)
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (m *MockStore) GetInternalTransfers(ctx context.Context, address string) ([]entity.InternalTransfer, error) {
+	return m.internalTransfers[address], nil
+}
+
+func (m *MockStore) AddWithdrawal(ctx context.Context, withdrawal entity.Withdrawal) error {
+	if m.subscribers[withdrawal.Address] {
+		m.withdrawals[withdrawal.Address] = upsertMock(m.withdrawals[withdrawal.Address], withdrawal, sameIndex(withdrawal))
+	}
+	return nil
+}
+
+func (m *MockStore) MergeWithdrawals(ctx context.Context, address string, withdrawals []entity.Withdrawal) (int, error) {
+	added := 0
+	for _, withdrawal := range withdrawals {
+		known := false
+		for _, existing := range m.withdrawals[address] {
+			known = known || existing.Index == withdrawal.Index
+		}
+		if !known {
+			m.withdrawals[address] = append(m.withdrawals[address], withdrawal)
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (m *MockStore) GetWithdrawals(ctx context.Context, address string) ([]entity.Withdrawal, error) {
+	return m.withdrawals[address], nil
+}
+
+func (m *MockStore) SaveContractABI(ctx context.Context, address string, abi []byte) error {
+	m.abis[strings.ToLower(address)] = abi
+	return nil
+}
+
+func (m *MockStore) GetContractABI(ctx context.Context, address string) ([]byte, bool, error) {
+	abi, ok := m.abis[strings.ToLower(address)]
+	return abi, ok, nil
+}
+
+func (m *MockStore) GetContractABIs(ctx context.Context) (map[string][]byte, error) {
+	abis := make(map[string][]byte, len(m.abis))
+	for address, abi := range m.abis {
+		abis[address] = abi
 	}
-	if m.subscribers[tx.To] {
-		m.transactions[tx.To] = append(m.transactions[tx.To], tx)
+	return abis, nil
+}
+
+func (m *MockStore) SaveBlockHeader(ctx context.Context, header entity.BlockHeader) error {
+	m.headers[header.Number] = header
+	return nil
+}
+
+func (m *MockStore) GetBlockHeader(ctx context.Context, number int) (entity.BlockHeader, bool, error) {
+	header, ok := m.headers[number]
+	return header, ok, nil
+}
+
+func (m *MockStore) PruneBlockHeaders(ctx context.Context, before int) error {
+	for number := range m.headers {
+		if number < before {
+			delete(m.headers, number)
+		}
+	}
+	return nil
+}
+
+func (m *MockStore) CommitBlock(ctx context.Context, commit entity.BlockCommit) error {
+	if m.commitErr != nil {
+		return m.commitErr
+	}
+	if stored, ok := m.headers[commit.Header.Number]; ok &&
+		stored.Hash == commit.Header.Hash && m.currentBlock >= commit.Header.Number {
+		return nil
+	}
+	for _, address := range commit.Subscriptions {
+		if !m.subscribers[address] {
+			m.subscribers[address] = true
+			m.commitSubscriptions[address] = commit.Header.Number
+		}
+	}
+	for _, tx := range commit.Transactions {
+		m.AddTransaction(ctx, tx)
+	}
+	for _, transfer := range commit.TokenTransfers {
+		m.AddTokenTransfer(ctx, transfer)
+	}
+	for _, transfer := range commit.NFTTransfers {
+		m.AddNFTTransfer(ctx, transfer)
+	}
+	for _, transfer := range commit.InternalTransfers {
+		m.AddInternalTransfer(ctx, transfer)
+	}
+	for _, withdrawal := range commit.Withdrawals {
+		m.AddWithdrawal(ctx, withdrawal)
+	}
+	m.SaveBlockHeader(ctx, commit.Header)
+	return m.SetCurrentBlock(ctx, commit.Header.Number)
+}
+
+func (m *MockStore) RollbackTo(ctx context.Context, block int) error {
+	for address, txs := range m.transactions {
+		var kept []entity.Transaction
+		for _, tx := range txs {
+			if tx.BlockNumber <= block {
+				kept = append(kept, tx)
+			}
+		}
+		m.transactions[address] = kept
+	}
+	for number := range m.headers {
+		if number > block {
+			delete(m.headers, number)
+		}
+	}
+	for address, subscribed := range m.commitSubscriptions {
+		if subscribed > block {
+			delete(m.subscribers, address)
+			delete(m.commitSubscriptions, address)
+		}
+	}
+	if m.currentBlock > block {
+		m.currentBlock = block
+	}
+	return nil
+}
+
+// upsertMock replaces the record in history that same matches, or appends it.
+func upsertMock[T any](history []T, record T, same func(T) bool) []T {
+	for i := range history {
+		if same(history[i]) {
+			history[i] = record
+			return history
+		}
 	}
+	return append(history, record)
+}
+
+func sameHash(tx entity.Transaction) func(entity.Transaction) bool {
+	return func(other entity.Transaction) bool { return other.Hash == tx.Hash }
+}
+
+func sameLog(transfer entity.TokenTransfer) func(entity.TokenTransfer) bool {
+	return func(other entity.TokenTransfer) bool {
+		return other.TransactionHash == transfer.TransactionHash && other.LogIndex == transfer.LogIndex
+	}
+}
+
+func sameNFTLog(transfer entity.NFTTransfer) func(entity.NFTTransfer) bool {
+	return func(other entity.NFTTransfer) bool {
+		return other.TransactionHash == transfer.TransactionHash && other.LogIndex == transfer.LogIndex
+	}
+}
+
+func sameTrace(transfer entity.InternalTransfer) func(entity.InternalTransfer) bool {
+	return func(other entity.InternalTransfer) bool {
+		return other.TransactionHash == transfer.TransactionHash && reflect.DeepEqual(other.TracePath, transfer.TracePath)
+	}
+}
+
+func sameIndex(withdrawal entity.Withdrawal) func(entity.Withdrawal) bool {
+	return func(other entity.Withdrawal) bool { return other.Index == withdrawal.Index }
 }
 
 // MockEthereumClient is our test implementation of the EthereumClient interface
@@ -58,12 +380,37 @@ type MockEthereumClient struct {
 	blockNumber    string
 	blockResponses map[string]string
 	shouldFail     bool
+	// batchFailures lists block numbers whose batch entries report an error
+	batchFailures map[string]bool
+	batchCalls    int
+	// onCall, when set, is invoked before every call is answered
+	onCall func(method string, params []interface{})
+	mutex  sync.Mutex
+	// receiptResponses overrides receipts, keyed by block number for
+	// eth_getBlockReceipts and by hash for eth_getTransactionReceipt. Blocks
+	// without an entry get a successful receipt for every transaction.
+	receiptResponses map[string]string
+	// blockReceiptsUnsupported rejects eth_getBlockReceipts as unknown
+	blockReceiptsUnsupported bool
+	// blockReceiptsError, when set, fails eth_getBlockReceipts with this message
+	blockReceiptsError string
+	// logResponses answers eth_getLogs by block hash; other blocks have no logs
+	logResponses map[string]string
+	// traceResponses answers tracing calls, keyed by method and block number
+	// as "method:0x11"; methods without an entry are rejected as unknown
+	traceResponses map[string]string
+	// traceErrors fails tracing calls with the given message, keyed like
+	// traceResponses
+	traceErrors map[string]string
 }
 
-func (m *MockEthereumClient) MakeRPCCall(method string, params []interface{}) (*ethereum.JSONRPCResponse, error) {
+func (m *MockEthereumClient) MakeRPCCall(ctx context.Context, method string, params []interface{}) (*ethereum.JSONRPCResponse, error) {
 	if m.shouldFail {
 		return nil, fmt.Errorf("mock error")
 	}
+	if m.onCall != nil {
+		m.onCall(method, params)
+	}
 
 	if method == "eth_blockNumber" {
 		return &ethereum.JSONRPCResponse{
@@ -85,10 +432,148 @@ func (m *MockEthereumClient) MakeRPCCall(method string, params []interface{}) (*
 		}
 	}
 
+	if method == "eth_getBlockReceipts" {
+		if m.blockReceiptsUnsupported {
+			return nil, &ethereum.JSONRPCError{Code: ethereum.ErrCodeMethodNotFound, Message: "the method eth_getBlockReceipts does not exist/is not available"}
+		}
+		if m.blockReceiptsError != "" {
+			return nil, &ethereum.JSONRPCError{Code: -32000, Message: m.blockReceiptsError}
+		}
+		blockNum := params[0].(string)
+		if response, ok := m.receiptResponses[blockNum]; ok {
+			var result []interface{}
+			if err := json.Unmarshal([]byte(response), &result); err != nil {
+				return nil, fmt.Errorf("error parsing mock response: %v", err)
+			}
+			return &ethereum.JSONRPCResponse{Result: result}, nil
+		}
+		return m.defaultReceipts(blockNum)
+	}
+
+	if method == "eth_getLogs" {
+		filter := params[0].(map[string]interface{})
+		result := []interface{}{}
+		if response, ok := m.logResponses[filter["blockHash"].(string)]; ok {
+			var logs []map[string]interface{}
+			if err := json.Unmarshal([]byte(response), &logs); err != nil {
+				return nil, fmt.Errorf("error parsing mock response: %v", err)
+			}
+			for _, log := range logs {
+				if matchesTopics(log, filter["topics"].([]interface{})) {
+					result = append(result, log)
+				}
+			}
+		}
+		return &ethereum.JSONRPCResponse{Result: result}, nil
+	}
+
+	if method == "eth_getTransactionReceipt" {
+		if response, ok := m.receiptResponses[params[0].(string)]; ok {
+			var result map[string]interface{}
+			if err := json.Unmarshal([]byte(response), &result); err != nil {
+				return nil, fmt.Errorf("error parsing mock response: %v", err)
+			}
+			return &ethereum.JSONRPCResponse{Result: result}, nil
+		}
+	}
+
+	if method == "debug_traceBlockByNumber" || method == "trace_block" {
+		if message, ok := m.traceErrors[method+":"+params[0].(string)]; ok {
+			return nil, &ethereum.JSONRPCError{Code: -32000, Message: message}
+		}
+		response, ok := m.traceResponses[method+":"+params[0].(string)]
+		if !ok {
+			return nil, &ethereum.JSONRPCError{Code: ethereum.ErrCodeMethodNotFound, Message: "the method " + method + " does not exist/is not available"}
+		}
+		var result []interface{}
+		if err := json.Unmarshal([]byte(response), &result); err != nil {
+			return nil, fmt.Errorf("error parsing mock response: %v", err)
+		}
+		return &ethereum.JSONRPCResponse{Result: result}, nil
+	}
+
 	return nil, fmt.Errorf("unexpected method: %s", method)
 }
 
+// matchesTopics applies an eth_getLogs topic filter the way nodes do: each
+// position is a wildcard, one topic, or a list of alternatives.
+func matchesTopics(log map[string]interface{}, filter []interface{}) bool {
+	topics, _ := log["topics"].([]interface{})
+	for i, want := range filter {
+		if want == nil {
+			continue
+		}
+		if i >= len(topics) {
+			return false
+		}
+		topic, _ := topics[i].(string)
+		switch want := want.(type) {
+		case string:
+			if !strings.EqualFold(topic, want) {
+				return false
+			}
+		case []string:
+			found := false
+			for _, alternative := range want {
+				found = found || strings.EqualFold(topic, alternative)
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// defaultReceipts answers eth_getBlockReceipts with a successful receipt for
+// every transaction in the mocked block.
+func (m *MockEthereumClient) defaultReceipts(blockNum string) (*ethereum.JSONRPCResponse, error) {
+	var block Block
+	if err := json.Unmarshal([]byte(m.blockResponses[blockNum]), &block); err != nil {
+		return nil, fmt.Errorf("error parsing mock response: %v", err)
+	}
+	receipts := []interface{}{}
+	for _, tx := range block.Transactions {
+		receipts = append(receipts, map[string]interface{}{
+			"transactionHash": tx.Hash,
+			"blockHash":       block.Hash,
+			"status":          "0x1",
+			"logs":            []interface{}{},
+		})
+	}
+	return &ethereum.JSONRPCResponse{Result: receipts}, nil
+}
+
+func (m *MockEthereumClient) BatchRPCCall(ctx context.Context, requests []ethereum.JSONRPCRequest) ([]*ethereum.JSONRPCResponse, error) {
+	if m.shouldFail {
+		return nil, fmt.Errorf("mock error")
+	}
+
+	m.mutex.Lock()
+	m.batchCalls++
+	m.mutex.Unlock()
+	responses := make([]*ethereum.JSONRPCResponse, len(requests))
+	for i, request := range requests {
+		if blockNum, ok := request.Params[0].(string); ok && m.batchFailures[blockNum] {
+			responses[i] = &ethereum.JSONRPCResponse{
+				Error: &ethereum.JSONRPCError{Code: -32005, Message: "limit exceeded"},
+			}
+			continue
+		}
+
+		response, err := m.MakeRPCCall(ctx, request.Method, request.Params)
+		if err != nil {
+			response = &ethereum.JSONRPCResponse{
+				Error: &ethereum.JSONRPCError{Code: -32000, Message: err.Error()},
+			}
+		}
+		responses[i] = response
+	}
+	return responses, nil
+}
+
 func TestService_Subscribe(t *testing.T) {
+	ctx := context.Background()
 	tests := []struct {
 		name    string
 		address string
@@ -117,14 +602,17 @@ func TestService_Subscribe(t *testing.T) {
 			client := &MockEthereumClient{}
 			service := NewService(store, client)
 
-			got := service.Subscribe(tt.address)
+			got, err := service.Subscribe(ctx, tt.address)
+			if err != nil {
+				t.Fatalf("Service.Subscribe() error = %v", err)
+			}
 			if got != tt.want {
 				t.Errorf("Service.Subscribe() = %v, want %v", got, tt.want)
 			}
 
 			// If subscription should succeed, verify address is stored
 			if tt.want {
-				if !store.IsSubscribed(tt.address) {
+				if !store.subscribers[tt.address] {
 					t.Errorf("Address was not stored in subscribers")
 				}
 			}
@@ -133,6 +621,7 @@ func TestService_Subscribe(t *testing.T) {
 }
 
 func TestService_ParseBlocks(t *testing.T) {
+	ctx := context.Background()
 	// Create a mock block response
 	blockJSON := `{
         "transactions": [
@@ -191,10 +680,10 @@ func TestService_ParseBlocks(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			store := NewMockStore()
-			store.SetCurrentBlock(tt.currentBlock)
+			store.SetCurrentBlock(ctx, tt.currentBlock)
 
 			if tt.subscribed != "" {
-				store.Subscribe(tt.subscribed)
+				store.Subscribe(ctx, tt.subscribed)
 			}
 
 			client := &MockEthereumClient{
@@ -204,7 +693,7 @@ func TestService_ParseBlocks(t *testing.T) {
 			}
 
 			service := NewService(store, client)
-			err := service.ParseBlocks()
+			err := service.ParseBlocks(ctx)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Service.ParseBlocks() error = %v, wantErr %v", err, tt.wantErr)
@@ -212,7 +701,7 @@ func TestService_ParseBlocks(t *testing.T) {
 			}
 
 			if tt.subscribed != "" {
-				txs := store.GetTransactions(tt.subscribed)
+				txs := store.transactions[tt.subscribed]
 				if len(txs) != tt.wantTxCount {
 					t.Errorf("Got %d transactions, want %d", len(txs), tt.wantTxCount)
 				}
@@ -221,44 +710,1728 @@ func TestService_ParseBlocks(t *testing.T) {
 	}
 }
 
-func TestService_GetTransactions(t *testing.T) {
+func TestService_ParseBlocks_Reorg(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"
+	blockJSON := func(hash, parent, txHash string) string {
+		return fmt.Sprintf(`{
+			"hash": %q,
+			"parentHash": %q,
+			"transactions": [{"hash": %q, "from": %q, "to": "0x0", "value": "0x1"}]
+		}`, hash, parent, txHash, address)
+	}
+
 	store := NewMockStore()
-	client := &MockEthereumClient{}
+	store.Subscribe(ctx, address)
+	store.SetCurrentBlock(ctx, 0x9)
+	store.SaveBlockHeader(ctx, entity.BlockHeader{Number: 0x9, Hash: "0xa9"})
+
+	// First pass: blocks 10 and 11 on the original branch
+	client := &MockEthereumClient{
+		blockNumber: "0xb",
+		blockResponses: map[string]string{
+			"0xa": blockJSON("0xaa", "0xa9", "0xorphan10"),
+			"0xb": blockJSON("0xab", "0xaa", "0xorphan11"),
+		},
+	}
 	service := NewService(store, client)
+	if err := service.ParseBlocks(ctx); err != nil {
+		t.Fatalf("ParseBlocks() error = %v", err)
+	}
+	if got := len(store.transactions[address]); got != 2 {
+		t.Fatalf("Got %d transactions before reorg, want 2", got)
+	}
 
+	// Second pass: blocks 10 and 11 were replaced, 12 builds on the new branch
+	client.blockNumber = "0xc"
+	client.blockResponses = map[string]string{
+		"0xa": blockJSON("0xba", "0xa9", "0xcanonical10"),
+		"0xb": blockJSON("0xbb", "0xba", "0xcanonical11"),
+		"0xc": blockJSON("0xbc", "0xbb", "0xcanonical12"),
+		"0x9": `{"hash": "0xa9", "transactions": []}`,
+	}
+	if err := service.ParseBlocks(ctx); err != nil {
+		t.Fatalf("ParseBlocks() error = %v", err)
+	}
+
+	txs := store.transactions[address]
+	want := []string{"0xcanonical10", "0xcanonical11", "0xcanonical12"}
+	if len(txs) != len(want) {
+		t.Fatalf("Got %d transactions after reorg, want %d", len(txs), len(want))
+	}
+	for i, tx := range txs {
+		if tx.Hash != want[i] {
+			t.Errorf("Transaction %d hash = %s, want %s", i, tx.Hash, want[i])
+		}
+	}
+	if store.currentBlock != 0xc {
+		t.Errorf("Current block = %d, want %d", store.currentBlock, 0xc)
+	}
+}
+
+func TestService_ParseBlocks_Batches(t *testing.T) {
+	ctx := context.Background()
 	address := "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"
-	store.Subscribe(address)
+	blockJSON := func(txHash string) string {
+		return fmt.Sprintf(`{"transactions": [{"hash": %q, "from": %q, "to": "0x0", "value": "0x1"}]}`,
+			txHash, address)
+	}
 
-	// Add some test transactions
-	testTx := entity.Transaction{
-		Hash:        "0x123",
-		From:        address,
-		To:          "0x456",
-		Value:       "0x2386f26fc10000",
-		BlockNumber: 123,
+	tests := []struct {
+		name          string
+		blocks        map[string]string
+		batchFailures map[string]bool
+		wantErr       bool
+		wantCurrent   int
+		wantTxCount   int
+	}{
+		{
+			name: "all blocks fetched in batches",
+			blocks: map[string]string{
+				"0x11": blockJSON("0x11"), "0x12": blockJSON("0x12"), "0x13": blockJSON("0x13"),
+				"0x14": blockJSON("0x14"), "0x15": blockJSON("0x15"),
+			},
+			wantCurrent: 0x15,
+			wantTxCount: 5,
+		},
+		{
+			name: "failed batch entry is retried individually",
+			blocks: map[string]string{
+				"0x11": blockJSON("0x11"), "0x12": blockJSON("0x12"), "0x13": blockJSON("0x13"),
+				"0x14": blockJSON("0x14"), "0x15": blockJSON("0x15"),
+			},
+			batchFailures: map[string]bool{"0x12": true},
+			wantCurrent:   0x15,
+			wantTxCount:   5,
+		},
+		{
+			name: "missing block stops processing before it",
+			blocks: map[string]string{
+				"0x11": blockJSON("0x11"), "0x12": blockJSON("0x12"),
+				"0x14": blockJSON("0x14"), "0x15": blockJSON("0x15"),
+			},
+			wantErr:     true,
+			wantCurrent: 0x12,
+			wantTxCount: 2,
+		},
 	}
-	store.AddTransaction(testTx)
 
-	// Test getting transactions
-	txs := service.GetTransactions(address)
-	if len(txs) != 1 {
-		t.Errorf("GetTransactions() returned %d transactions, want 1", len(txs))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMockStore()
+			store.Subscribe(ctx, address)
+			store.SetCurrentBlock(ctx, 0x10)
+
+			client := &MockEthereumClient{
+				blockNumber:    "0x15",
+				blockResponses: tt.blocks,
+				batchFailures:  tt.batchFailures,
+			}
+			service := NewService(store, client, WithBatchSize(2))
+
+			err := service.ParseBlocks(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBlocks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if store.currentBlock != tt.wantCurrent {
+				t.Errorf("Current block = %d, want %d", store.currentBlock, tt.wantCurrent)
+			}
+			if got := len(store.transactions[address]); got != tt.wantTxCount {
+				t.Errorf("Got %d transactions, want %d", got, tt.wantTxCount)
+			}
+			if client.batchCalls == 0 {
+				t.Errorf("Expected blocks to be fetched with batch calls")
+			}
+		})
 	}
+}
 
-	if txs[0].Hash != testTx.Hash {
-		t.Errorf("Transaction hash = %s, want %s", txs[0].Hash, testTx.Hash)
+func TestService_ParseBlocks_Pipeline(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"
+
+	blocks := map[string]string{}
+	for blockNum := 0x11; blockNum <= 0x20; blockNum++ {
+		blocks[fmt.Sprintf("0x%x", blockNum)] = fmt.Sprintf(
+			`{"transactions": [{"hash": "0x%x", "from": %q, "to": "0x0", "value": "0x1"}]}`, blockNum, address)
+	}
+
+	tests := []struct {
+		name        string
+		missing     string
+		wantErr     bool
+		wantCurrent int
+	}{
+		{name: "commits in order despite out-of-order fetches", wantCurrent: 0x20},
+		{name: "failed block stops later commits", missing: "0x15", wantErr: true, wantCurrent: 0x14},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMockStore()
+			store.Subscribe(ctx, address)
+			store.SetCurrentBlock(ctx, 0x10)
+			store.committed = nil
+
+			responses := map[string]string{}
+			for number, block := range blocks {
+				if number != tt.missing {
+					responses[number] = block
+				}
+			}
+			client := &MockEthereumClient{
+				blockNumber:    "0x20",
+				blockResponses: responses,
+				onCall: func(method string, params []interface{}) {
+					// Slow down the earliest blocks so later batches finish first
+					if method == "eth_getBlockByNumber" && (params[0] == "0x11" || params[0] == "0x15") {
+						time.Sleep(20 * time.Millisecond)
+					}
+				},
+			}
+			service := NewService(store, client, WithBatchSize(2), WithWorkers(4))
+
+			err := service.ParseBlocks(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBlocks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if store.currentBlock != tt.wantCurrent {
+				t.Errorf("Current block = %d, want %d", store.currentBlock, tt.wantCurrent)
+			}
+			for i, block := range store.committed {
+				if block != 0x11+i {
+					t.Fatalf("Commit order = %v, want contiguous blocks from 0x11", store.committed)
+				}
+			}
+			for _, tx := range store.transactions[address] {
+				if tx.BlockNumber > tt.wantCurrent {
+					t.Errorf("Transaction from block %d committed past the failed block", tx.BlockNumber)
+				}
+			}
+		})
 	}
 }
 
-func TestService_GetCurrentBlock(t *testing.T) {
-	store := NewMockStore()
-	client := &MockEthereumClient{}
-	service := NewService(store, client)
+func TestService_ParseBlocks_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	expectedBlock := 12345
-	store.SetCurrentBlock(expectedBlock)
+	address := "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"
+	blockJSON := fmt.Sprintf(`{"transactions": [{"hash": "0x1", "from": %q, "to": "0x0", "value": "0x1"}]}`, address)
 
-	if got := service.GetCurrentBlock(); got != expectedBlock {
-		t.Errorf("GetCurrentBlock() = %v, want %v", got, expectedBlock)
+	store := NewMockStore()
+	store.Subscribe(ctx, address)
+	store.SetCurrentBlock(ctx, 0x10)
+
+	client := &MockEthereumClient{
+		blockNumber: "0x14",
+		blockResponses: map[string]string{
+			"0x11": blockJSON, "0x12": blockJSON, "0x13": blockJSON, "0x14": blockJSON,
+		},
+	}
+	// Shut down right after the first block has been committed
+	store.onCommit = func(block int) {
+		if block == 0x11 {
+			cancel()
+		}
+	}
+	service := NewService(store, client, WithBatchSize(1))
+
+	err := service.ParseBlocks(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ParseBlocks() error = %v, want context.Canceled", err)
+	}
+	if store.currentBlock != 0x11 {
+		t.Errorf("Current block = %d, want %d", store.currentBlock, 0x11)
+	}
+	if got := len(store.transactions[address]); got != 1 {
+		t.Errorf("Got %d transactions, want 1", got)
+	}
+}
+
+func TestService_GetTransactions(t *testing.T) {
+	ctx := context.Background()
+	store := NewMockStore()
+	client := &MockEthereumClient{}
+	service := NewService(store, client)
+
+	address := "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"
+	store.Subscribe(ctx, address)
+
+	// Add some test transactions
+	testTx := entity.Transaction{
+		Hash:        "0x123",
+		From:        address,
+		To:          "0x456",
+		Value:       big.NewInt(10000000000000000),
+		BlockNumber: 123,
+	}
+	store.AddTransaction(ctx, testTx)
+
+	// Test getting transactions
+	txs, err := service.GetTransactions(ctx, address, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+	if len(txs) != 1 {
+		t.Errorf("GetTransactions() returned %d transactions, want 1", len(txs))
+	}
+
+	if txs[0].Hash != testTx.Hash {
+		t.Errorf("Transaction hash = %s, want %s", txs[0].Hash, testTx.Hash)
+	}
+}
+
+func TestService_GetTransactions_Status(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"
+	store := NewMockStore()
+	store.Subscribe(ctx, address)
+	store.SetCurrentBlock(ctx, 100)
+	for _, blockNum := range []int{80, 90, 95, 100} {
+		store.AddTransaction(ctx, entity.Transaction{
+			Hash:        fmt.Sprintf("0x%x", blockNum),
+			From:        address,
+			BlockNumber: blockNum,
+		})
+	}
+
+	client := &MockEthereumClient{
+		blockNumber: "0x64",
+		blockResponses: map[string]string{
+			"safe":      `{"number": "0x5a"}`,
+			"finalized": `{"number": "0x50"}`,
+		},
+	}
+	service := NewService(store, client, WithConfirmationDepth(6))
+	if err := service.ParseBlocks(ctx); err != nil {
+		t.Fatalf("ParseBlocks() error = %v", err)
+	}
+
+	want := map[string]entity.TransactionStatus{
+		"0x50": entity.StatusFinalized,
+		"0x5a": entity.StatusSafe,
+		"0x5f": entity.StatusConfirmed,
+		"0x64": entity.StatusUnconfirmed,
+	}
+	all, err := service.GetTransactions(ctx, address, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+	for _, tx := range all {
+		if tx.Status != want[tx.Hash] {
+			t.Errorf("Transaction %s status = %s, want %s", tx.Hash, tx.Status, want[tx.Hash])
+		}
+	}
+
+	finalized, _ := service.GetTransactions(ctx, address, entity.TransactionFilter{MinStatus: entity.StatusFinalized})
+	if len(finalized) != 1 || finalized[0].Hash != "0x50" {
+		t.Errorf("Finalized filter returned %v, want only 0x50", finalized)
+	}
+
+	confirmed, _ := service.GetTransactions(ctx, address, entity.TransactionFilter{MinStatus: entity.StatusConfirmed})
+	if len(confirmed) != 3 {
+		t.Errorf("Confirmed filter returned %d transactions, want 3", len(confirmed))
+	}
+}
+
+func TestService_GetCurrentBlock(t *testing.T) {
+	ctx := context.Background()
+	store := NewMockStore()
+	client := &MockEthereumClient{}
+	service := NewService(store, client)
+
+	expectedBlock := 12345
+	store.SetCurrentBlock(ctx, expectedBlock)
+
+	if got, _ := service.GetCurrentBlock(ctx); got != expectedBlock {
+		t.Errorf("GetCurrentBlock() = %v, want %v", got, expectedBlock)
+	}
+}
+
+// MockHeadSubscriber hands out a fixed head channel or subscription error.
+type MockHeadSubscriber struct {
+	heads chan entity.BlockHeader
+	err   error
+	calls int32
+}
+
+func (m *MockHeadSubscriber) SubscribeNewHeads(ctx context.Context) (<-chan entity.BlockHeader, error) {
+	atomic.AddInt32(&m.calls, 1)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.heads, nil
+}
+
+// parseRuns reports every ParseBlocks run through its eth_blockNumber call.
+func parseRuns(client *MockEthereumClient) <-chan struct{} {
+	runs := make(chan struct{}, 100)
+	client.onCall = func(method string, params []interface{}) {
+		if method == "eth_blockNumber" {
+			runs <- struct{}{}
+		}
+	}
+	return runs
+}
+
+func awaitRun(t *testing.T, runs <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-runs:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for %s", what)
+	}
+}
+
+func TestService_Watch_NewHeads(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := NewMockStore()
+	store.SetCurrentBlock(ctx, 0x10)
+	client := &MockEthereumClient{blockNumber: "0x10"}
+	runs := parseRuns(client)
+	subscriber := &MockHeadSubscriber{heads: make(chan entity.BlockHeader, 1)}
+
+	service := NewService(store, client)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// A poll interval this long means only heads can trigger a parse
+		service.Watch(ctx, subscriber, time.Hour)
+	}()
+
+	awaitRun(t, runs, "initial parse")
+	subscriber.heads <- entity.BlockHeader{Number: 0x11}
+	awaitRun(t, runs, "parse after new head")
+
+	cancel()
+	<-done
+}
+
+func TestService_Watch_FallsBackToPolling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := NewMockStore()
+	store.SetCurrentBlock(ctx, 0x10)
+	client := &MockEthereumClient{blockNumber: "0x10"}
+	runs := parseRuns(client)
+	subscriber := &MockHeadSubscriber{err: fmt.Errorf("dial: %w", ethereum.ErrSubscriptionsUnsupported)}
+
+	service := NewService(store, client)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service.Watch(ctx, subscriber, 10*time.Millisecond)
+	}()
+
+	for i := 0; i < 3; i++ {
+		awaitRun(t, runs, "polled parse")
+	}
+	cancel()
+	<-done
+
+	if calls := atomic.LoadInt32(&subscriber.calls); calls != 1 {
+		t.Errorf("SubscribeNewHeads() called %d times, want 1 for an unsupported node", calls)
+	}
+}
+
+func TestService_Backfill(t *testing.T) {
+	ctx := context.Background()
+
+	address := "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	blockJSON := func(hash string) string {
+		return fmt.Sprintf(`{"transactions": [{"hash": %q, "from": %q, "to": "0x0", "value": "0x1"},
+			{"hash": "0xother%s", "from": "0x1", "to": "0x2", "value": "0x1"}]}`, hash, address, hash)
+	}
+
+	store := NewMockStore()
+	store.Subscribe(ctx, address)
+	store.SetCurrentBlock(ctx, 0x14)
+	// Live parsing already captured the transaction in block 0x14
+	store.transactions[address] = []entity.Transaction{{Hash: "0x14", From: address, BlockNumber: 0x14}}
+
+	client := &MockEthereumClient{
+		blockNumber: "0x20",
+		blockResponses: map[string]string{
+			"0x10": blockJSON("0x10"), "0x11": blockJSON("0x11"), "0x12": blockJSON("0x12"),
+			"0x13": blockJSON("0x13"), "0x14": blockJSON("0x14"),
+		},
+	}
+	service := NewService(store, client, WithBatchSize(2))
+
+	scheduled, err := service.ScheduleBackfill(ctx, address, 0x10, time.Time{})
+	if err != nil {
+		t.Fatalf("ScheduleBackfill() error = %v", err)
+	}
+	if scheduled.Status != entity.BackfillQueued {
+		t.Errorf("Scheduled job status = %s, want %s", scheduled.Status, entity.BackfillQueued)
+	}
+	service.runBackfill(ctx, <-service.backfills.queue)
+
+	job, ok := service.GetBackfill(ctx, scheduled.ID)
+	if !ok {
+		t.Fatalf("GetBackfill(%d) found no job", scheduled.ID)
+	}
+	if job.Status != entity.BackfillCompleted {
+		t.Fatalf("Job status = %s (%s), want %s", job.Status, job.Error, entity.BackfillCompleted)
+	}
+	if job.ToBlock != 0x14 || job.ProcessedBlock != 0x14 {
+		t.Errorf("Job range end = %d, processed = %d, want %d", job.ToBlock, job.ProcessedBlock, 0x14)
+	}
+	if job.Found != 5 || job.Added != 4 {
+		t.Errorf("Job found %d and added %d, want 5 and 4", job.Found, job.Added)
+	}
+	if got := len(store.transactions[address]); got != 5 {
+		t.Errorf("Got %d transactions, want 5 without duplicates", got)
+	}
+	if jobs := service.ListBackfills(ctx, "0x0000000000000000000000000000000000000000"); len(jobs) != 0 {
+		t.Errorf("ListBackfills() for another address = %d jobs, want 0", len(jobs))
+	}
+}
+
+func TestService_Backfill_Failed(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewMockStore()
+	store.SetCurrentBlock(ctx, 0x11)
+	client := &MockEthereumClient{blockNumber: "0x11", blockResponses: map[string]string{}}
+	service := NewService(store, client)
+
+	scheduled, _ := service.ScheduleBackfill(ctx, "0x742d35cc6634c0532925a3b844bc454e4438f44e", 0x10, time.Time{})
+	service.runBackfill(ctx, <-service.backfills.queue)
+
+	job, _ := service.GetBackfill(ctx, scheduled.ID)
+	if job.Status != entity.BackfillFailed || job.Error == "" {
+		t.Errorf("Job status = %s with error %q, want failed with an error", job.Status, job.Error)
+	}
+}
+
+func TestService_BlockAtTime(t *testing.T) {
+	ctx := context.Background()
+
+	client := &MockEthereumClient{
+		blockNumber: "0x4",
+		blockResponses: map[string]string{
+			"0x0": `{"timestamp": "0x64"}`, "0x1": `{"timestamp": "0x70"}`, "0x2": `{"timestamp": "0x7c"}`,
+			"0x3": `{"timestamp": "0x88"}`, "0x4": `{"timestamp": "0x94"}`,
+		},
+	}
+	service := NewService(NewMockStore(), client)
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		want      int
+	}{
+		{"before genesis", 0, 0},
+		{"exact block time", 0x7c, 2},
+		{"between blocks", 0x7d, 3},
+		{"after head", 0x100, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.blockAtTime(ctx, time.Unix(tt.timestamp, 0))
+			if err != nil {
+				t.Fatalf("blockAtTime() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("blockAtTime() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_BlockAtTime_Nearest(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewMockStore()
+	// Recent headers come from the store; the node does not know block 0x4
+	store.SaveBlockHeader(ctx, entity.BlockHeader{Number: 4, Hash: "0xstored", Timestamp: 0x94})
+	client := &MockEthereumClient{
+		blockNumber: "0x4",
+		blockResponses: map[string]string{
+			"0x0": `{"timestamp": "0x64"}`, "0x1": `{"timestamp": "0x70"}`, "0x2": `{"timestamp": "0x7c"}`,
+			"0x3": `{"hash": "0x3", "timestamp": "0x88"}`,
+		},
+	}
+	service := NewService(store, client)
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		want      int
+	}{
+		{"before genesis", 0, 0},
+		{"exact block time", 0x7c, 2},
+		{"closer to the earlier block", 0x7d, 2},
+		{"closer to the later block", 0x86, 3},
+		{"tie prefers the earlier block", 0x8e, 3},
+		{"stored header", 0x93, 4},
+		{"after head", 0x100, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.BlockAtTime(ctx, time.Unix(tt.timestamp, 0))
+			if err != nil {
+				t.Fatalf("BlockAtTime() error = %v", err)
+			}
+			if got.Number != tt.want {
+				t.Errorf("BlockAtTime() = %d, want %d", got.Number, tt.want)
+			}
+		})
+	}
+
+	header, _ := service.BlockAtTime(ctx, time.Unix(0x88, 0))
+	if header.Hash != "0x3" || header.Timestamp != 0x88 {
+		t.Errorf("BlockAtTime() header = %+v, want hash 0x3 at 0x88", header)
+	}
+}
+
+func TestService_GetTransactions_Range(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"
+	store := NewMockStore()
+	store.Subscribe(ctx, address)
+	for i, blockNum := range []int{100, 110, 120, 130} {
+		store.AddTransaction(ctx, entity.Transaction{
+			Hash:           fmt.Sprintf("0x%x", blockNum),
+			From:           address,
+			BlockNumber:    blockNum,
+			BlockTimestamp: 1704067200 + int64(i)*3600,
+		})
+	}
+	service := NewService(store, &MockEthereumClient{})
+
+	tests := []struct {
+		name   string
+		filter entity.TransactionFilter
+		want   []string
+	}{
+		{"block range", entity.TransactionFilter{FromBlock: 110, ToBlock: 120}, []string{"0x6e", "0x78"}},
+		{"from block", entity.TransactionFilter{FromBlock: 111}, []string{"0x78", "0x82"}},
+		{"time range", entity.TransactionFilter{
+			FromTime: time.Unix(1704067200, 0),
+			ToTime:   time.Unix(1704067200+3600, 0),
+		}, []string{"0x64", "0x6e"}},
+		{"to time", entity.TransactionFilter{ToTime: time.Unix(1704067200+3599, 0)}, []string{"0x64"}},
+		{"block and time", entity.TransactionFilter{FromBlock: 110, FromTime: time.Unix(1704067200+7200, 0)}, []string{"0x78", "0x82"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txs, err := service.GetTransactions(ctx, address, tt.filter)
+			if err != nil {
+				t.Fatalf("GetTransactions() error = %v", err)
+			}
+			var got []string
+			for _, tx := range txs {
+				got = append(got, tx.Hash)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetTransactions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// MockCheckpoint keeps the checkpoint in memory.
+type MockCheckpoint struct {
+	header entity.BlockHeader
+	saved  bool
+}
+
+func (m *MockCheckpoint) Load(ctx context.Context) (entity.BlockHeader, bool, error) {
+	return m.header, m.saved, nil
+}
+
+func (m *MockCheckpoint) Save(ctx context.Context, header entity.BlockHeader) error {
+	m.header = header
+	m.saved = true
+	return nil
+}
+
+func TestParseStartPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    StartPolicy
+		wantErr bool
+	}{
+		{"", StartPolicy{Mode: StartCheckpoint}, false},
+		{"checkpoint", StartPolicy{Mode: StartCheckpoint}, false},
+		{"latest", StartPolicy{Mode: StartLatest}, false},
+		{"latest-100", StartPolicy{Mode: StartLatest, Offset: 100}, false},
+		{"18934567", StartPolicy{Mode: StartBlock, Block: 18934567}, false},
+		{"latest-x", StartPolicy{}, true},
+		{"-5", StartPolicy{}, true},
+		{"earliest", StartPolicy{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseStartPolicy(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseStartPolicy(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseStartPolicy(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_ParseBlocks_StartPolicy(t *testing.T) {
+	blocks := map[string]string{}
+	for n := 0x10; n <= 0x20; n++ {
+		blocks[fmt.Sprintf("0x%x", n)] = fmt.Sprintf(`{"hash": "0xh%x", "parentHash": "0xh%x", "transactions": []}`, n, n-1)
+	}
+
+	tests := []struct {
+		name       string
+		policy     StartPolicy
+		checkpoint *MockCheckpoint
+		stored     int
+		wantFirst  int
+	}{
+		{
+			name:       "resumes after checkpoint",
+			policy:     StartPolicy{Mode: StartCheckpoint},
+			checkpoint: &MockCheckpoint{header: entity.BlockHeader{Number: 0x14, Hash: "0xh14"}, saved: true},
+			wantFirst:  0x15,
+		},
+		{
+			name:       "falls back to store cursor",
+			policy:     StartPolicy{Mode: StartCheckpoint},
+			checkpoint: &MockCheckpoint{},
+			stored:     0x18,
+			wantFirst:  0x19,
+		},
+		{
+			name:      "falls back behind the head",
+			policy:    StartPolicy{Mode: StartCheckpoint},
+			wantFirst: 0x20 - defaultStartOffset + 1,
+		},
+		{
+			name:       "latest-N ignores checkpoint",
+			policy:     StartPolicy{Mode: StartLatest, Offset: 2},
+			checkpoint: &MockCheckpoint{header: entity.BlockHeader{Number: 0x14}, saved: true},
+			wantFirst:  0x1e,
+		},
+		{
+			name:      "explicit block",
+			policy:    StartPolicy{Mode: StartBlock, Block: 0x12},
+			stored:    0x18,
+			wantFirst: 0x12,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMockStore()
+			store.currentBlock = tt.stored
+			client := &MockEthereumClient{blockNumber: "0x20", blockResponses: blocks}
+
+			opts := []Option{WithStartPolicy(tt.policy), WithMaxResumeGap(5)}
+			if tt.checkpoint != nil {
+				opts = append(opts, WithCheckpoint(tt.checkpoint))
+			}
+			service := NewService(store, client, opts...)
+
+			if err := service.ParseBlocks(ctx); err != nil {
+				t.Fatalf("ParseBlocks() error = %v", err)
+			}
+
+			// Apart from positioning the cursor once, only the expected range is committed
+			want := 0x20 - tt.wantFirst + 1
+			processed := store.committed
+			if len(processed) == want+1 && processed[0] == tt.wantFirst-1 {
+				processed = processed[1:]
+			}
+			if len(processed) != want || processed[0] != tt.wantFirst || processed[want-1] != 0x20 {
+				t.Errorf("Committed %v, want blocks %d to %d", store.committed, tt.wantFirst, 0x20)
+			}
+			if tt.checkpoint != nil && tt.checkpoint.header.Number != 0x20 {
+				t.Errorf("Checkpoint = %d, want %d", tt.checkpoint.header.Number, 0x20)
+			}
+		})
+	}
+}
+
+func TestService_ParseBlocks_TransactionFields(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"
+	blockJSON := fmt.Sprintf(`{
+        "hash": "0xblock", "parentHash": "0xparent", "timestamp": "0x65920080",
+        "transactions": [
+            {
+                "hash": "0x1", "from": %[1]q, "to": "0x0", "value": "0x2386f26fc10000",
+                "nonce": "0x2a", "gas": "0x5208", "gasPrice": "0x3b9aca00",
+                "maxFeePerGas": "0x77359400", "maxPriorityFeePerGas": "0x3b9aca00",
+                "input": "0x", "type": "0x2", "chainId": "0x1", "transactionIndex": "0x7"
+            },
+            {
+                "hash": "0x2", "from": %[1]q, "to": "0x0", "value": "0x0",
+                "nonce": "0x2b", "gas": "0x30d40", "gasPrice": "0x4a817c800",
+                "input": "0xa9059cbb", "type": "0x0", "transactionIndex": "0x8"
+            }
+        ]
+    }`, address)
+
+	store := NewMockStore()
+	store.Subscribe(ctx, address)
+	store.SetCurrentBlock(ctx, 0x10)
+	client := &MockEthereumClient{blockNumber: "0x11", blockResponses: map[string]string{"0x11": blockJSON}}
+
+	if err := NewService(store, client).ParseBlocks(ctx); err != nil {
+		t.Fatalf("ParseBlocks() error = %v", err)
+	}
+
+	got := store.transactions[address]
+	want := []entity.Transaction{
+		{
+			Hash: "0x1", From: address, To: "0x0", Value: big.NewInt(10000000000000000), BlockNumber: 0x11,
+			Nonce: 42, Gas: 21000, GasPrice: "0x3b9aca00", MaxFeePerGas: "0x77359400",
+			MaxPriorityFeePerGas: "0x3b9aca00", Input: "0x", Type: 2, ChainID: 1,
+			TransactionIndex: 7, BlockHash: "0xblock", BlockTimestamp: 1704067200,
+		},
+		{
+			Hash: "0x2", From: address, To: "0x0", Value: new(big.Int), BlockNumber: 0x11,
+			Nonce: 43, Gas: 200000, GasPrice: "0x4a817c800", Input: "0xa9059cbb",
+			TransactionIndex: 8, BlockHash: "0xblock", BlockTimestamp: 1704067200,
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Got %d transactions, want %d", len(got), len(want))
+	}
+	for i := range want {
+		// Receipts are covered by TestService_ParseBlocks_Receipts
+		got[i].Receipt = nil
+		if got[i].Value == nil || got[i].Value.Cmp(want[i].Value) != 0 {
+			t.Errorf("Transaction %d value = %v, want %v", i, got[i].Value, want[i].Value)
+		}
+		got[i].Value, want[i].Value = nil, nil
+		if got[i] != want[i] {
+			t.Errorf("Transaction %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestService_ParseBlocks_Receipts(t *testing.T) {
+	address := "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"
+	blockJSON := fmt.Sprintf(`{"hash": "0xblock", "transactions": [
+            {"hash": "0x1", "from": %[1]q, "to": "0x0", "value": "0x1"},
+            {"hash": "0x2", "from": %[1]q, "to": null, "value": "0x0"}
+        ]}`, address)
+	succeeded := `{"transactionHash": "0x1", "blockHash": "0xblock", "status": "0x1", "gasUsed": "0x5208",
+            "effectiveGasPrice": "0x3b9aca00", "cumulativeGasUsed": "0x5208", "contractAddress": null,
+            "logs": [{"address": "0xtoken", "topics": ["0xddf2", "0xaa"], "data": "0x01", "logIndex": "0x3"}]}`
+	reverted := `{"transactionHash": "0x2", "blockHash": "0xblock", "status": "0x0", "gasUsed": "0x7530",
+            "effectiveGasPrice": "0x3b9aca00", "cumulativeGasUsed": "0xc350", "contractAddress": "0xcreated", "logs": []}`
+
+	tests := []struct {
+		name          string
+		unsupported   bool
+		receiptsError string
+		receipts      map[string]string
+		wantErr       bool
+	}{
+		{
+			name:     "block receipts",
+			receipts: map[string]string{"0x11": "[" + succeeded + "," + reverted + "]"},
+		},
+		{
+			name:        "falls back to transaction receipts",
+			unsupported: true,
+			receipts:    map[string]string{"0x1": succeeded, "0x2": reverted},
+		},
+		{
+			// Pruned state is retried, not taken as the method missing
+			name:          "historical state not available",
+			receiptsError: "historical state not available in path scheme yet",
+			receipts:      map[string]string{"0x1": succeeded, "0x2": reverted},
+			wantErr:       true,
+		},
+		{
+			name:     "receipts from a replaced block",
+			receipts: map[string]string{"0x11": "[" + strings.Replace(succeeded, "0xblock", "0xother", 1) + "," + reverted + "]"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMockStore()
+			store.Subscribe(ctx, address)
+			store.SetCurrentBlock(ctx, 0x10)
+			client := &MockEthereumClient{
+				blockNumber:              "0x11",
+				blockResponses:           map[string]string{"0x11": blockJSON},
+				receiptResponses:         tt.receipts,
+				blockReceiptsUnsupported: tt.unsupported,
+				blockReceiptsError:       tt.receiptsError,
+			}
+			service := NewService(store, client)
+
+			err := service.ParseBlocks(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBlocks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if store.currentBlock != 0x10 {
+					t.Errorf("Current block = %d, want block left uncommitted", store.currentBlock)
+				}
+				if service.fetch.blockReceiptsUnsupported.Load() {
+					t.Error("eth_getBlockReceipts given up after a retryable error")
+				}
+				return
+			}
+
+			transactions := store.transactions[address]
+			if len(transactions) != 2 || transactions[0].Receipt == nil || transactions[1].Receipt == nil {
+				t.Fatalf("Transactions = %+v, want two with receipts", transactions)
+			}
+			first, second := transactions[0].Receipt, transactions[1].Receipt
+			if first.Status != entity.ReceiptStatusSuccess || first.GasUsed != 21000 || first.EffectiveGasPrice != "0x3b9aca00" ||
+				len(first.Logs) != 1 || first.Logs[0].LogIndex != 3 || first.Logs[0].Topics[1] != "0xaa" {
+				t.Errorf("First receipt = %+v", first)
+			}
+			if second.Status != entity.ReceiptStatusFailed || second.CumulativeGasUsed != 50000 || second.ContractAddress != "0xcreated" {
+				t.Errorf("Second receipt = %+v", second)
+			}
+
+			all, _ := service.GetTransactions(ctx, address, entity.TransactionFilter{})
+			succeededOnly, _ := service.GetTransactions(ctx, address, entity.TransactionFilter{ExcludeReverted: true})
+			if len(all) != 2 || len(succeededOnly) != 1 || succeededOnly[0].Hash != "0x1" {
+				t.Errorf("GetTransactions() = %d, with reverted excluded = %+v", len(all), succeededOnly)
+			}
+		})
+	}
+}
+
+func TestService_ParseBlocks_TokenTransfers(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	topic := func(addr string) string {
+		return "0x000000000000000000000000" + strings.TrimPrefix(addr, "0x")
+	}
+	other := "0x1111111111111111111111111111111111111111"
+	amount := "0x00000000000000000000000000000000000000000000000000000000000f4240"
+	logsJSON := fmt.Sprintf(`[
+        {"address": "0xusdc", "topics": [%[1]q, %[2]q, %[3]q], "data": %[4]q, "logIndex": "0x1", "transactionHash": "0xa"},
+        {"address": "0xnft", "topics": [%[1]q, %[2]q, %[3]q, "0x01"], "data": "0x", "logIndex": "0x2", "transactionHash": "0xb"},
+        {"address": "0xusdc", "topics": [%[1]q, %[2]q, %[2]q], "data": %[4]q, "logIndex": "0x3", "transactionHash": "0xc"},
+        {"address": "0xusdc", "topics": [%[1]q, %[3]q, %[2]q], "data": %[4]q, "logIndex": "0x4", "transactionHash": "0xd", "removed": true},
+        {"address": "0xusdc", "topics": [%[1]q, %[3]q, %[3]q], "data": %[4]q, "logIndex": "0x5", "transactionHash": "0xe"}
+    ]`, transferTopic, topic(other), topic(address), amount)
+
+	store := NewMockStore()
+	store.Subscribe(ctx, address)
+	store.SetCurrentBlock(ctx, 0x10)
+	client := &MockEthereumClient{
+		blockNumber:    "0x11",
+		blockResponses: map[string]string{"0x11": `{"hash": "0xblock", "transactions": []}`},
+		logResponses:   map[string]string{"0xblock": logsJSON},
+	}
+	service := NewService(store, client)
+
+	if err := service.ParseBlocks(ctx); err != nil {
+		t.Fatalf("ParseBlocks() error = %v", err)
+	}
+
+	transfers, err := service.GetTokenTransfers(ctx, address)
+	if err != nil {
+		t.Fatalf("GetTokenTransfers() error = %v", err)
+	}
+	// The self-transfer matches both the sender and the recipient filter but
+	// is stored once
+	want := []entity.TokenTransfer{
+		{
+			Token: "0xusdc", From: other, To: address, Amount: "1000000",
+			TransactionHash: "0xa", LogIndex: 1, BlockNumber: 0x11, BlockHash: "0xblock",
+		},
+		{
+			Token: "0xusdc", From: address, To: address, Amount: "1000000",
+			TransactionHash: "0xe", LogIndex: 5, BlockNumber: 0x11, BlockHash: "0xblock",
+		},
+	}
+	if !reflect.DeepEqual(transfers, want) {
+		t.Errorf("GetTokenTransfers() = %+v, want %+v", transfers, want)
+	}
+}
+
+func TestService_ParseBlocks_LogFilters(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	padded := "0x000000000000000000000000742d35cc6634c0532925a3b844bc454e4438f44e"
+
+	var mutex sync.Mutex
+	var filters [][]interface{}
+	store := NewMockStore()
+	store.SetCurrentBlock(ctx, 0x10)
+	client := &MockEthereumClient{
+		blockNumber:    "0x11",
+		blockResponses: map[string]string{"0x11": `{"hash": "0xblock", "transactions": []}`},
+		onCall: func(method string, params []interface{}) {
+			if method == "eth_getLogs" {
+				mutex.Lock()
+				defer mutex.Unlock()
+				filters = append(filters, params[0].(map[string]interface{})["topics"].([]interface{}))
+			}
+		},
+	}
+	service := NewService(store, client)
+
+	if err := service.ParseBlocks(ctx); err != nil {
+		t.Fatalf("ParseBlocks() error = %v", err)
+	}
+	if len(filters) != 0 {
+		t.Fatalf("eth_getLogs called %d times without subscriptions, want none", len(filters))
+	}
+
+	store.Subscribe(ctx, address)
+	client.blockNumber = "0x12"
+	client.blockResponses["0x12"] = `{"hash": "0xblock2", "parentHash": "0xblock", "transactions": []}`
+	if err := service.ParseBlocks(ctx); err != nil {
+		t.Fatalf("ParseBlocks() error = %v", err)
+	}
+
+	addresses := []string{padded}
+	nftTopics := []string{transferSingleTopic, transferBatchTopic}
+	want := [][]interface{}{
+		{transferTopic, addresses},
+		{transferTopic, nil, addresses},
+		{nftTopics, nil, addresses},
+		{nftTopics, nil, nil, addresses},
+	}
+	if !reflect.DeepEqual(filters, want) {
+		t.Errorf("eth_getLogs topics = %v, want %v", filters, want)
+	}
+}
+
+func TestService_ParseBlocks_NFTTransfers(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	topic := func(addr string) string {
+		return "0x000000000000000000000000" + strings.TrimPrefix(addr, "0x")
+	}
+	word := func(n int) string {
+		return fmt.Sprintf("%064x", n)
+	}
+	other := "0x1111111111111111111111111111111111111111"
+	operator := "0x2222222222222222222222222222222222222222"
+	single := "0x" + word(7) + word(3)
+	// Two arrays: offsets 0x40 and 0xa0, then [2, 1, 2] and [2, 10, 20]
+	batch := "0x" + word(0x40) + word(0xa0) + word(2) + word(1) + word(2) + word(2) + word(10) + word(20)
+	mismatched := "0x" + word(0x40) + word(0xa0) + word(2) + word(1) + word(2) + word(1) + word(10)
+	logsJSON := fmt.Sprintf(`[
+        {"address": "0xpunks", "topics": [%[1]q, %[4]q, %[5]q, "0x%[6]s"], "data": "0x", "logIndex": "0x1", "transactionHash": "0xa"},
+        {"address": "0xitems", "topics": [%[2]q, %[7]q, %[4]q, %[5]q], "data": %[8]q, "logIndex": "0x2", "transactionHash": "0xb"},
+        {"address": "0xitems", "topics": [%[3]q, %[7]q, %[5]q, %[4]q], "data": %[9]q, "logIndex": "0x3", "transactionHash": "0xc"},
+        {"address": "0xitems", "topics": [%[3]q, %[7]q, %[5]q, %[4]q], "data": %[10]q, "logIndex": "0x4", "transactionHash": "0xd"},
+        {"address": "0xusdc", "topics": [%[1]q, %[4]q, %[5]q], "data": "0x%[6]s", "logIndex": "0x5", "transactionHash": "0xe"},
+        {"address": "0xpunks", "topics": [%[1]q, %[5]q, %[4]q, "0x%[6]s"], "data": "0x", "logIndex": "0x6", "transactionHash": "0xf", "removed": true}
+    ]`, transferTopic, transferSingleTopic, transferBatchTopic, topic(other), topic(address), word(42),
+		topic(operator), single, batch, mismatched)
+
+	store := NewMockStore()
+	store.Subscribe(ctx, address)
+	store.SetCurrentBlock(ctx, 0x10)
+	client := &MockEthereumClient{
+		blockNumber:    "0x11",
+		blockResponses: map[string]string{"0x11": `{"hash": "0xblock", "transactions": []}`},
+		logResponses:   map[string]string{"0xblock": logsJSON},
+	}
+	service := NewService(store, client)
+
+	if err := service.ParseBlocks(ctx); err != nil {
+		t.Fatalf("ParseBlocks() error = %v", err)
+	}
+
+	transfers, err := service.GetNFTTransfers(ctx, address)
+	if err != nil {
+		t.Fatalf("GetNFTTransfers() error = %v", err)
+	}
+	want := []entity.NFTTransfer{
+		{
+			Contract: "0xpunks", Standard: entity.StandardERC721, From: other, To: address,
+			TokenIDs: []string{"42"}, Quantities: []string{"1"},
+			TransactionHash: "0xa", LogIndex: 1, BlockNumber: 0x11, BlockHash: "0xblock",
+		},
+		{
+			Contract: "0xitems", Standard: entity.StandardERC1155, Operator: operator, From: other, To: address,
+			TokenIDs: []string{"7"}, Quantities: []string{"3"},
+			TransactionHash: "0xb", LogIndex: 2, BlockNumber: 0x11, BlockHash: "0xblock",
+		},
+		{
+			Contract: "0xitems", Standard: entity.StandardERC1155, Operator: operator, From: address, To: other,
+			TokenIDs: []string{"1", "2"}, Quantities: []string{"10", "20"},
+			TransactionHash: "0xc", LogIndex: 3, BlockNumber: 0x11, BlockHash: "0xblock",
+		},
+	}
+	if !reflect.DeepEqual(transfers, want) {
+		t.Errorf("GetNFTTransfers() = %+v, want %+v", transfers, want)
+	}
+
+	// The ERC-20 transfer in the same block is still a token transfer
+	if tokens, _ := service.GetTokenTransfers(ctx, address); len(tokens) != 1 || tokens[0].TransactionHash != "0xe" {
+		t.Errorf("GetTokenTransfers() = %+v, want only 0xe", tokens)
+	}
+}
+
+func TestParseTraceMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    TraceMode
+		wantErr bool
+	}{
+		{value: "", want: TraceOff},
+		{value: "off", want: TraceOff},
+		{value: "Debug", want: TraceDebug},
+		{value: "trace", want: TraceParity},
+		{value: " auto ", want: TraceAuto},
+		{value: "callTracer", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTraceMode(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTraceMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseTraceMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_ParseBlocks_InternalTransfers(t *testing.T) {
+	address := "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	blockJSON := `{"hash": "0xblock", "transactions": [
+            {"hash": "0xa", "from": "0xeoa", "to": "0xmultisig", "value": "0x0"},
+            {"hash": "0xb", "from": "0xeoa", "to": "0xrouter", "value": "0x0"},
+            {"hash": "0xc", "from": "0xeoa", "to": "0xvault", "value": "0x0"}
+        ]}`
+	// 0xa: the multisig pays the address through a nested call; the same
+	// value is also delegated (no transfer) and one payout reverts.
+	// 0xb: a router refund inside a failed branch, then a successful one.
+	// 0xc: a payout that did not fail itself, in a transaction that reverted
+	debugJSON := fmt.Sprintf(`[
+        {"txHash": "0xa", "result": {"type": "CALL", "from": "0xeoa", "to": "0xmultisig", "value": "0x0", "calls": [
+            {"type": "DELEGATECALL", "from": "0xmultisig", "to": "0xlib", "value": "0x5"},
+            {"type": "CALL", "from": "0xmultisig", "to": "0xwallet", "value": "0x0", "calls": [
+                {"type": "CALL", "from": "0xwallet", "to": %[1]q, "value": "0xde0b6b3a7640000"}
+            ]},
+            {"type": "CALL", "from": "0xmultisig", "to": %[1]q, "value": "0x1", "error": "execution reverted"}
+        ]}},
+        {"txHash": "0xb", "result": {"type": "CALL", "from": "0xeoa", "to": "0xrouter", "value": "0x0", "calls": [
+            {"type": "CALL", "from": "0xrouter", "to": "0xpool", "value": "0x0", "error": "out of gas", "calls": [
+                {"type": "CALL", "from": "0xpool", "to": %[1]q, "value": "0x2"}
+            ]},
+            {"type": "CALL", "from": "0xrouter", "to": %[1]q, "value": "0x3"}
+        ]}},
+        {"txHash": "0xc", "result": {"type": "CALL", "from": "0xeoa", "to": "0xvault", "value": "0x0", "error": "execution reverted", "calls": [
+            {"type": "CALL", "from": "0xvault", "to": %[1]q, "value": "0x4"}
+        ]}}
+    ]`, address)
+	parityJSON := fmt.Sprintf(`[
+        {"type": "call", "action": {"callType": "call", "from": "0xeoa", "to": "0xmultisig", "value": "0x0"}, "traceAddress": [], "transactionHash": "0xa", "blockHash": "0xblock"},
+        {"type": "call", "action": {"callType": "delegatecall", "from": "0xmultisig", "to": "0xlib", "value": "0x5"}, "traceAddress": [0], "transactionHash": "0xa", "blockHash": "0xblock"},
+        {"type": "call", "action": {"callType": "call", "from": "0xmultisig", "to": "0xwallet", "value": "0x0"}, "traceAddress": [1], "transactionHash": "0xa", "blockHash": "0xblock"},
+        {"type": "call", "action": {"callType": "call", "from": "0xwallet", "to": %[1]q, "value": "0xde0b6b3a7640000"}, "traceAddress": [1, 0], "transactionHash": "0xa", "blockHash": "0xblock"},
+        {"type": "call", "action": {"callType": "call", "from": "0xmultisig", "to": %[1]q, "value": "0x1"}, "error": "Reverted", "traceAddress": [2], "transactionHash": "0xa", "blockHash": "0xblock"},
+        {"type": "call", "action": {"callType": "call", "from": "0xeoa", "to": "0xrouter", "value": "0x0"}, "traceAddress": [], "transactionHash": "0xb", "blockHash": "0xblock"},
+        {"type": "call", "action": {"callType": "call", "from": "0xrouter", "to": "0xpool", "value": "0x0"}, "error": "Out of gas", "traceAddress": [0], "transactionHash": "0xb", "blockHash": "0xblock"},
+        {"type": "call", "action": {"callType": "call", "from": "0xpool", "to": %[1]q, "value": "0x2"}, "traceAddress": [0, 0], "transactionHash": "0xb", "blockHash": "0xblock"},
+        {"type": "call", "action": {"callType": "call", "from": "0xrouter", "to": %[1]q, "value": "0x3"}, "traceAddress": [1], "transactionHash": "0xb", "blockHash": "0xblock"},
+        {"type": "call", "action": {"callType": "call", "from": "0xeoa", "to": "0xvault", "value": "0x0"}, "error": "Reverted", "traceAddress": [], "transactionHash": "0xc", "blockHash": "0xblock"},
+        {"type": "call", "action": {"callType": "call", "from": "0xvault", "to": %[1]q, "value": "0x4"}, "traceAddress": [0], "transactionHash": "0xc", "blockHash": "0xblock"},
+        {"type": "reward", "action": {"author": "0xminer", "value": "0x1bc16d674ec80000"}, "traceAddress": [], "blockHash": "0xblock"}
+    ]`, address)
+	want := []entity.InternalTransfer{
+		{
+			TransactionHash: "0xa", TracePath: []int{1, 0}, CallType: "CALL", From: "0xwallet", To: address,
+			Value: big.NewInt(1000000000000000000), BlockNumber: 0x11, BlockHash: "0xblock",
+		},
+		{
+			TransactionHash: "0xb", TracePath: []int{1}, CallType: "CALL", From: "0xrouter", To: address,
+			Value: big.NewInt(3), BlockNumber: 0x11, BlockHash: "0xblock",
+		},
+	}
+
+	tests := []struct {
+		name   string
+		mode   TraceMode
+		traces map[string]string
+		want   []entity.InternalTransfer
+	}{
+		{
+			name:   "debug_traceBlockByNumber",
+			mode:   TraceDebug,
+			traces: map[string]string{"debug_traceBlockByNumber:0x11": debugJSON},
+			want:   want,
+		},
+		{
+			name:   "trace_block",
+			mode:   TraceParity,
+			traces: map[string]string{"trace_block:0x11": parityJSON},
+			want:   want,
+		},
+		{
+			name:   "auto falls back to trace_block",
+			mode:   TraceAuto,
+			traces: map[string]string{"trace_block:0x11": parityJSON},
+			want:   want,
+		},
+		{
+			name: "tracing unsupported",
+			mode: TraceAuto,
+		},
+		{
+			name:   "tracing off",
+			mode:   TraceOff,
+			traces: map[string]string{"debug_traceBlockByNumber:0x11": debugJSON},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMockStore()
+			store.Subscribe(ctx, address)
+			store.SetCurrentBlock(ctx, 0x10)
+			client := &MockEthereumClient{
+				blockNumber:    "0x11",
+				blockResponses: map[string]string{"0x11": blockJSON},
+				traceResponses: tt.traces,
+			}
+			service := NewService(store, client, WithTracing(tt.mode))
+
+			if err := service.ParseBlocks(ctx); err != nil {
+				t.Fatalf("ParseBlocks() error = %v", err)
+			}
+			if store.currentBlock != 0x11 {
+				t.Errorf("Current block = %d, want %d", store.currentBlock, 0x11)
+			}
+
+			transfers, err := service.GetInternalTransfers(ctx, address)
+			if err != nil {
+				t.Fatalf("GetInternalTransfers() error = %v", err)
+			}
+			if len(transfers) != len(tt.want) {
+				t.Fatalf("GetInternalTransfers() = %+v, want %+v", transfers, tt.want)
+			}
+			for i, transfer := range transfers {
+				want := tt.want[i]
+				if transfer.Value.Cmp(want.Value) != 0 {
+					t.Errorf("Transfer %d value = %v, want %v", i, transfer.Value, want.Value)
+				}
+				transfer.Value, want.Value = nil, nil
+				if !reflect.DeepEqual(transfer, want) {
+					t.Errorf("Transfer %d = %+v, want %+v", i, transfer, want)
+				}
+			}
+		})
+	}
+}
+
+func TestService_ParseBlocks_TraceStateUnavailable(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	store := NewMockStore()
+	store.Subscribe(ctx, address)
+	store.SetCurrentBlock(ctx, 0x10)
+	client := &MockEthereumClient{
+		blockNumber:    "0x11",
+		blockResponses: map[string]string{"0x11": `{"hash": "0xblock", "transactions": []}`},
+		traceResponses: map[string]string{"debug_traceBlockByNumber:0x11": `[]`},
+		traceErrors:    map[string]string{"debug_traceBlockByNumber:0x11": "required historical state unavailable (reexec=128)"},
+	}
+	service := NewService(store, client, WithTracing(TraceAuto))
+
+	// Missing state fails the block instead of switching tracing APIs
+	if err := service.ParseBlocks(ctx); err == nil {
+		t.Fatal("ParseBlocks() error = nil, want the tracing error")
+	}
+	if store.currentBlock != 0x10 {
+		t.Errorf("Current block = %d, want block left uncommitted", store.currentBlock)
+	}
+	if tracer := service.fetch.tracer.Load(); tracer != TraceDebug {
+		t.Errorf("Tracer = %v, want %v kept", tracer, TraceDebug)
+	}
+
+	delete(client.traceErrors, "debug_traceBlockByNumber:0x11")
+	if err := service.ParseBlocks(ctx); err != nil {
+		t.Fatalf("ParseBlocks() retry error = %v", err)
+	}
+	if store.currentBlock != 0x11 {
+		t.Errorf("Current block = %d, want %d", store.currentBlock, 0x11)
+	}
+}
+
+func TestService_Backfill_KeepsLiveFetchState(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	store := NewMockStore()
+	store.Subscribe(ctx, address)
+	store.SetCurrentBlock(ctx, 0x11)
+	// The node rejects tracing and block receipts, answering per transaction
+	client := &MockEthereumClient{
+		blockNumber: "0x11",
+		blockResponses: map[string]string{
+			"0x10": fmt.Sprintf(`{"hash": "0x10", "transactions": [{"hash": "0xa", "from": %q, "to": "0x0", "value": "0x1"}]}`, address),
+			"0x11": `{"hash": "0x11", "transactions": []}`,
+		},
+		receiptResponses:         map[string]string{"0xa": `{"transactionHash": "0xa", "blockHash": "0x10", "status": "0x1"}`},
+		blockReceiptsUnsupported: true,
+		traceResponses:           map[string]string{"debug_traceBlockByNumber:0x11": `[]`},
+	}
+	service := NewService(store, client, WithTracing(TraceDebug))
+
+	scheduled, _ := service.ScheduleBackfill(ctx, address, 0x10, time.Time{})
+	service.runBackfill(ctx, <-service.backfills.queue)
+
+	if job, _ := service.GetBackfill(ctx, scheduled.ID); job.Status != entity.BackfillCompleted || job.Added != 1 {
+		t.Fatalf("Job status = %s (%s) added %d, want %s and 1", job.Status, job.Error, job.Added, entity.BackfillCompleted)
+	}
+	if tracer := service.fetch.tracer.Load(); tracer != TraceDebug {
+		t.Errorf("Live tracer = %v after backfill, want %v", tracer, TraceDebug)
+	}
+	if service.fetch.blockReceiptsUnsupported.Load() {
+		t.Error("Live parsing gave up eth_getBlockReceipts after a backfill")
+	}
+}
+
+func TestService_Backfill_Reorg(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	blockJSON := func(hash string) string {
+		return fmt.Sprintf(`{"hash": %q, "transactions": [{"hash": "0xa%s", "from": %q, "to": "0x0", "value": "0x1"}]}`,
+			hash, hash, address)
+	}
+
+	tests := []struct {
+		name    string
+		current int
+		headers []entity.BlockHeader
+		wantErr bool
+	}{
+		{
+			name:    "stored headers match",
+			current: 0x11,
+			headers: []entity.BlockHeader{{Number: 0x10, Hash: "0x10"}, {Number: 0x11, Hash: "0x11"}},
+		},
+		{
+			name:    "headers already pruned",
+			current: 0x11,
+		},
+		{
+			name:    "block replaced after fetching it",
+			current: 0x11,
+			headers: []entity.BlockHeader{{Number: 0x10, Hash: "0x10"}, {Number: 0x11, Hash: "0xcanonical"}},
+			wantErr: true,
+		},
+		{
+			name:    "block rolled back after fetching it",
+			current: 0x10,
+			headers: []entity.BlockHeader{{Number: 0x10, Hash: "0x10"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMockStore()
+			store.Subscribe(ctx, address)
+			store.SetCurrentBlock(ctx, 0x11)
+			client := &MockEthereumClient{
+				blockNumber:    "0x11",
+				blockResponses: map[string]string{"0x10": blockJSON("0x10"), "0x11": blockJSON("0x11")},
+			}
+			// Live parsing moves on while the job fetches its blocks
+			client.onCall = func(method string, params []interface{}) {
+				if method != "eth_getBlockReceipts" {
+					return
+				}
+				store.currentBlock = tt.current
+				for _, header := range tt.headers {
+					store.headers[header.Number] = header
+				}
+			}
+			service := NewService(store, client)
+
+			scheduled, _ := service.ScheduleBackfill(ctx, address, 0x10, time.Time{})
+			service.runBackfill(ctx, <-service.backfills.queue)
+
+			job, _ := service.GetBackfill(ctx, scheduled.ID)
+			if tt.wantErr {
+				if job.Status != entity.BackfillFailed || !strings.Contains(job.Error, "reorganized") {
+					t.Errorf("Job status = %s (%s), want failed on the reorg", job.Status, job.Error)
+				}
+				if got := len(store.transactions[address]); got != 0 {
+					t.Errorf("Got %d transactions, want none merged from the batch", got)
+				}
+				return
+			}
+			if job.Status != entity.BackfillCompleted || job.Added != 2 {
+				t.Errorf("Job status = %s (%s) added %d, want %s and 2", job.Status, job.Error, job.Added, entity.BackfillCompleted)
+			}
+		})
+	}
+}
+
+func TestService_GetTransactions_DecodesInput(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"
+	vault := "0x9999999999999999999999999999999999999999"
+	word := func(value string) string {
+		return strings.Repeat("0", 64-len(value)) + value
+	}
+	recipient := "2222222222222222222222222222222222222222"
+	deposit, err := abi.ParseSignature("deposit(uint256[],string)")
+	if err != nil {
+		t.Fatalf("ParseSignature() error = %v", err)
+	}
+
+	store := NewMockStore()
+	store.Subscribe(ctx, address)
+	store.transactions[address] = []entity.Transaction{
+		// ERC-20 transfer, known from the built-in table
+		{Hash: "0x1", From: address, To: "0xtoken", Input: "0xa9059cbb" + word(recipient) + word("f4240")},
+		// deposit(uint256[],string) on a contract with an uploaded ABI
+		{Hash: "0x2", From: address, To: vault, Input: deposit.SelectorHex() + word("40") + word("a0") +
+			word("2") + word("1") + word("2") + word("2") + "6869" + strings.Repeat("0", 60)},
+		// Unknown function, plain transfer and a truncated transfer call
+		{Hash: "0x3", From: address, To: "0xother", Input: "0xdeadbeef"},
+		{Hash: "0x4", From: address, To: "0xother", Input: "0x"},
+		{Hash: "0x5", From: address, To: "0xtoken", Input: "0xa9059cbb" + word(recipient)},
+	}
+	service := NewService(store, &MockEthereumClient{})
+
+	abiJSON := `[{"type": "function", "name": "deposit", "inputs": [
+        {"name": "ids", "type": "uint256[]"}, {"name": "note", "type": "string"}]}]`
+	if _, err := service.UploadABI(ctx, vault, []byte("not json")); err == nil {
+		t.Error("UploadABI() accepted an invalid ABI")
+	}
+	methods, err := service.UploadABI(ctx, vault, []byte(abiJSON))
+	if err != nil || methods != 1 {
+		t.Fatalf("UploadABI() = %d, %v, want 1 method", methods, err)
+	}
+	transactions, err := service.GetTransactions(ctx, address, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+
+	wantTransfer := &entity.DecodedCall{
+		Method: "transfer", Signature: "transfer(address,uint256)", Selector: "0xa9059cbb", Source: entity.DecodeSourceBuiltin,
+		Args: []entity.DecodedArg{
+			{Type: "address", Value: "0x" + recipient},
+			{Type: "uint256", Value: "1000000"},
+		},
+	}
+	wantDeposit := &entity.DecodedCall{
+		Method: "deposit", Signature: "deposit(uint256[],string)", Selector: deposit.SelectorHex(), Source: entity.DecodeSourceContract,
+		Args: []entity.DecodedArg{
+			{Name: "ids", Type: "uint256[]", Value: []interface{}{"1", "2"}},
+			{Name: "note", Type: "string", Value: "hi"},
+		},
+	}
+	want := []*entity.DecodedCall{wantTransfer, wantDeposit, nil, nil, nil}
+	for i, tx := range transactions {
+		if !reflect.DeepEqual(tx.Decoded, want[i]) {
+			t.Errorf("Transaction %s decoded = %+v, want %+v", tx.Hash, tx.Decoded, want[i])
+		}
+	}
+
+	// Called contracts without an ABI are not remembered
+	if len(service.abis.abis) != 1 {
+		t.Errorf("ABI registry holds %d contracts, want only the registered one", len(service.abis.abis))
+	}
+
+	// A restarted service loads the registered ABIs from the store
+	restarted := NewService(store, &MockEthereumClient{})
+	transactions, err = restarted.GetTransactions(ctx, address, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactions() after restart error = %v", err)
+	}
+	if !reflect.DeepEqual(transactions[1].Decoded, wantDeposit) {
+		t.Errorf("Decoded after restart = %+v, want %+v", transactions[1].Decoded, wantDeposit)
+	}
+}
+
+func TestService_ParseBlocks_ContractCreations(t *testing.T) {
+	deployer := "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	created := "0x5fbdb2315678afecb367f032d93f642f64180aa3"
+	blockJSON := fmt.Sprintf(`{"hash": "0xblock", "transactions": [
+            {"hash": "0x1", "from": %[1]q, "to": null, "value": "0x0"},
+            {"hash": "0x2", "from": %[1]q, "to": null, "value": "0x0"},
+            {"hash": "0x3", "from": "0xother", "to": null, "value": "0x0"}
+        ]}`, deployer)
+	receipts := fmt.Sprintf(`[
+        {"transactionHash": "0x1", "blockHash": "0xblock", "status": "0x1", "contractAddress": %q, "logs": []},
+        {"transactionHash": "0x2", "blockHash": "0xblock", "status": "0x0", "contractAddress": "0xfailed", "logs": []},
+        {"transactionHash": "0x3", "blockHash": "0xblock", "status": "0x1", "contractAddress": "0xunrelated", "logs": []}
+    ]`, created)
+
+	for _, autoSubscribe := range []bool{false, true} {
+		t.Run(fmt.Sprintf("auto-subscribe %v", autoSubscribe), func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMockStore()
+			store.Subscribe(ctx, deployer)
+			store.SetCurrentBlock(ctx, 0x10)
+			client := &MockEthereumClient{
+				blockNumber:      "0x11",
+				blockResponses:   map[string]string{"0x11": blockJSON},
+				receiptResponses: map[string]string{"0x11": receipts},
+			}
+			service := NewService(store, client, WithAutoSubscribeContracts(autoSubscribe))
+
+			if err := service.ParseBlocks(ctx); err != nil {
+				t.Fatalf("ParseBlocks() error = %v", err)
+			}
+
+			deployed := store.transactions[deployer]
+			if len(deployed) != 2 {
+				t.Fatalf("Deployer transactions = %+v, want both creations", deployed)
+			}
+			if !deployed[0].IsContractCreation() || deployed[0].CreatedContract != created {
+				t.Errorf("Created contract = %q, want %q", deployed[0].CreatedContract, created)
+			}
+			if deployed[1].CreatedContract != "" {
+				t.Errorf("Reverted creation has created contract %q", deployed[1].CreatedContract)
+			}
+
+			if store.subscribers[created] != autoSubscribe {
+				t.Errorf("Deployed contract subscribed = %v, want %v", store.subscribers[created], autoSubscribe)
+			}
+			if store.subscribers["0xfailed"] || store.subscribers["0xunrelated"] {
+				t.Error("Subscribed a contract that was not deployed by a subscribed address")
+			}
+			wantHistory := 0
+			if autoSubscribe {
+				wantHistory = 1
+			}
+			if history := store.transactions[created]; len(history) != wantHistory {
+				t.Errorf("Deployed contract transactions = %+v, want %d", history, wantHistory)
+			}
+		})
+	}
+}
+
+func TestService_ParseBlocks_DeployedContractsCommit(t *testing.T) {
+	ctx := context.Background()
+	deployer := "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	created := "0x5fbdb2315678afecb367f032d93f642f64180aa3"
+	blockJSON := fmt.Sprintf(`{"hash": "0xblock", "transactions": [
+            {"hash": "0x1", "from": %q, "to": null, "value": "0x0"}
+        ]}`, deployer)
+	receipts := fmt.Sprintf(`[
+        {"transactionHash": "0x1", "blockHash": "0xblock", "status": "0x1", "contractAddress": %q, "logs": []}
+    ]`, created)
+
+	store := NewMockStore()
+	store.Subscribe(ctx, deployer)
+	store.SetCurrentBlock(ctx, 0x10)
+	store.commitErr = errors.New("disk full")
+	client := &MockEthereumClient{
+		blockNumber:      "0x11",
+		blockResponses:   map[string]string{"0x11": blockJSON},
+		receiptResponses: map[string]string{"0x11": receipts},
+	}
+	service := NewService(store, client, WithAutoSubscribeContracts(true))
+
+	// The subscription is part of the commit, so a failed commit drops it
+	if err := service.ParseBlocks(ctx); err == nil {
+		t.Fatal("ParseBlocks() succeeded, want the commit error")
+	}
+	if store.subscribers[created] {
+		t.Error("Deployed contract subscribed although the block was not committed")
+	}
+
+	store.commitErr = nil
+	if err := service.ParseBlocks(ctx); err != nil {
+		t.Fatalf("ParseBlocks() error = %v", err)
+	}
+	if !store.subscribers[created] || len(store.transactions[created]) != 1 {
+		t.Fatalf("Deployed contract subscribed = %v with %d transactions, want its creation",
+			store.subscribers[created], len(store.transactions[created]))
+	}
+
+	// Rolling the block back removes the subscription it made
+	if err := service.rollback(ctx, 0x10); err != nil {
+		t.Fatalf("rollback() error = %v", err)
+	}
+	if store.subscribers[created] {
+		t.Error("Deployed contract still subscribed after its block was rolled back")
+	}
+	if !store.subscribers[deployer] {
+		t.Error("Rollback unsubscribed the deployer")
+	}
+}
+
+func TestService_TransactionValues(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	// Beyond what a float64 holds exactly
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	blockJSON := fmt.Sprintf(`{"hash": "0xblock", "transactions": [
+            {"hash": "0x1", "from": "0xother", "to": %[1]q, "value": "0x%[2]x"},
+            {"hash": "0x2", "from": %[1]q, "to": "0xother", "value": "0x2386f26fc10000"},
+            {"hash": "0x3", "from": %[1]q, "to": "0xother", "value": "0x1"},
+            {"hash": "0x4", "from": %[1]q, "to": %[1]q, "value": "0x5"}
+        ]}`, address, huge)
+	receipts := `[
+        {"transactionHash": "0x1", "blockHash": "0xblock", "status": "0x1", "logs": []},
+        {"transactionHash": "0x2", "blockHash": "0xblock", "status": "0x1", "gasUsed": "0x5208", "effectiveGasPrice": "0x3b9aca00", "logs": []},
+        {"transactionHash": "0x3", "blockHash": "0xblock", "status": "0x0", "gasUsed": "0x7530", "effectiveGasPrice": "0x3b9aca00", "logs": []},
+        {"transactionHash": "0x4", "blockHash": "0xblock", "status": "0x1", "gasUsed": "0x5208", "effectiveGasPrice": "0x1", "logs": []}
+    ]`
+
+	store := NewMockStore()
+	store.Subscribe(ctx, address)
+	store.SetCurrentBlock(ctx, 0x10)
+	client := &MockEthereumClient{
+		blockNumber:      "0x11",
+		blockResponses:   map[string]string{"0x11": blockJSON},
+		receiptResponses: map[string]string{"0x11": receipts},
+	}
+	service := NewService(store, client)
+	if err := service.ParseBlocks(ctx); err != nil {
+		t.Fatalf("ParseBlocks() error = %v", err)
+	}
+
+	// 0x4 is a self-transfer and is stored once
+	filtered, err := service.GetTransactions(ctx, address, entity.TransactionFilter{
+		MinValue: big.NewInt(2),
+		MaxValue: big.NewInt(10000000000000000),
+	})
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+	var hashes []string
+	for _, tx := range filtered {
+		hashes = append(hashes, tx.Hash)
+	}
+	if !reflect.DeepEqual(hashes, []string{"0x2", "0x4"}) {
+		t.Errorf("GetTransactions() with value range = %v, want [0x2 0x4]", hashes)
+	}
+
+	summary, err := service.GetTransactionSummary(ctx, address, entity.TransactionFilter{MinValue: big.NewInt(1)})
+	if err != nil {
+		t.Fatalf("GetTransactionSummary() error = %v", err)
+	}
+	// The reverted 0x3 moved nothing but paid its fee
+	wantReceived := new(big.Int).Add(huge, big.NewInt(5))
+	wantSent := big.NewInt(10000000000000000 + 5)
+	wantFees := big.NewInt(21000*1000000000 + 30000*1000000000 + 21000)
+	if summary.Count != 4 || summary.Received.Cmp(wantReceived) != 0 || summary.Sent.Cmp(wantSent) != 0 || summary.FeesPaid.Cmp(wantFees) != 0 {
+		t.Errorf("GetTransactionSummary() = %+v, want 4 transactions, received %v, sent %v, fees %v",
+			summary, wantReceived, wantSent, wantFees)
+	}
+}
+
+func TestService_ParseBlocks_Withdrawals(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	blockJSON := fmt.Sprintf(`{"hash": "0xblock", "timestamp": "0x6592ad00", "transactions": [], "withdrawals": [
+		{"index": "0x10", "validatorIndex": "0x5", "address": %q, "amount": "0xbebc200"},
+		{"index": "0x11", "validatorIndex": "0x6", "address": "0x1111111111111111111111111111111111111111", "amount": "0x1"}
+	]}`, address)
+
+	store := NewMockStore()
+	store.Subscribe(ctx, address)
+	store.SetCurrentBlock(ctx, 0x10)
+	client := &MockEthereumClient{
+		blockNumber:    "0x11",
+		blockResponses: map[string]string{"0x11": blockJSON},
+	}
+	service := NewService(store, client)
+
+	if err := service.ParseBlocks(ctx); err != nil {
+		t.Fatalf("ParseBlocks() error = %v", err)
+	}
+
+	withdrawals, err := service.GetWithdrawals(ctx, address)
+	if err != nil {
+		t.Fatalf("GetWithdrawals() error = %v", err)
+	}
+	if len(withdrawals) != 1 {
+		t.Fatalf("GetWithdrawals() returned %d withdrawals, want 1", len(withdrawals))
+	}
+	got := withdrawals[0]
+	// 0xbebc200 gwei is 0.2 ether
+	if got.Amount.String() != "200000000000000000" {
+		t.Errorf("Withdrawal amount = %s wei, want 200000000000000000", got.Amount)
+	}
+	got.Amount = nil
+	want := entity.Withdrawal{
+		Index: 0x10, ValidatorIndex: 5, Address: address,
+		BlockNumber: 0x11, BlockHash: "0xblock", BlockTimestamp: 1704111360,
+	}
+	if got != want {
+		t.Errorf("GetWithdrawals() = %+v, want %+v", got, want)
+	}
+
+	// A backfill over the same block finds the withdrawal but does not add it again
+	job, err := service.ScheduleBackfill(ctx, address, 0x11, time.Time{})
+	if err != nil {
+		t.Fatalf("ScheduleBackfill() error = %v", err)
+	}
+	service.runBackfill(ctx, <-service.backfills.queue)
+	job, _ = service.GetBackfill(ctx, job.ID)
+	if job.Status != entity.BackfillCompleted || job.Found != 1 || job.Added != 0 {
+		t.Errorf("Backfill = %s found %d added %d, want completed, 1 and 0", job.Status, job.Found, job.Added)
+	}
+	if got := len(store.withdrawals[address]); got != 1 {
+		t.Errorf("Got %d withdrawals after backfill, want 1", got)
+	}
+}
+
+func TestService_ParseBlocks_CommitBlock(t *testing.T) {
+	ctx := context.Background()
+	address := "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	blockJSON := fmt.Sprintf(`{"hash": "0xblock", "parentHash": "0xa10", "transactions": [
+		{"hash": "0x1", "from": %[1]q, "to": "0x0", "value": "0x1"},
+		{"hash": "0x2", "from": "0x0", "to": %[1]q, "value": "0x2"}
+	]}`, address)
+
+	store := NewMockStore()
+	store.Subscribe(ctx, address)
+	store.SetCurrentBlock(ctx, 0x10)
+	store.commitErr = errors.New("disk full")
+	client := &MockEthereumClient{blockNumber: "0x11", blockResponses: map[string]string{"0x11": blockJSON}}
+	service := NewService(store, client)
+
+	// A failed commit leaves no part of the block behind
+	if err := service.ParseBlocks(ctx); err == nil {
+		t.Fatal("ParseBlocks() succeeded, want the commit error")
+	}
+	if store.currentBlock != 0x10 || len(store.transactions[address]) != 0 {
+		t.Fatalf("After failed commit current block = %d with %d transactions, want 0x10 and none",
+			store.currentBlock, len(store.transactions[address]))
+	}
+	if _, ok := store.headers[0x11]; ok {
+		t.Error("Header of the failed block was saved")
+	}
+
+	store.commitErr = nil
+	if err := service.ParseBlocks(ctx); err != nil {
+		t.Fatalf("ParseBlocks() retry error = %v", err)
+	}
+	if store.currentBlock != 0x11 || len(store.transactions[address]) != 2 {
+		t.Fatalf("After retry current block = %d with %d transactions, want 0x11 and 2",
+			store.currentBlock, len(store.transactions[address]))
+	}
+
+	// Committing the same block again changes nothing
+	var block Block
+	json.Unmarshal([]byte(blockJSON), &block)
+	if err := service.commitBlock(ctx, 0x11, &block); err != nil {
+		t.Fatalf("commitBlock() again error = %v", err)
+	}
+	if got := len(store.transactions[address]); got != 2 {
+		t.Errorf("Got %d transactions after committing again, want 2", got)
 	}
 }
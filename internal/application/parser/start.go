@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+)
+
+// defaultStartOffset is how far behind the head parsing starts when there is
+// nothing to resume from.
+const defaultStartOffset = 10
+
+// StartMode selects where parsing begins when the service starts.
+type StartMode string
+
+const (
+	// StartCheckpoint resumes after the saved checkpoint, then after the
+	// store's current block, and otherwise starts defaultStartOffset blocks
+	// behind the head.
+	StartCheckpoint StartMode = "checkpoint"
+	// StartLatest starts Offset blocks behind the head.
+	StartLatest StartMode = "latest"
+	// StartBlock starts at an explicit block number.
+	StartBlock StartMode = "block"
+)
+
+// StartPolicy is the parsed form of the parser.start_block setting.
+type StartPolicy struct {
+	Mode   StartMode
+	Block  int
+	Offset int
+}
+
+// ParseStartPolicy accepts "checkpoint", "latest", "latest-N" or a block
+// number. An empty value means "checkpoint".
+func ParseStartPolicy(value string) (StartPolicy, error) {
+	value = strings.TrimSpace(strings.ToLower(value))
+	switch {
+	case value == "" || value == string(StartCheckpoint):
+		return StartPolicy{Mode: StartCheckpoint}, nil
+	case value == string(StartLatest):
+		return StartPolicy{Mode: StartLatest}, nil
+	case strings.HasPrefix(value, "latest-"):
+		offset, err := strconv.Atoi(strings.TrimPrefix(value, "latest-"))
+		if err != nil || offset < 0 {
+			return StartPolicy{}, fmt.Errorf("invalid start block offset in %q", value)
+		}
+		return StartPolicy{Mode: StartLatest, Offset: offset}, nil
+	default:
+		block, err := strconv.Atoi(value)
+		if err != nil || block < 0 {
+			return StartPolicy{}, fmt.Errorf("invalid start block %q: want checkpoint, latest, latest-N or a block number", value)
+		}
+		return StartPolicy{Mode: StartBlock, Block: block}, nil
+	}
+}
+
+// resolveStart returns the block to treat as already processed when parsing
+// begins, so parsing continues with the block after it.
+func (s *Service) resolveStart(ctx context.Context, latestBlock int) (int, error) {
+	var cursor int
+	switch s.startPolicy.Mode {
+	case StartBlock:
+		cursor = s.startPolicy.Block - 1
+	case StartLatest:
+		cursor = latestBlock - s.startPolicy.Offset - 1
+	default:
+		resumed, ok, err := s.resumeFromCheckpoint(ctx, latestBlock)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return resumed, nil
+		}
+
+		current, err := s.store.GetCurrentBlock(ctx)
+		if err != nil {
+			return 0, errors.NewStorageError("failed to get current block", err)
+		}
+		if current > 0 {
+			return current, nil
+		}
+		cursor = latestBlock - defaultStartOffset
+	}
+
+	if cursor < 0 {
+		cursor = 0
+	}
+	s.logger.Info("Starting from configured block",
+		zap.String("mode", string(s.startPolicy.Mode)),
+		zap.Int("first_block", cursor+1),
+	)
+	return cursor, nil
+}
+
+// resumeFromCheckpoint loads the checkpoint and seeds the header store with it
+// so a reorg across the restart is still detected. A resume gap above the
+// configured threshold is logged as a warning.
+func (s *Service) resumeFromCheckpoint(ctx context.Context, latestBlock int) (int, bool, error) {
+	if s.checkpoint == nil {
+		return 0, false, nil
+	}
+
+	header, ok, err := s.checkpoint.Load(ctx)
+	if err != nil {
+		return 0, false, errors.NewStorageError("failed to load checkpoint", err)
+	}
+	if !ok {
+		return 0, false, nil
+	}
+
+	if err := s.store.SaveBlockHeader(ctx, header); err != nil {
+		return 0, false, errors.NewStorageError("failed to save block header", err)
+	}
+
+	gap := latestBlock - header.Number
+	resumeGapBlocks.Set(int64(gap))
+	if s.maxResumeGap > 0 && gap > s.maxResumeGap {
+		s.logger.Warn("Resume gap exceeds threshold",
+			zap.Int("checkpoint_block", header.Number),
+			zap.Int("latest_block", latestBlock),
+			zap.Int("gap", gap),
+			zap.Int("max_resume_gap", s.maxResumeGap),
+		)
+	} else {
+		s.logger.Info("Resuming from checkpoint",
+			zap.Int("checkpoint_block", header.Number),
+			zap.Int("gap", gap),
+		)
+	}
+	return header.Number, true, nil
+}
+
+// saveCheckpoint records the header as the last committed block.
+func (s *Service) saveCheckpoint(ctx context.Context, header entity.BlockHeader) error {
+	if s.checkpoint == nil {
+		return nil
+	}
+	if err := s.checkpoint.Save(ctx, header); err != nil {
+		return errors.NewStorageError("failed to save checkpoint", err)
+	}
+	checkpointBlock.Set(int64(header.Number))
+	return nil
+}
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"math/big"
+	"strings"
+)
+
+// GetTransactionSummary totals the value moved by the address's transactions
+// that match filter, along with the fees it paid.
+func (s *Service) GetTransactionSummary(ctx context.Context, address string, filter entity.TransactionFilter) (entity.TransactionSummary, error) {
+	transactions, err := s.GetTransactions(ctx, address, filter)
+	if err != nil {
+		return entity.TransactionSummary{}, err
+	}
+
+	summary := entity.TransactionSummary{
+		Address:  strings.ToLower(address),
+		Count:    len(transactions),
+		Received: new(big.Int),
+		Sent:     new(big.Int),
+		FeesPaid: new(big.Int),
+	}
+	for _, tx := range transactions {
+		sent := strings.EqualFold(tx.From, address)
+		if !tx.Reverted() {
+			// A self-transfer counts both ways
+			if sent {
+				summary.Sent.Add(summary.Sent, tx.ValueOrZero())
+			}
+			if strings.EqualFold(tx.To, address) {
+				summary.Received.Add(summary.Received, tx.ValueOrZero())
+			}
+		}
+
+		if sent && tx.Receipt != nil {
+			fee, err := transactionFee(tx.Receipt)
+			if err != nil {
+				return entity.TransactionSummary{}, errors.NewValidationError(
+					fmt.Sprintf("invalid receipt for transaction %s", tx.Hash), err)
+			}
+			summary.FeesPaid.Add(summary.FeesPaid, fee)
+		}
+	}
+	return summary, nil
+}
+
+// transactionFee is the gas used times the effective gas price.
+func transactionFee(receipt *entity.Receipt) (*big.Int, error) {
+	price, err := ethereum.ParseQuantity(receipt.EffectiveGasPrice)
+	if err != nil {
+		return nil, err
+	}
+	return price.Mul(price, new(big.Int).SetUint64(receipt.GasUsed)), nil
+}
@@ -0,0 +1,225 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"go.uber.org/zap"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// transferTopic is keccak256("Transfer(address,address,uint256)"). ERC-20
+// and ERC-721 share it; ERC-20 transfers have three topics, ERC-721 four.
+const transferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// rpcLog is an event log as returned by the node.
+type rpcLog struct {
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	LogIndex        string   `json:"logIndex"`
+	TransactionHash string   `json:"transactionHash"`
+	BlockHash       string   `json:"blockHash"`
+	Removed         bool     `json:"removed"`
+}
+
+func (l rpcLog) toEntity() (entity.Log, error) {
+	index, err := parseQuantity(l.LogIndex)
+	if err != nil {
+		return entity.Log{}, fmt.Errorf("invalid logIndex: %v", err)
+	}
+	return entity.Log{
+		Address:  l.Address,
+		Topics:   l.Topics,
+		Data:     l.Data,
+		LogIndex: int(index),
+	}, nil
+}
+
+// logTopicFilters select the transfer events naming a subscribed address as
+// sender or recipient. Nodes OR the values listed for one topic position but
+// AND the positions, so each party needs a request of its own: Transfer
+// indexes from and to as topics 1 and 2, TransferSingle and TransferBatch as
+// topics 2 and 3 after the operator.
+func logTopicFilters(addresses []string) [][]interface{} {
+	topics := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		topics = append(topics, addressTopic(address))
+	}
+	nftTopics := []string{transferSingleTopic, transferBatchTopic}
+	return [][]interface{}{
+		{transferTopic, topics},
+		{transferTopic, nil, topics},
+		{nftTopics, nil, topics},
+		{nftTopics, nil, nil, topics},
+	}
+}
+
+// addressTopic left-pads an address to the 32-byte form of indexed topics.
+func addressTopic(address string) string {
+	return "0x000000000000000000000000" + strings.TrimPrefix(strings.ToLower(address), "0x")
+}
+
+// logsRequest asks for the block's events matching topics. Filtering by block
+// hash keeps the logs consistent with the block body even during a reorg.
+func logsRequest(block *Block, topics []interface{}) ethereum.JSONRPCRequest {
+	return ethereum.JSONRPCRequest{
+		Method: "eth_getLogs",
+		Params: []interface{}{map[string]interface{}{
+			"blockHash": block.Hash,
+			"topics":    topics,
+		}},
+	}
+}
+
+// fetchLogs loads the transfer events of subscribed addresses in consecutive
+// blocks starting at first in one batch, retrying failed entries
+// individually. It returns how many leading blocks got their logs. Without
+// subscriptions there is nothing to ask for and the node is not called.
+func (s *Service) fetchLogs(ctx context.Context, first int, blocks []*Block) (int, error) {
+	if len(blocks) == 0 {
+		return 0, nil
+	}
+
+	subscriptions, err := s.store.GetSubscriptions(ctx)
+	if err != nil {
+		return 0, errors.NewStorageError("failed to get subscriptions", err)
+	}
+	if len(subscriptions) == 0 {
+		return len(blocks), nil
+	}
+
+	filters := logTopicFilters(subscriptions)
+	requests := make([]ethereum.JSONRPCRequest, 0, len(blocks)*len(filters))
+	for _, block := range blocks {
+		for _, topics := range filters {
+			requests = append(requests, logsRequest(block, topics))
+		}
+	}
+
+	responses, err := s.client.BatchRPCCall(ctx, requests)
+	if err != nil {
+		return 0, errors.NewEthereumError("failed to get log batch", err)
+	}
+
+	for i, block := range blocks {
+		blockNum := first + i
+		var logs []rpcLog
+		for j, topics := range filters {
+			response := responses[i*len(filters)+j]
+			if response.Error != nil {
+				s.logger.Debug("Log batch entry failed, retrying individually",
+					zap.Int("block_number", blockNum),
+					zap.Any("rpc_error", response.Error),
+				)
+				request := logsRequest(block, topics)
+				if response, err = s.client.MakeRPCCall(ctx, request.Method, request.Params); err != nil {
+					return i, errors.NewEthereumError(fmt.Sprintf("failed to get logs for block %d", blockNum), err)
+				}
+			}
+
+			var matched []rpcLog
+			if err := decodeResult(response, &matched); err != nil {
+				return i, errors.NewEthereumError(fmt.Sprintf("failed to get logs for block %d", blockNum), err)
+			}
+			logs = append(logs, matched...)
+		}
+		block.Logs = mergeLogs(logs)
+	}
+	return len(blocks), nil
+}
+
+// mergeLogs drops logs returned by more than one filter, such as a transfer
+// between two subscribed addresses, and restores their order in the block.
+func mergeLogs(logs []rpcLog) []rpcLog {
+	seen := make(map[string]bool, len(logs))
+	merged := logs[:0]
+	for _, log := range logs {
+		key := log.TransactionHash + ":" + log.LogIndex
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, log)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		a, _ := parseQuantity(merged[i].LogIndex)
+		b, _ := parseQuantity(merged[j].LogIndex)
+		return a < b
+	})
+	return merged
+}
+
+// extractTokenTransfers decodes the block's ERC-20 Transfer events accepted
+// by match. Events that do not follow the standard layout are skipped.
+func extractTokenTransfers(blockNum int, block *Block, match matchFunc) ([]entity.TokenTransfer, error) {
+	var transfers []entity.TokenTransfer
+	for _, log := range block.Logs {
+		if log.Removed || len(log.Topics) != 3 || !strings.EqualFold(log.Topics[0], transferTopic) {
+			continue
+		}
+		from, okFrom := topicAddress(log.Topics[1])
+		to, okTo := topicAddress(log.Topics[2])
+		amount, okAmount := wordToInt(log.Data)
+		if !okFrom || !okTo || !okAmount {
+			continue
+		}
+
+		matched, err := match(from, to)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+
+		decoded, err := log.toEntity()
+		if err != nil {
+			return nil, errors.NewValidationError(
+				fmt.Sprintf("invalid log in transaction %s", log.TransactionHash), err)
+		}
+		transfers = append(transfers, entity.TokenTransfer{
+			Token:           log.Address,
+			From:            from,
+			To:              to,
+			Amount:          amount.String(),
+			TransactionHash: log.TransactionHash,
+			LogIndex:        decoded.LogIndex,
+			BlockNumber:     blockNum,
+			BlockHash:       block.Hash,
+		})
+	}
+	return transfers, nil
+}
+
+// topicAddress extracts the address from a 32-byte indexed topic.
+func topicAddress(topic string) (string, bool) {
+	if len(topic) != 66 || !strings.HasPrefix(topic, "0x") {
+		return "", false
+	}
+	return "0x" + strings.ToLower(topic[26:]), true
+}
+
+// wordToInt decodes data holding exactly one 32-byte unsigned integer.
+func wordToInt(data string) (*big.Int, bool) {
+	if len(data) != 66 || !strings.HasPrefix(data, "0x") {
+		return nil, false
+	}
+	return new(big.Int).SetString(data[2:], 16)
+}
+
+func (s *Service) GetTokenTransfers(ctx context.Context, address string) ([]entity.TokenTransfer, error) {
+	s.logger.Debug("Retrieving token transfers",
+		zap.String("address", address),
+	)
+
+	transfers, err := s.store.GetTokenTransfers(ctx, address)
+	if err != nil {
+		return nil, errors.NewStorageError("failed to get token transfers", err)
+	}
+	return transfers, nil
+}
@@ -0,0 +1,349 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// TraceMode selects which tracing API internal transfers are read from.
+type TraceMode string
+
+const (
+	// TraceOff disables tracing.
+	TraceOff TraceMode = "off"
+	// TraceDebug uses debug_traceBlockByNumber with the callTracer (Geth,
+	// Reth and most hosted providers).
+	TraceDebug TraceMode = "debug"
+	// TraceParity uses trace_block (Erigon, Nethermind).
+	TraceParity TraceMode = "trace"
+	// TraceAuto tries TraceDebug, then TraceParity.
+	TraceAuto TraceMode = "auto"
+)
+
+// method is the JSON-RPC method the mode traces blocks with.
+func (m TraceMode) method() string {
+	switch m {
+	case TraceDebug:
+		return "debug_traceBlockByNumber"
+	case TraceParity:
+		return "trace_block"
+	}
+	return ""
+}
+
+// ParseTraceMode accepts "off", "debug", "trace" or "auto". An empty value
+// means "off".
+func ParseTraceMode(value string) (TraceMode, error) {
+	mode := TraceMode(strings.TrimSpace(strings.ToLower(value)))
+	switch mode {
+	case "":
+		return TraceOff, nil
+	case TraceOff, TraceDebug, TraceParity, TraceAuto:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid trace mode %q: want off, debug, trace or auto", value)
+}
+
+// callFrame is one call in a callTracer result.
+type callFrame struct {
+	Type  string      `json:"type"`
+	From  string      `json:"from"`
+	To    string      `json:"to"`
+	Value string      `json:"value"`
+	Error string      `json:"error"`
+	Calls []callFrame `json:"calls"`
+}
+
+// txTrace is one transaction's entry in a debug_traceBlockByNumber result.
+type txTrace struct {
+	TxHash string    `json:"txHash"`
+	Result callFrame `json:"result"`
+	Error  string    `json:"error"`
+}
+
+// parityTrace is one call in a trace_block result.
+type parityTrace struct {
+	Type   string `json:"type"`
+	Action struct {
+		CallType       string `json:"callType"`
+		CreationMethod string `json:"creationMethod"`
+		From           string `json:"from"`
+		To             string `json:"to"`
+		Value          string `json:"value"`
+		Address        string `json:"address"`
+		RefundAddress  string `json:"refundAddress"`
+		Balance        string `json:"balance"`
+	} `json:"action"`
+	Result *struct {
+		Address string `json:"address"`
+	} `json:"result"`
+	Error           string `json:"error"`
+	TraceAddress    []int  `json:"traceAddress"`
+	TransactionHash string `json:"transactionHash"`
+	BlockHash       string `json:"blockHash"`
+}
+
+// traceInternalTransfers returns the value-bearing internal calls of the
+// block accepted by match. It returns nothing when tracing is off or the node
+// turned out not to support any of the configured tracing APIs. Only a
+// rejected method moves state on to another API; any other failure, such as
+// pruned state, is returned so the block is retried.
+func (s *Service) traceInternalTransfers(ctx context.Context, state *fetchState, blockNum int, block *Block, match matchFunc) ([]entity.InternalTransfer, error) {
+	for {
+		tracer := state.tracer.Load().(TraceMode)
+
+		var transfers []entity.InternalTransfer
+		var err error
+		switch tracer {
+		case TraceDebug:
+			transfers, err = s.traceDebug(ctx, blockNum, block)
+		case TraceParity:
+			transfers, err = s.traceParity(ctx, blockNum, block)
+		default:
+			return nil, nil
+		}
+		if err != nil {
+			if !ethereum.IsMethodUnsupported(err, tracer.method()) {
+				return nil, errors.NewEthereumError(fmt.Sprintf("failed to trace block %d", blockNum), err)
+			}
+			s.disableTracer(state, tracer, err)
+			continue
+		}
+
+		var matched []entity.InternalTransfer
+		for _, transfer := range transfers {
+			ok, err := match(transfer.From, transfer.To)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				transfer.BlockNumber = blockNum
+				transfer.BlockHash = block.Hash
+				matched = append(matched, transfer)
+			}
+		}
+		return matched, nil
+	}
+}
+
+// disableTracer moves state on from a tracing API the node does not support:
+// to trace_block in auto mode, otherwise to no tracing at all.
+func (s *Service) disableTracer(state *fetchState, tracer TraceMode, err error) {
+	next := TraceOff
+	if s.traceMode == TraceAuto && tracer == TraceDebug {
+		next = TraceParity
+	}
+	if !state.tracer.CompareAndSwap(tracer, next) {
+		return
+	}
+	if next == TraceOff {
+		s.logger.Warn("Tracing unavailable on the node, internal transfers will not be recorded",
+			zap.String("trace_mode", string(tracer)),
+			zap.Error(err),
+		)
+		return
+	}
+	s.logger.Info("debug_traceBlockByNumber unavailable, tracing with trace_block",
+		zap.Error(err),
+	)
+}
+
+func (s *Service) traceDebug(ctx context.Context, blockNum int, block *Block) ([]entity.InternalTransfer, error) {
+	response, err := s.client.MakeRPCCall(ctx, TraceDebug.method(), []interface{}{
+		fmt.Sprintf("0x%x", blockNum),
+		map[string]interface{}{"tracer": "callTracer"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var traces []txTrace
+	if err := decodeResult(response, &traces); err != nil {
+		return nil, err
+	}
+	if len(traces) != len(block.Transactions) {
+		// The block was replaced between fetching it and tracing it
+		return nil, errors.NewEthereumError(
+			fmt.Sprintf("traced %d transactions, block has %d", len(traces), len(block.Transactions)), nil)
+	}
+
+	var transfers []entity.InternalTransfer
+	for i, trace := range traces {
+		hash := block.Transactions[i].Hash
+		if trace.TxHash != "" && !strings.EqualFold(trace.TxHash, hash) {
+			return nil, errors.NewEthereumError(
+				fmt.Sprintf("trace for transaction %s belongs to another block", trace.TxHash), nil)
+		}
+		if trace.Error != "" {
+			return nil, errors.NewEthereumError(
+				fmt.Sprintf("failed to trace transaction %s: %s", hash, trace.Error), nil)
+		}
+		if trace.Result.Error != "" {
+			// The transaction reverted, undoing every call it made
+			continue
+		}
+		// The top-level call is the transaction itself
+		for j, call := range trace.Result.Calls {
+			if transfers, err = walkCalls(transfers, hash, []int{j}, call); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return transfers, nil
+}
+
+// walkCalls appends the value-bearing calls in the tree rooted at call.
+// Failed calls are skipped along with everything below them, as their
+// effects were reverted.
+func walkCalls(transfers []entity.InternalTransfer, hash string, path []int, call callFrame) ([]entity.InternalTransfer, error) {
+	if call.Error != "" {
+		return transfers, nil
+	}
+
+	callType := strings.ToUpper(call.Type)
+	if movesValue(callType) {
+		value, err := ethereum.ParseQuantity(call.Value)
+		if err != nil {
+			return nil, errors.NewValidationError(fmt.Sprintf("invalid call value in transaction %s", hash), err)
+		}
+		if value.Sign() > 0 {
+			transfers = append(transfers, entity.InternalTransfer{
+				TransactionHash: hash,
+				TracePath:       append([]int(nil), path...),
+				CallType:        callType,
+				From:            call.From,
+				To:              call.To,
+				Value:           value,
+			})
+		}
+	}
+
+	var err error
+	for i, child := range call.Calls {
+		if transfers, err = walkCalls(transfers, hash, append(path[:len(path):len(path)], i), child); err != nil {
+			return nil, err
+		}
+	}
+	return transfers, nil
+}
+
+func (s *Service) traceParity(ctx context.Context, blockNum int, block *Block) ([]entity.InternalTransfer, error) {
+	response, err := s.client.MakeRPCCall(ctx, TraceParity.method(), []interface{}{fmt.Sprintf("0x%x", blockNum)})
+	if err != nil {
+		return nil, err
+	}
+
+	var traces []parityTrace
+	if err := decodeResult(response, &traces); err != nil {
+		return nil, err
+	}
+
+	// Calls below a failed call are reverted with it
+	failed := make(map[string]bool)
+	var transfers []entity.InternalTransfer
+	for _, trace := range traces {
+		if trace.TransactionHash == "" {
+			// Block and uncle rewards
+			continue
+		}
+		if block.Hash != "" && trace.BlockHash != "" && !strings.EqualFold(trace.BlockHash, block.Hash) {
+			return nil, errors.NewEthereumError(
+				fmt.Sprintf("trace for transaction %s belongs to another block", trace.TransactionHash), nil)
+		}
+		if revertedTrace(failed, trace) {
+			continue
+		}
+		if trace.Error != "" {
+			failed[traceKey(trace.TransactionHash, trace.TraceAddress)] = true
+			continue
+		}
+		if len(trace.TraceAddress) == 0 {
+			// The top-level call is the transaction itself
+			continue
+		}
+
+		transfer := entity.InternalTransfer{
+			TransactionHash: trace.TransactionHash,
+			TracePath:       trace.TraceAddress,
+		}
+		var value string
+		switch trace.Type {
+		case "call":
+			transfer.CallType = strings.ToUpper(trace.Action.CallType)
+			transfer.From = trace.Action.From
+			transfer.To = trace.Action.To
+			value = trace.Action.Value
+		case "create":
+			transfer.CallType = "CREATE"
+			if trace.Action.CreationMethod != "" {
+				transfer.CallType = strings.ToUpper(trace.Action.CreationMethod)
+			}
+			transfer.From = trace.Action.From
+			if trace.Result != nil {
+				transfer.To = trace.Result.Address
+			}
+			value = trace.Action.Value
+		case "suicide":
+			transfer.CallType = "SELFDESTRUCT"
+			transfer.From = trace.Action.Address
+			transfer.To = trace.Action.RefundAddress
+			value = trace.Action.Balance
+		default:
+			continue
+		}
+		if !movesValue(transfer.CallType) {
+			continue
+		}
+
+		if transfer.Value, err = ethereum.ParseQuantity(value); err != nil {
+			return nil, errors.NewValidationError(
+				fmt.Sprintf("invalid call value in transaction %s", trace.TransactionHash), err)
+		}
+		if transfer.Value.Sign() > 0 {
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers, nil
+}
+
+// revertedTrace reports whether any call above trace failed.
+func revertedTrace(failed map[string]bool, trace parityTrace) bool {
+	for depth := 0; depth < len(trace.TraceAddress); depth++ {
+		if failed[traceKey(trace.TransactionHash, trace.TraceAddress[:depth])] {
+			return true
+		}
+	}
+	return false
+}
+
+func traceKey(hash string, path []int) string {
+	return strings.ToLower(hash) + fmt.Sprint(path)
+}
+
+// movesValue reports whether a call of this type moves its value to its
+// target. DELEGATECALL and CALLCODE run foreign code in the caller's context
+// and STATICCALL cannot carry value.
+func movesValue(callType string) bool {
+	switch callType {
+	case "CALL", "CREATE", "CREATE2", "SELFDESTRUCT":
+		return true
+	}
+	return false
+}
+
+func (s *Service) GetInternalTransfers(ctx context.Context, address string) ([]entity.InternalTransfer, error) {
+	s.logger.Debug("Retrieving internal transfers",
+		zap.String("address", address),
+	)
+
+	transfers, err := s.store.GetInternalTransfers(ctx, address)
+	if err != nil {
+		return nil, errors.NewStorageError("failed to get internal transfers", err)
+	}
+	return transfers, nil
+}
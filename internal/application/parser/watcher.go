@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/internal/domain/repository"
+	"github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"go.uber.org/zap"
+	"time"
+)
+
+// defaultPollInterval is used when Watch is given no usable poll interval.
+const defaultPollInterval = 15 * time.Second
+
+// Watch keeps parsing blocks until the context is cancelled. With a head
+// subscriber every new head triggers a parse, and heads that arrive while a
+// parse is running collapse into one follow-up run. The poll interval acts as
+// a watchdog that parses when no head has arrived for that long, and becomes
+// the only trigger when subscriber is nil or the node cannot stream heads.
+func (s *Service) Watch(ctx context.Context, subscriber repository.HeadSubscriber, pollInterval time.Duration) {
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+
+	var heads <-chan entity.BlockHeader
+	if subscriber != nil {
+		heads, subscriber = s.subscribeHeads(ctx, subscriber)
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	s.parse(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Stopping block parser")
+			return
+		case head, ok := <-heads:
+			if !ok {
+				// The subscription ended; keep polling and try again on the next tick
+				heads = nil
+				continue
+			}
+			s.logger.Debug("New chain head",
+				zap.Int("block_number", head.Number),
+				zap.String("hash", head.Hash),
+			)
+			s.parse(ctx)
+			ticker.Reset(pollInterval)
+		case <-ticker.C:
+			if heads == nil && subscriber != nil {
+				heads, subscriber = s.subscribeHeads(ctx, subscriber)
+			}
+			s.parse(ctx)
+		}
+	}
+}
+
+// subscribeHeads starts a head subscription. It returns a nil subscriber when
+// the node does not support subscriptions so the caller stops retrying.
+func (s *Service) subscribeHeads(ctx context.Context, subscriber repository.HeadSubscriber) (<-chan entity.BlockHeader, repository.HeadSubscriber) {
+	heads, err := subscriber.SubscribeNewHeads(ctx)
+	if errors.Is(err, ethereum.ErrSubscriptionsUnsupported) {
+		s.logger.Warn("Node does not support head subscriptions, falling back to polling",
+			zap.Error(err),
+		)
+		return nil, nil
+	}
+	if err != nil {
+		s.logger.Warn("Failed to subscribe to new heads, polling until it succeeds",
+			zap.Error(err),
+		)
+		return nil, subscriber
+	}
+	s.logger.Info("Subscribed to new heads")
+	return heads, subscriber
+}
+
+func (s *Service) parse(ctx context.Context) {
+	if err := s.ParseBlocks(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		s.logger.Error("Error parsing blocks", zap.Error(err))
+	}
+}
@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/errors"
+	"github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"go.uber.org/zap"
+	"math/big"
+)
+
+// weiPerGwei converts withdrawal amounts, which nodes report in gwei.
+var weiPerGwei = big.NewInt(1_000_000_000)
+
+// blockWithdrawal is a beacon chain withdrawal as listed in a block.
+type blockWithdrawal struct {
+	Index          string `json:"index"`
+	ValidatorIndex string `json:"validatorIndex"`
+	Address        string `json:"address"`
+	Amount         string `json:"amount"`
+}
+
+// extractWithdrawals returns the block's withdrawals paid to addresses
+// accepted by match.
+func extractWithdrawals(blockNum int, block *Block, match matchFunc) ([]entity.Withdrawal, error) {
+	var withdrawals []entity.Withdrawal
+	for _, raw := range block.Withdrawals {
+		matched, err := match(raw.Address)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+
+		withdrawal, err := raw.toEntity(blockNum, block)
+		if err != nil {
+			return nil, errors.NewValidationError(
+				fmt.Sprintf("invalid withdrawal in block %d", blockNum), err)
+		}
+		withdrawals = append(withdrawals, withdrawal)
+	}
+	return withdrawals, nil
+}
+
+func (w blockWithdrawal) toEntity(blockNum int, block *Block) (entity.Withdrawal, error) {
+	index, err := parseQuantity(w.Index)
+	if err != nil {
+		return entity.Withdrawal{}, fmt.Errorf("invalid index: %v", err)
+	}
+	validatorIndex, err := parseQuantity(w.ValidatorIndex)
+	if err != nil {
+		return entity.Withdrawal{}, fmt.Errorf("invalid validatorIndex: %v", err)
+	}
+	amount, err := ethereum.ParseQuantity(w.Amount)
+	if err != nil {
+		return entity.Withdrawal{}, fmt.Errorf("invalid amount: %v", err)
+	}
+	timestamp, err := parseQuantity(block.Timestamp)
+	if err != nil {
+		return entity.Withdrawal{}, fmt.Errorf("invalid timestamp: %v", err)
+	}
+
+	return entity.Withdrawal{
+		Index:          index,
+		ValidatorIndex: validatorIndex,
+		Address:        w.Address,
+		Amount:         amount.Mul(amount, weiPerGwei),
+		BlockNumber:    blockNum,
+		BlockHash:      block.Hash,
+		BlockTimestamp: int64(timestamp),
+	}, nil
+}
+
+// GetWithdrawals returns the beacon chain withdrawals credited to the address.
+func (s *Service) GetWithdrawals(ctx context.Context, address string) ([]entity.Withdrawal, error) {
+	s.logger.Debug("Retrieving withdrawals",
+		zap.String("address", address),
+	)
+
+	withdrawals, err := s.store.GetWithdrawals(ctx, address)
+	if err != nil {
+		return nil, errors.NewStorageError("failed to get withdrawals", err)
+	}
+	return withdrawals, nil
+}
@@ -0,0 +1,40 @@
+package entity
+
+import "time"
+
+// BackfillStatus is the lifecycle state of a historical backfill job.
+type BackfillStatus string
+
+const (
+	BackfillQueued    BackfillStatus = "queued"
+	BackfillRunning   BackfillStatus = "running"
+	BackfillCompleted BackfillStatus = "completed"
+	BackfillFailed    BackfillStatus = "failed"
+	BackfillCancelled BackfillStatus = "cancelled"
+)
+
+// BackfillJob scans a historical block range for one address's transactions.
+// FromBlock is resolved from FromTime when the job starts if only a time was
+// given; ToBlock is the block live parsing had reached at that point. Found
+// and Added count transactions, token, NFT and internal transfers and
+// withdrawals together.
+type BackfillJob struct {
+	ID             int            `json:"id"`
+	Address        string         `json:"address"`
+	Status         BackfillStatus `json:"status"`
+	FromBlock      int            `json:"from_block"`
+	FromTime       *time.Time     `json:"from_time,omitempty"`
+	ToBlock        int            `json:"to_block"`
+	ProcessedBlock int            `json:"processed_block"`
+	Found          int            `json:"found"`
+	Added          int            `json:"added"`
+	Error          string         `json:"error,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	StartedAt      *time.Time     `json:"started_at,omitempty"`
+	FinishedAt     *time.Time     `json:"finished_at,omitempty"`
+}
+
+// Done reports whether the job has reached a final state.
+func (j BackfillJob) Done() bool {
+	return j.Status == BackfillCompleted || j.Status == BackfillFailed || j.Status == BackfillCancelled
+}
@@ -0,0 +1,28 @@
+package entity
+
+// BlockHeader records the identity of a processed block so that chain
+// reorganizations can be detected by comparing parent hashes. Timestamp is
+// the block's Unix time in seconds, or zero when it was not recorded.
+type BlockHeader struct {
+	Number     int
+	Hash       string
+	ParentHash string
+	Timestamp  int64
+}
+
+// BlockCommit is everything processing one block adds to the store: the
+// addresses the block subscribes, the relevant records, under whichever of
+// their addresses are subscribed, and the block's header, which also becomes
+// the current block.
+type BlockCommit struct {
+	Header BlockHeader
+	// Subscriptions are subscribed before the records are stored, such as
+	// contracts deployed by subscribed addresses. Rolling the block back
+	// unsubscribes them again unless they were also subscribed directly.
+	Subscriptions     []string
+	Transactions      []Transaction
+	TokenTransfers    []TokenTransfer
+	NFTTransfers      []NFTTransfer
+	InternalTransfers []InternalTransfer
+	Withdrawals       []Withdrawal
+}
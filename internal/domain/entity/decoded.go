@@ -0,0 +1,30 @@
+package entity
+
+// DecodedCall is a transaction's input decoded against a known ABI.
+// Signature is the canonical function signature, such as
+// "transfer(address,uint256)", and Source says where the ABI came from.
+type DecodedCall struct {
+	Method    string
+	Signature string
+	Selector  string
+	Source    string
+	Args      []DecodedArg
+}
+
+// Sources a DecodedCall can come from.
+const (
+	// DecodeSourceContract is an ABI uploaded for the called contract.
+	DecodeSourceContract = "contract"
+	// DecodeSourceBuiltin is the built-in table of common selectors, which
+	// has no argument names.
+	DecodeSourceBuiltin = "builtin"
+)
+
+// DecodedArg is one decoded argument. Value is a decimal string for
+// integers, 0x-prefixed hex for addresses and bytes, a bool or string, a list
+// of values for arrays and a list of DecodedArg for tuples.
+type DecodedArg struct {
+	Name  string
+	Type  string
+	Value interface{}
+}
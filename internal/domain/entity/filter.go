@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"math/big"
+	"time"
+)
+
+// TransactionFilter narrows the transactions returned for an address.
+// Zero values leave the corresponding criterion unrestricted.
+type TransactionFilter struct {
+	MinStatus TransactionStatus
+	// ExcludeReverted drops transactions whose receipt shows they failed.
+	ExcludeReverted bool
+	// MinValue and MaxValue bound the transferred wei, inclusively.
+	MinValue *big.Int
+	MaxValue *big.Int
+	// FromBlock and ToBlock bound the block number, inclusively.
+	FromBlock int
+	ToBlock   int
+	// FromTime and ToTime bound the block timestamp, inclusively.
+	FromTime time.Time
+	ToTime   time.Time
+}
+
+// Matches reports whether the transaction satisfies every set criterion.
+func (f TransactionFilter) Matches(tx Transaction) bool {
+	if f.MinStatus != "" && !tx.Status.AtLeast(f.MinStatus) {
+		return false
+	}
+	if f.ExcludeReverted && tx.Reverted() {
+		return false
+	}
+	if f.MinValue != nil && tx.ValueOrZero().Cmp(f.MinValue) < 0 {
+		return false
+	}
+	if f.MaxValue != nil && tx.ValueOrZero().Cmp(f.MaxValue) > 0 {
+		return false
+	}
+	if f.FromBlock != 0 && tx.BlockNumber < f.FromBlock {
+		return false
+	}
+	if f.ToBlock != 0 && tx.BlockNumber > f.ToBlock {
+		return false
+	}
+	if !f.FromTime.IsZero() && tx.BlockTimestamp < f.FromTime.Unix() {
+		return false
+	}
+	if !f.ToTime.IsZero() && tx.BlockTimestamp > f.ToTime.Unix() {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,19 @@
+package entity
+
+import "math/big"
+
+// InternalTransfer is ETH moved by a call inside a transaction rather than by
+// the transaction itself, such as a contract paying out to a subscribed
+// address. TracePath locates the call in the transaction's call tree: the
+// indexes of the subcalls leading to it, starting below the top-level call.
+// Value is the exact amount of wei moved.
+type InternalTransfer struct {
+	TransactionHash string
+	TracePath       []int
+	CallType        string
+	From            string
+	To              string
+	Value           *big.Int
+	BlockNumber     int
+	BlockHash       string
+}
@@ -0,0 +1,25 @@
+package entity
+
+// NFT standards an NFTTransfer can come from.
+const (
+	StandardERC721  = "erc721"
+	StandardERC1155 = "erc1155"
+)
+
+// NFTTransfer is an ERC-721 Transfer or ERC-1155 TransferSingle/TransferBatch
+// event involving a subscribed address. TokenIDs and Quantities are decimal
+// strings at matching positions; ERC-721 transfers move a quantity of 1, and
+// only ERC-1155 transfers have an Operator.
+type NFTTransfer struct {
+	Contract        string
+	Standard        string
+	Operator        string
+	From            string
+	To              string
+	TokenIDs        []string
+	Quantities      []string
+	TransactionHash string
+	LogIndex        int
+	BlockNumber     int
+	BlockHash       string
+}
@@ -0,0 +1,29 @@
+package entity
+
+// Receipt statuses. Receipts from before the Byzantium fork carry no status
+// and report ReceiptStatusUnknown.
+const (
+	ReceiptStatusUnknown = -1
+	ReceiptStatusFailed  = 0
+	ReceiptStatusSuccess = 1
+)
+
+// Receipt is the execution outcome of a transaction. EffectiveGasPrice is
+// the hex wei quantity the node returned.
+type Receipt struct {
+	Status            int
+	GasUsed           uint64
+	EffectiveGasPrice string
+	CumulativeGasUsed uint64
+	// ContractAddress is set when the transaction created a contract.
+	ContractAddress string
+	Logs            []Log
+}
+
+// Log is an event emitted while executing a transaction.
+type Log struct {
+	Address  string
+	Topics   []string
+	Data     string
+	LogIndex int
+}
@@ -0,0 +1,30 @@
+package entity
+
+// TransactionStatus describes how settled a transaction's block is.
+type TransactionStatus string
+
+const (
+	StatusUnconfirmed TransactionStatus = "unconfirmed"
+	StatusConfirmed   TransactionStatus = "confirmed"
+	StatusSafe        TransactionStatus = "safe"
+	StatusFinalized   TransactionStatus = "finalized"
+)
+
+var statusRanks = map[TransactionStatus]int{
+	StatusUnconfirmed: 0,
+	StatusConfirmed:   1,
+	StatusSafe:        2,
+	StatusFinalized:   3,
+}
+
+// ParseTransactionStatus validates a status name received from outside.
+func ParseTransactionStatus(value string) (TransactionStatus, bool) {
+	status := TransactionStatus(value)
+	_, ok := statusRanks[status]
+	return status, ok
+}
+
+// AtLeast reports whether s is as settled as other.
+func (s TransactionStatus) AtLeast(other TransactionStatus) bool {
+	return statusRanks[s] >= statusRanks[other]
+}
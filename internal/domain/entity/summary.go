@@ -0,0 +1,15 @@
+package entity
+
+import "math/big"
+
+// TransactionSummary aggregates an address's transactions exactly, in wei.
+// Received and Sent only count transactions that did not revert, as those
+// moved no value; FeesPaid covers every sent transaction with a receipt,
+// reverted or not.
+type TransactionSummary struct {
+	Address  string
+	Count    int
+	Received *big.Int
+	Sent     *big.Int
+	FeesPaid *big.Int
+}
@@ -0,0 +1,15 @@
+package entity
+
+// TokenTransfer is an ERC-20 Transfer event involving a subscribed address.
+// Amount is the raw token amount as a decimal string, not scaled by the
+// token's decimals.
+type TokenTransfer struct {
+	Token           string
+	From            string
+	To              string
+	Amount          string
+	TransactionHash string
+	LogIndex        int
+	BlockNumber     int
+	BlockHash       string
+}
@@ -1,9 +1,58 @@
 package entity
 
+import "math/big"
+
+// Transaction is a transaction involving a subscribed address. Value is the
+// exact amount of wei transferred; the fee fields are kept as the hex
+// quantities the node returned and are empty when they do not apply to the
+// transaction type.
 type Transaction struct {
 	Hash        string
 	From        string
 	To          string
-	Value       string
+	Value       *big.Int
 	BlockNumber int
+	Status      TransactionStatus
+
+	Nonce                uint64
+	Gas                  uint64
+	GasPrice             string
+	MaxFeePerGas         string
+	MaxPriorityFeePerGas string
+	Input                string
+	Type                 int
+	ChainID              uint64
+	TransactionIndex     int
+	BlockHash            string
+	// BlockTimestamp is the block's Unix time in seconds.
+	BlockTimestamp int64
+
+	// CreatedContract is the address of the contract a successful contract
+	// creation deployed, taken from its receipt.
+	CreatedContract string
+
+	// Receipt is nil until the transaction's receipt has been fetched.
+	Receipt *Receipt
+	// Decoded is the decoded Input, filled in when transactions are read and
+	// the called function is known; nil otherwise.
+	Decoded *DecodedCall
+}
+
+// IsContractCreation reports whether the transaction deploys a contract,
+// which leaves To empty.
+func (t Transaction) IsContractCreation() bool {
+	return t.To == ""
+}
+
+// Reverted reports whether the transaction's receipt shows it failed.
+func (t Transaction) Reverted() bool {
+	return t.Receipt != nil && t.Receipt.Status == ReceiptStatusFailed
+}
+
+// ValueOrZero returns Value, or zero when it is not set.
+func (t Transaction) ValueOrZero() *big.Int {
+	if t.Value == nil {
+		return new(big.Int)
+	}
+	return t.Value
 }
@@ -0,0 +1,18 @@
+package entity
+
+import "math/big"
+
+// Withdrawal is a beacon chain withdrawal crediting a subscribed address.
+// Withdrawals are not transactions: the block's withdrawals list pays them
+// out directly. Amount is the credited wei; nodes report it in gwei.
+type Withdrawal struct {
+	// Index is the withdrawal's sequence number, unique across the chain.
+	Index          uint64
+	ValidatorIndex uint64
+	Address        string
+	Amount         *big.Int
+	BlockNumber    int
+	BlockHash      string
+	// BlockTimestamp is the block's Unix time in seconds.
+	BlockTimestamp int64
+}
@@ -1,9 +1,12 @@
 package repository
 
-import "github.com/grokkos/ether-tx-parser/internal/domain/entity"
+import (
+	"context"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+)
 
 type Parser interface {
-	GetCurrentBlock() int
-	Subscribe(address string) bool
-	GetTransactions(address string) []entity.Transaction
+	GetCurrentBlock(ctx context.Context) (int, error)
+	Subscribe(ctx context.Context, address string) (bool, error)
+	GetTransactions(ctx context.Context, address string, filter entity.TransactionFilter) ([]entity.Transaction, error)
 }
@@ -1,20 +1,109 @@
 package repository
 
 import (
+	"context"
 	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
 	"github.com/grokkos/ether-tx-parser/pkg/ethereum"
 )
 
 type Store interface {
-	GetCurrentBlock() int
-	SetCurrentBlock(block int)
-	Subscribe(address string) bool
-	IsSubscribed(address string) bool
-	GetTransactions(address string) []entity.Transaction
-	AddTransaction(tx entity.Transaction)
+	GetCurrentBlock(ctx context.Context) (int, error)
+	SetCurrentBlock(ctx context.Context, block int) error
+	Subscribe(ctx context.Context, address string) (bool, error)
+	IsSubscribed(ctx context.Context, address string) (bool, error)
+	// GetSubscriptions lists the subscribed addresses, lowercased and sorted.
+	GetSubscriptions(ctx context.Context) ([]string, error)
+	GetTransactions(ctx context.Context, address string) ([]entity.Transaction, error)
+	// IsHistoryTruncated reports whether a retention policy evicted some of
+	// the address's transactions, so its history is incomplete.
+	IsHistoryTruncated(ctx context.Context, address string) (bool, error)
+	// AddTransaction stores a transaction under whichever of its from and to
+	// addresses are subscribed, replacing one with the same hash, so storing
+	// it again or a self-transfer never leaves duplicates.
+	AddTransaction(ctx context.Context, tx entity.Transaction) error
+	// MergeTransactions adds historical transactions to one address's
+	// history, skipping hashes it already holds, and returns how many were
+	// added. The history stays ordered by block number.
+	MergeTransactions(ctx context.Context, address string, txs []entity.Transaction) (int, error)
+
+	// AddTokenTransfer stores a token transfer under whichever of its from and
+	// to addresses are subscribed, replacing one with the same transaction
+	// hash and log index.
+	AddTokenTransfer(ctx context.Context, transfer entity.TokenTransfer) error
+	// MergeTokenTransfers adds historical token transfers to one address,
+	// skipping ones it already holds, and returns how many were added.
+	MergeTokenTransfers(ctx context.Context, address string, transfers []entity.TokenTransfer) (int, error)
+	GetTokenTransfers(ctx context.Context, address string) ([]entity.TokenTransfer, error)
+
+	// AddNFTTransfer stores an NFT transfer under whichever of its from and
+	// to addresses are subscribed, replacing one with the same transaction
+	// hash and log index.
+	AddNFTTransfer(ctx context.Context, transfer entity.NFTTransfer) error
+	// MergeNFTTransfers adds historical NFT transfers to one address,
+	// skipping ones it already holds, and returns how many were added.
+	MergeNFTTransfers(ctx context.Context, address string, transfers []entity.NFTTransfer) (int, error)
+	GetNFTTransfers(ctx context.Context, address string) ([]entity.NFTTransfer, error)
+
+	// AddInternalTransfer stores a traced internal transfer under whichever of
+	// its from and to addresses are subscribed, replacing one with the same
+	// transaction hash and trace path.
+	AddInternalTransfer(ctx context.Context, transfer entity.InternalTransfer) error
+	// MergeInternalTransfers adds historical internal transfers to one
+	// address, skipping ones it already holds, and returns how many were added.
+	MergeInternalTransfers(ctx context.Context, address string, transfers []entity.InternalTransfer) (int, error)
+	GetInternalTransfers(ctx context.Context, address string) ([]entity.InternalTransfer, error)
+
+	// AddWithdrawal stores a beacon chain withdrawal under its address, which
+	// must be subscribed, replacing one with the same index.
+	AddWithdrawal(ctx context.Context, withdrawal entity.Withdrawal) error
+	// MergeWithdrawals adds historical withdrawals to one address, skipping
+	// indexes it already holds, and returns how many were added.
+	MergeWithdrawals(ctx context.Context, address string, withdrawals []entity.Withdrawal) (int, error)
+	GetWithdrawals(ctx context.Context, address string) ([]entity.Withdrawal, error)
+
+	// SaveContractABI stores the JSON ABI uploaded for a contract address,
+	// replacing any earlier one.
+	SaveContractABI(ctx context.Context, address string, abi []byte) error
+	GetContractABI(ctx context.Context, address string) ([]byte, bool, error)
+	// GetContractABIs returns every uploaded ABI by lowercase contract address.
+	GetContractABIs(ctx context.Context) (map[string][]byte, error)
+
+	// SaveBlockHeader remembers the hash, parent hash and timestamp of a
+	// processed block.
+	SaveBlockHeader(ctx context.Context, header entity.BlockHeader) error
+	// GetBlockHeader returns the header recorded for the given block number.
+	GetBlockHeader(ctx context.Context, number int) (entity.BlockHeader, bool, error)
+	// PruneBlockHeaders forgets headers below the given block number.
+	PruneBlockHeaders(ctx context.Context, before int) error
+	// CommitBlock stores a processed block's subscriptions, records and
+	// header and advances the current block to it, all or nothing.
+	// Committing a block again after it succeeded, with the same hash,
+	// changes nothing.
+	CommitBlock(ctx context.Context, commit entity.BlockCommit) error
+	// RollbackTo discards transactions, transfers, withdrawals, headers and
+	// commit subscriptions recorded for blocks above the given block number
+	// and rewinds the current block to it.
+	RollbackTo(ctx context.Context, block int) error
 }
 
 // EthereumClient defines the interface for interacting with Ethereum nodes.
 type EthereumClient interface {
-	MakeRPCCall(method string, params []interface{}) (*ethereum.JSONRPCResponse, error)
+	MakeRPCCall(ctx context.Context, method string, params []interface{}) (*ethereum.JSONRPCResponse, error)
+	// BatchRPCCall sends several requests in one round-trip and returns their
+	// responses in request order; per-request failures are set on Error.
+	BatchRPCCall(ctx context.Context, requests []ethereum.JSONRPCRequest) ([]*ethereum.JSONRPCResponse, error)
+}
+
+// HeadSubscriber pushes new chain heads as the node sees them. It returns
+// ethereum.ErrSubscriptionsUnsupported when the node cannot stream heads.
+type HeadSubscriber interface {
+	SubscribeNewHeads(ctx context.Context) (<-chan entity.BlockHeader, error)
+}
+
+// Checkpoint durably records the last block the parser committed, separately
+// from the transaction store, so a restart can resume where it stopped.
+type Checkpoint interface {
+	// Load returns the saved header, or false when nothing was saved yet.
+	Load(ctx context.Context) (entity.BlockHeader, bool, error)
+	Save(ctx context.Context, header entity.BlockHeader) error
 }
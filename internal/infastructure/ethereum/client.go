@@ -2,21 +2,60 @@ package ethereum
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	ethtypes "github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"github.com/grokkos/ether-tx-parser/pkg/logger"
+	"go.uber.org/zap"
+	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"time"
 )
 
+// maxRetryDelay caps the exponential backoff between attempts.
+const maxRetryDelay = 30 * time.Second
+
+// rateLimitCodes are JSON-RPC error codes providers use for throttling.
+var rateLimitCodes = map[int]bool{
+	-32005: true, // Infura, geth: limit exceeded
+	-32007: true, // QuickNode: request limit reached
+	-32090: true, // Chainstack: too many requests
+	429:    true, // Alchemy: too many requests
+}
+
+// RetryPolicy controls how failed RPC calls are retried.
+type RetryPolicy struct {
+	// Attempts is the total number of tries per call, including the first.
+	Attempts int
+	// BaseDelay is the backoff before the first retry; it doubles after each
+	// failed attempt up to maxRetryDelay.
+	BaseDelay time.Duration
+}
+
 type Client struct {
-	rpcURL string
+	rpcURL     string
+	httpClient *http.Client
+	retry      RetryPolicy
+	logger     *zap.Logger
 }
 
-func NewClient(rpcURL string) *Client {
-	return &Client{rpcURL: rpcURL}
+func NewClient(rpcURL string, retry RetryPolicy, timeout time.Duration) *Client {
+	if retry.Attempts < 1 {
+		retry.Attempts = 1
+	}
+	return &Client{
+		rpcURL:     rpcURL,
+		httpClient: &http.Client{Timeout: timeout},
+		retry:      retry,
+		logger:     logger.GetLogger(),
+	}
 }
 
-func (c *Client) MakeRPCCall(method string, params []interface{}) (*ethtypes.JSONRPCResponse, error) {
+func (c *Client) MakeRPCCall(ctx context.Context, method string, params []interface{}) (*ethtypes.JSONRPCResponse, error) {
 	request := ethtypes.JSONRPCRequest{
 		JsonRPC: "2.0",
 		Method:  method,
@@ -29,16 +68,241 @@ func (c *Client) MakeRPCCall(method string, params []interface{}) (*ethtypes.JSO
 		return nil, fmt.Errorf("error marshaling request: %v", err)
 	}
 
-	resp, err := http.Post(c.rpcURL, "application/json", bytes.NewBuffer(requestBody))
+	var response ethtypes.JSONRPCResponse
+	err = c.withRetry(ctx, method, func() error {
+		body, err := c.post(ctx, requestBody)
+		if err != nil {
+			return err
+		}
+
+		response = ethtypes.JSONRPCResponse{}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return &decodeError{err: err}
+		}
+		if response.Error != nil {
+			return response.Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// BatchRPCCall sends all requests in a single JSON-RPC batch. Request IDs are
+// assigned by the client, and responses are returned in request order after
+// matching them by ID. Failures of individual requests are reported through
+// the Error field of their response rather than the returned error.
+func (c *Client) BatchRPCCall(ctx context.Context, requests []ethtypes.JSONRPCRequest) ([]*ethtypes.JSONRPCResponse, error) {
+	if len(requests) == 0 {
+		return []*ethtypes.JSONRPCResponse{}, nil
+	}
+
+	batch := make([]ethtypes.JSONRPCRequest, len(requests))
+	for i, request := range requests {
+		request.JsonRPC = "2.0"
+		request.ID = i + 1
+		batch[i] = request
+	}
+
+	requestBody, err := json.Marshal(batch)
 	if err != nil {
-		return nil, fmt.Errorf("error making HTTP request: %v", err)
+		return nil, fmt.Errorf("error marshaling batch request: %v", err)
+	}
+
+	label := fmt.Sprintf("batch[%d]%s", len(batch), batch[0].Method)
+	var results []*ethtypes.JSONRPCResponse
+	err = c.withRetry(ctx, label, func() error {
+		body, err := c.post(ctx, requestBody)
+		if err != nil {
+			return err
+		}
+
+		results, err = matchBatchResponses(batch, body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// matchBatchResponses orders batch responses by request ID. Requests the node
+// did not answer get a synthesized error response.
+func matchBatchResponses(batch []ethtypes.JSONRPCRequest, body []byte) ([]*ethtypes.JSONRPCResponse, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		// Nodes that reject the whole batch answer with a single error object
+		var response ethtypes.JSONRPCResponse
+		if err := json.Unmarshal(trimmed, &response); err != nil {
+			return nil, &decodeError{err: err}
+		}
+		if response.Error != nil {
+			return nil, response.Error
+		}
+		return nil, &decodeError{err: errors.New("expected batch response array")}
+	}
+
+	var responses []ethtypes.JSONRPCResponse
+	if err := json.Unmarshal(trimmed, &responses); err != nil {
+		return nil, &decodeError{err: err}
+	}
+
+	byID := make(map[int]*ethtypes.JSONRPCResponse, len(responses))
+	for i := range responses {
+		byID[responses[i].ID] = &responses[i]
+	}
+
+	results := make([]*ethtypes.JSONRPCResponse, len(batch))
+	for i, request := range batch {
+		response, ok := byID[request.ID]
+		if !ok {
+			response = &ethtypes.JSONRPCResponse{
+				JsonRPC: "2.0",
+				ID:      request.ID,
+				Error: &ethtypes.JSONRPCError{
+					Code:    ethtypes.ErrCodeMissingResponse,
+					Message: "no response for request in batch",
+				},
+			}
+		}
+		results[i] = response
+	}
+
+	return results, nil
+}
+
+// withRetry runs attempt until it succeeds, fails permanently, the retry
+// policy is exhausted or the context ends, logging each failed attempt.
+func (c *Client) withRetry(ctx context.Context, method string, attempt func() error) error {
+	for try := 1; ; try++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			// The caller gave up; retrying would outlive its deadline
+			return ctx.Err()
+		}
+
+		retryable := isRetryable(err)
+		if !retryable || try >= c.retry.Attempts {
+			c.logger.Error("RPC call failed",
+				zap.String("method", method),
+				zap.Int("attempt", try),
+				zap.Bool("retryable", retryable),
+				zap.Error(err),
+			)
+			return err
+		}
+
+		delay := c.retry.backoff(try)
+		c.logger.Warn("RPC call failed, retrying",
+			zap.String("method", method),
+			zap.Int("attempt", try),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for the given duration unless the context ends first.
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *Client) post(ctx context.Context, requestBody []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.rpcURL, bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making HTTP request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	var response ethtypes.JSONRPCResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("error decoding response: %v", err)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &httpStatusError{StatusCode: resp.StatusCode}
 	}
 
-	return &response, nil
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	return body, nil
+}
+
+// backoff returns the exponential delay for the given attempt with equal
+// jitter, so concurrent callers don't retry in lockstep.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+type httpStatusError struct {
+	StatusCode int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %d", e.StatusCode)
+}
+
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return fmt.Sprintf("error decoding response: %v", e.err)
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
+
+// isRetryable separates transient failures (network trouble, throttling,
+// overloaded nodes) from permanent ones that would fail again.
+func isRetryable(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	var rpcErr *ethtypes.JSONRPCError
+	if errors.As(err, &rpcErr) {
+		return rateLimitCodes[rpcErr.Code]
+	}
+
+	var decodeErr *decodeError
+	if errors.As(err, &decodeErr) {
+		// Overloaded gateways sometimes answer with truncated or non-JSON bodies
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	return false
 }
@@ -0,0 +1,204 @@
+package ethereum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	ethtypes "github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_MakeRPCCall_Retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		failure      func(w http.ResponseWriter)
+		attempts     int
+		wantErr      bool
+		wantRequests int32
+	}{
+		{
+			name:     "recovers from server errors",
+			failures: 2,
+			failure: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+			attempts:     3,
+			wantErr:      false,
+			wantRequests: 3,
+		},
+		{
+			name:     "recovers from rate limiting",
+			failures: 1,
+			failure: func(w http.ResponseWriter) {
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32005,"message":"limit exceeded"}}`)
+			},
+			attempts:     3,
+			wantErr:      false,
+			wantRequests: 2,
+		},
+		{
+			name:     "gives up after configured attempts",
+			failures: 5,
+			failure: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			attempts:     3,
+			wantErr:      true,
+			wantRequests: 3,
+		},
+		{
+			name:     "does not retry permanent errors",
+			failures: 5,
+			failure: func(w http.ResponseWriter) {
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}`)
+			},
+			attempts:     3,
+			wantErr:      true,
+			wantRequests: 1,
+		},
+		{
+			name:     "does not retry client errors",
+			failures: 5,
+			failure: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			attempts:     3,
+			wantErr:      true,
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if int(atomic.AddInt32(&requests, 1)) <= tt.failures {
+					tt.failure(w)
+					return
+				}
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"0x10"}`)
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, RetryPolicy{Attempts: tt.attempts, BaseDelay: time.Millisecond}, time.Second)
+			response, err := client.MakeRPCCall(context.Background(), "eth_blockNumber", []interface{}{})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MakeRPCCall() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && response.Result != "0x10" {
+				t.Errorf("MakeRPCCall() result = %v, want 0x10", response.Result)
+			}
+			if got := atomic.LoadInt32(&requests); got != tt.wantRequests {
+				t.Errorf("Server received %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestClient_MakeRPCCall_Timeout(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"0x10"}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, RetryPolicy{Attempts: 2, BaseDelay: time.Millisecond}, 50*time.Millisecond)
+	if _, err := client.MakeRPCCall(context.Background(), "eth_blockNumber", []interface{}{}); err != nil {
+		t.Fatalf("MakeRPCCall() error = %v, want retry after timeout to succeed", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("Server received %d requests, want 2", got)
+	}
+}
+
+func TestClient_BatchRPCCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var requests []ethtypes.JSONRPCRequest
+		if err := json.NewDecoder(r.Body).Decode(&requests); err != nil {
+			t.Errorf("Expected a batch request: %v", err)
+		}
+		if len(requests) != 3 {
+			t.Errorf("Batch contained %d requests, want 3", len(requests))
+		}
+		// Answer out of order, fail the second and drop the third
+		fmt.Fprint(w, `[
+			{"jsonrpc":"2.0","id":2,"error":{"code":-32000,"message":"header not found"}},
+			{"jsonrpc":"2.0","id":1,"result":"0x1"}
+		]`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, RetryPolicy{Attempts: 1}, time.Second)
+	responses, err := client.BatchRPCCall(context.Background(), []ethtypes.JSONRPCRequest{
+		{Method: "eth_getBlockByNumber", Params: []interface{}{"0x1", true}},
+		{Method: "eth_getBlockByNumber", Params: []interface{}{"0x2", true}},
+		{Method: "eth_getBlockByNumber", Params: []interface{}{"0x3", true}},
+	})
+	if err != nil {
+		t.Fatalf("BatchRPCCall() error = %v", err)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("Got %d responses, want 3", len(responses))
+	}
+
+	if responses[0].Error != nil || responses[0].Result != "0x1" {
+		t.Errorf("Response 0 = %+v, want result 0x1", responses[0])
+	}
+	if responses[1].Error == nil || responses[1].Error.Code != -32000 {
+		t.Errorf("Response 1 error = %v, want code -32000", responses[1].Error)
+	}
+	if responses[2].Error == nil || responses[2].Error.Code != ethtypes.ErrCodeMissingResponse {
+		t.Errorf("Response 2 error = %v, want missing response", responses[2].Error)
+	}
+}
+
+func TestClient_BatchRPCCall_Rejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"batch requests not supported"}}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond}, time.Second)
+	_, err := client.BatchRPCCall(context.Background(), []ethtypes.JSONRPCRequest{
+		{Method: "eth_blockNumber", Params: []interface{}{}},
+		{Method: "eth_blockNumber", Params: []interface{}{}},
+	})
+	if err == nil {
+		t.Fatal("BatchRPCCall() expected error for rejected batch")
+	}
+}
+
+func TestClient_MakeRPCCall_ContextCancelled(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	client := NewClient(server.URL, RetryPolicy{Attempts: 10, BaseDelay: time.Second}, time.Second)
+	started := time.Now()
+	_, err := client.MakeRPCCall(ctx, "eth_blockNumber", []interface{}{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("MakeRPCCall() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("MakeRPCCall() kept retrying for %v after the deadline", elapsed)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("Server received %d requests, want 1", got)
+	}
+}
@@ -0,0 +1,309 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ethtypes "github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"github.com/grokkos/ether-tx-parser/pkg/logger"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// errorRateAlpha weights the newest outcome in the moving error rate.
+	errorRateAlpha = 0.2
+	// unhealthyErrorRate is the error rate above which an endpoint is avoided.
+	unhealthyErrorRate = 0.5
+)
+
+// Endpoint is one RPC provider in a Pool. Endpoints with a higher weight are
+// preferred when their health is otherwise comparable.
+type Endpoint struct {
+	URL    string
+	Weight int
+}
+
+// Pool is an EthereumClient that spreads calls over several endpoints. It
+// health-checks them periodically, routes each call to the healthiest one,
+// fails over on retryable errors and avoids endpoints lagging behind the
+// highest observed head.
+type Pool struct {
+	endpoints []*poolEndpoint
+	retry     RetryPolicy
+	maxLag    int
+	interval  time.Duration
+	mutex     sync.RWMutex
+	logger    *zap.Logger
+}
+
+type poolEndpoint struct {
+	url    string
+	weight int
+	client *Client
+
+	head        int
+	latency     time.Duration
+	errorRate   float64
+	requests    int64
+	failures    int64
+	lastError   string
+	lastChecked time.Time
+}
+
+func NewPool(endpoints []Endpoint, retry RetryPolicy, timeout, interval time.Duration, maxLag int) *Pool {
+	if retry.Attempts < 1 {
+		retry.Attempts = 1
+	}
+
+	pool := &Pool{
+		retry:    retry,
+		maxLag:   maxLag,
+		interval: interval,
+		logger:   logger.GetLogger(),
+	}
+	for _, endpoint := range endpoints {
+		weight := endpoint.Weight
+		if weight < 1 {
+			weight = 1
+		}
+		pool.endpoints = append(pool.endpoints, &poolEndpoint{
+			url:    endpoint.URL,
+			weight: weight,
+			// Failover is handled by the pool, so each endpoint is tried once
+			client: NewClient(endpoint.URL, RetryPolicy{Attempts: 1}, timeout),
+		})
+	}
+	return pool
+}
+
+// Start runs health checks until the context is cancelled.
+func (p *Pool) Start(ctx context.Context) {
+	p.checkHealth(ctx)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkHealth(ctx)
+		}
+	}
+}
+
+// checkHealth polls eth_blockNumber on every endpoint concurrently. Each
+// check is bounded by the health check interval so a hung endpoint cannot
+// stall the next round.
+func (p *Pool) checkHealth(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, p.interval)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, endpoint := range p.endpoints {
+		wg.Add(1)
+		go func(endpoint *poolEndpoint) {
+			defer wg.Done()
+
+			started := time.Now()
+			response, err := endpoint.client.MakeRPCCall(ctx, "eth_blockNumber", []interface{}{})
+			if ctx.Err() != nil && ctx.Err() != context.DeadlineExceeded {
+				// Shutting down; don't count it against the endpoint
+				return
+			}
+			if err == nil {
+				err = p.recordHead(endpoint, response)
+			}
+			p.record(endpoint, time.Since(started), err)
+
+			p.mutex.Lock()
+			endpoint.lastChecked = time.Now()
+			p.mutex.Unlock()
+
+			if err != nil {
+				p.logger.Warn("RPC endpoint health check failed",
+					zap.String("url", endpoint.url),
+					zap.Error(err),
+				)
+			}
+		}(endpoint)
+	}
+	wg.Wait()
+}
+
+func (p *Pool) recordHead(endpoint *poolEndpoint, response *ethtypes.JSONRPCResponse) error {
+	blockNumberStr, ok := response.Result.(string)
+	if !ok {
+		return fmt.Errorf("invalid block number format: %v", response.Result)
+	}
+
+	var head int
+	if _, err := fmt.Sscanf(blockNumberStr, "0x%x", &head); err != nil {
+		return fmt.Errorf("invalid block number format: %v", err)
+	}
+
+	p.mutex.Lock()
+	endpoint.head = head
+	p.mutex.Unlock()
+	return nil
+}
+
+// record folds the outcome of a call into the endpoint's latency and error
+// rate moving averages.
+func (p *Pool) record(endpoint *poolEndpoint, latency time.Duration, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	endpoint.requests++
+	outcome := 0.0
+	if err != nil {
+		endpoint.failures++
+		endpoint.lastError = err.Error()
+		outcome = 1.0
+	} else if endpoint.latency == 0 {
+		endpoint.latency = latency
+	} else {
+		endpoint.latency = time.Duration(float64(endpoint.latency)*(1-errorRateAlpha) + float64(latency)*errorRateAlpha)
+	}
+	endpoint.errorRate = endpoint.errorRate*(1-errorRateAlpha) + outcome*errorRateAlpha
+}
+
+// candidates orders endpoints from healthiest to least healthy. Endpoints
+// that are lagging or failing too often go last, so they are only used when
+// nothing better is available.
+func (p *Pool) candidates() []*poolEndpoint {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	maxHead := p.maxHeadLocked()
+	ordered := make([]*poolEndpoint, len(p.endpoints))
+	copy(ordered, p.endpoints)
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if healthyA, healthyB := p.isHealthyLocked(a, maxHead), p.isHealthyLocked(b, maxHead); healthyA != healthyB {
+			return healthyA
+		}
+		return score(a) < score(b)
+	})
+	return ordered
+}
+
+// score ranks endpoints by latency penalized by errors; lower is better.
+func score(endpoint *poolEndpoint) float64 {
+	latency := float64(endpoint.latency)
+	if latency == 0 {
+		latency = float64(time.Millisecond)
+	}
+	return latency * (1 + 4*endpoint.errorRate) / float64(endpoint.weight)
+}
+
+func (p *Pool) isHealthyLocked(endpoint *poolEndpoint, maxHead int) bool {
+	if endpoint.errorRate > unhealthyErrorRate {
+		return false
+	}
+	return p.maxLag <= 0 || endpoint.head == 0 || maxHead-endpoint.head <= p.maxLag
+}
+
+func (p *Pool) maxHeadLocked() int {
+	maxHead := 0
+	for _, endpoint := range p.endpoints {
+		if endpoint.head > maxHead {
+			maxHead = endpoint.head
+		}
+	}
+	return maxHead
+}
+
+func (p *Pool) MakeRPCCall(ctx context.Context, method string, params []interface{}) (*ethtypes.JSONRPCResponse, error) {
+	var response *ethtypes.JSONRPCResponse
+	err := p.withFailover(ctx, method, func(client *Client) error {
+		var err error
+		response, err = client.MakeRPCCall(ctx, method, params)
+		return err
+	})
+	return response, err
+}
+
+func (p *Pool) BatchRPCCall(ctx context.Context, requests []ethtypes.JSONRPCRequest) ([]*ethtypes.JSONRPCResponse, error) {
+	var responses []*ethtypes.JSONRPCResponse
+	err := p.withFailover(ctx, "batch", func(client *Client) error {
+		var err error
+		responses, err = client.BatchRPCCall(ctx, requests)
+		return err
+	})
+	return responses, err
+}
+
+// withFailover tries the call on each endpoint from healthiest to least
+// healthy. When every endpoint failed with a retryable error it backs off and
+// starts another round, up to the configured number of attempts.
+func (p *Pool) withFailover(ctx context.Context, method string, call func(client *Client) error) error {
+	if len(p.endpoints) == 0 {
+		return errors.New("no RPC endpoints configured")
+	}
+
+	var lastErr error
+	for round := 1; ; round++ {
+		for _, endpoint := range p.candidates() {
+			started := time.Now()
+			err := call(endpoint.client)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == nil || !isRetryable(err) {
+				// Permanent errors are the caller's problem, not the endpoint's
+				p.record(endpoint, time.Since(started), nil)
+				return err
+			}
+
+			p.record(endpoint, time.Since(started), err)
+			p.logger.Warn("RPC endpoint failed, failing over",
+				zap.String("method", method),
+				zap.String("url", endpoint.url),
+				zap.Error(err),
+			)
+			lastErr = err
+		}
+
+		if round >= p.retry.Attempts {
+			return lastErr
+		}
+		if err := sleep(ctx, p.retry.backoff(round)); err != nil {
+			return err
+		}
+	}
+}
+
+// Status returns a snapshot of every endpoint's health.
+func (p *Pool) Status() []ethtypes.EndpointStatus {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	maxHead := p.maxHeadLocked()
+	statuses := make([]ethtypes.EndpointStatus, 0, len(p.endpoints))
+	for _, endpoint := range p.endpoints {
+		lag := 0
+		if endpoint.head > 0 {
+			lag = maxHead - endpoint.head
+		}
+		statuses = append(statuses, ethtypes.EndpointStatus{
+			URL:         endpoint.url,
+			Weight:      endpoint.weight,
+			Healthy:     p.isHealthyLocked(endpoint, maxHead),
+			Head:        endpoint.head,
+			Lag:         lag,
+			LatencyMs:   float64(endpoint.latency) / float64(time.Millisecond),
+			ErrorRate:   endpoint.errorRate,
+			Requests:    endpoint.requests,
+			Failures:    endpoint.failures,
+			LastError:   endpoint.lastError,
+			LastChecked: endpoint.lastChecked,
+		})
+	}
+	return statuses
+}
@@ -0,0 +1,103 @@
+package ethereum
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newNode starts a stand-in RPC node that reports the given head and fails
+// every call when broken is set.
+func newNode(head int, broken *atomic.Bool, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if broken != nil && broken.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"0x%x"}`, head)
+	}))
+}
+
+func TestPool_FailsOverToHealthyEndpoint(t *testing.T) {
+	var primaryCalls, backupCalls int32
+	var broken atomic.Bool
+	primary := newNode(100, &broken, &primaryCalls)
+	defer primary.Close()
+	backup := newNode(100, nil, &backupCalls)
+	defer backup.Close()
+
+	pool := NewPool([]Endpoint{
+		{URL: primary.URL, Weight: 10},
+		{URL: backup.URL, Weight: 1},
+	}, RetryPolicy{Attempts: 1}, time.Second, time.Minute, 3)
+	pool.checkHealth(context.Background())
+
+	broken.Store(true)
+	response, err := pool.MakeRPCCall(context.Background(), "eth_blockNumber", []interface{}{})
+	if err != nil {
+		t.Fatalf("MakeRPCCall() error = %v, want failover to succeed", err)
+	}
+	if response.Result != "0x64" {
+		t.Errorf("MakeRPCCall() result = %v, want 0x64", response.Result)
+	}
+	if atomic.LoadInt32(&backupCalls) < 2 {
+		t.Errorf("Backup endpoint was not used after primary failed")
+	}
+
+	status := pool.Status()
+	if status[0].Failures == 0 || status[0].LastError == "" {
+		t.Errorf("Primary endpoint failure was not recorded: %+v", status[0])
+	}
+}
+
+func TestPool_AvoidsLaggingEndpoint(t *testing.T) {
+	var laggingCalls, currentCalls int32
+	lagging := newNode(90, nil, &laggingCalls)
+	defer lagging.Close()
+	current := newNode(100, nil, &currentCalls)
+	defer current.Close()
+
+	pool := NewPool([]Endpoint{
+		{URL: lagging.URL, Weight: 10},
+		{URL: current.URL, Weight: 1},
+	}, RetryPolicy{Attempts: 1}, time.Second, time.Minute, 3)
+	pool.checkHealth(context.Background())
+
+	atomic.StoreInt32(&laggingCalls, 0)
+	for i := 0; i < 5; i++ {
+		if _, err := pool.MakeRPCCall(context.Background(), "eth_blockNumber", []interface{}{}); err != nil {
+			t.Fatalf("MakeRPCCall() error = %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&laggingCalls); got != 0 {
+		t.Errorf("Lagging endpoint received %d calls, want 0", got)
+	}
+
+	for _, status := range pool.Status() {
+		if status.URL == lagging.URL && (status.Healthy || status.Lag != 10) {
+			t.Errorf("Lagging endpoint status = %+v, want unhealthy with lag 10", status)
+		}
+	}
+}
+
+func TestPool_AllEndpointsFail(t *testing.T) {
+	var calls int32
+	var broken atomic.Bool
+	broken.Store(true)
+	node := newNode(100, &broken, &calls)
+	defer node.Close()
+
+	pool := NewPool([]Endpoint{{URL: node.URL}}, RetryPolicy{Attempts: 2, BaseDelay: time.Millisecond},
+		time.Second, time.Minute, 3)
+	if _, err := pool.MakeRPCCall(context.Background(), "eth_blockNumber", []interface{}{}); err == nil {
+		t.Fatal("MakeRPCCall() expected error when every endpoint fails")
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Endpoint received %d calls, want 2 rounds", got)
+	}
+}
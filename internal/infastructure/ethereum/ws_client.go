@@ -0,0 +1,437 @@
+package ethereum
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	ethtypes "github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"github.com/grokkos/ether-tx-parser/pkg/logger"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// errConnectionLost fails calls that were in flight when the socket dropped.
+var errConnectionLost = errors.New("websocket connection lost")
+
+const (
+	// defaultPingInterval is how often an idle connection is pinged.
+	defaultPingInterval = 30 * time.Second
+	// defaultPongWait is how long the connection may stay silent, neither
+	// answering pings nor sending messages, before it is considered dead.
+	// It must exceed the ping interval.
+	defaultPongWait = 60 * time.Second
+	// pingWriteWait bounds writing a ping.
+	pingWriteWait = 10 * time.Second
+)
+
+// WSClient is an EthereumClient that talks JSON-RPC over a WebSocket, which
+// also allows it to push new chain heads through eth_subscribe. The
+// connection is dialed lazily and re-established after failures.
+type WSClient struct {
+	url     string
+	timeout time.Duration
+	retry   RetryPolicy
+	logger  *zap.Logger
+	// pingInterval and pongWait detect a connection that died silently, so
+	// it is dropped and its subscriptions resubscribed
+	pingInterval time.Duration
+	pongWait     time.Duration
+
+	mutex   sync.Mutex
+	conn    *websocket.Conn
+	nextID  int
+	pending map[int]chan *ethtypes.JSONRPCResponse
+	// subscriptions routes eth_subscription notifications by subscription ID
+	subscriptions map[string]chan json.RawMessage
+
+	writeMutex sync.Mutex
+}
+
+// subscriptionNotification is the message a node pushes for a subscription.
+type subscriptionNotification struct {
+	Method string `json:"method"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+func NewWSClient(url string, retry RetryPolicy, timeout time.Duration) *WSClient {
+	return &WSClient{
+		url:           url,
+		timeout:       timeout,
+		retry:         retry,
+		logger:        logger.GetLogger(),
+		pingInterval:  defaultPingInterval,
+		pongWait:      defaultPongWait,
+		pending:       make(map[int]chan *ethtypes.JSONRPCResponse),
+		subscriptions: make(map[string]chan json.RawMessage),
+	}
+}
+
+func (c *WSClient) MakeRPCCall(ctx context.Context, method string, params []interface{}) (*ethtypes.JSONRPCResponse, error) {
+	responses, err := c.call(ctx, []ethtypes.JSONRPCRequest{{Method: method, Params: params}}, false)
+	if err != nil {
+		return nil, err
+	}
+	if responses[0].Error != nil {
+		return nil, responses[0].Error
+	}
+	return responses[0], nil
+}
+
+func (c *WSClient) BatchRPCCall(ctx context.Context, requests []ethtypes.JSONRPCRequest) ([]*ethtypes.JSONRPCResponse, error) {
+	if len(requests) == 0 {
+		return []*ethtypes.JSONRPCResponse{}, nil
+	}
+	return c.call(ctx, requests, true)
+}
+
+// call writes the requests on the shared connection and waits for every
+// response, which the read loop routes back by request ID.
+func (c *WSClient) call(ctx context.Context, requests []ethtypes.JSONRPCRequest, batch bool) ([]*ethtypes.JSONRPCResponse, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	conn, err := c.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	waits := make([]chan *ethtypes.JSONRPCResponse, len(requests))
+	outgoing := make([]ethtypes.JSONRPCRequest, len(requests))
+	for i, request := range requests {
+		c.nextID++
+		request.JsonRPC = "2.0"
+		request.ID = c.nextID
+		outgoing[i] = request
+		waits[i] = make(chan *ethtypes.JSONRPCResponse, 1)
+		c.pending[request.ID] = waits[i]
+	}
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		for _, request := range outgoing {
+			delete(c.pending, request.ID)
+		}
+		c.mutex.Unlock()
+	}()
+
+	var payload interface{} = outgoing[0]
+	if batch {
+		payload = outgoing
+	}
+	if err := c.write(conn, payload); err != nil {
+		c.drop(conn, err)
+		return nil, fmt.Errorf("error writing websocket request: %w", err)
+	}
+
+	responses := make([]*ethtypes.JSONRPCResponse, len(requests))
+	for i, wait := range waits {
+		select {
+		case response, ok := <-wait:
+			if !ok {
+				return nil, errConnectionLost
+			}
+			responses[i] = response
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return responses, nil
+}
+
+func (c *WSClient) write(conn *websocket.Conn, payload interface{}) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.timeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+	return conn.WriteJSON(payload)
+}
+
+// connection returns the live connection, dialing a new one if needed.
+func (c *WSClient) connection(ctx context.Context) (*websocket.Conn, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn != nil {
+		return c.conn, nil
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, c.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error dialing websocket: %w", err)
+	}
+	c.conn = conn
+	conn.SetReadDeadline(time.Now().Add(c.pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(c.pongWait))
+	})
+	go c.readLoop(conn)
+	go c.pingLoop(conn)
+
+	c.logger.Info("WebSocket connected", zap.String("url", c.url))
+	return conn, nil
+}
+
+// readLoop dispatches responses and notifications until the connection
+// fails. Every message and pong extends the read deadline; a connection that
+// stays silent past it fails the read.
+func (c *WSClient) readLoop(conn *websocket.Conn) {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			c.drop(conn, err)
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(c.pongWait))
+		c.dispatch(message)
+	}
+}
+
+// pingLoop pings the connection until it is dropped, so a live peer keeps
+// answering with pongs even while no heads arrive.
+func (c *WSClient) pingLoop(conn *websocket.Conn) {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.mutex.Lock()
+		current := c.conn == conn
+		c.mutex.Unlock()
+		if !current {
+			return
+		}
+
+		if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(pingWriteWait)); err != nil {
+			c.drop(conn, fmt.Errorf("error writing websocket ping: %w", err))
+			return
+		}
+	}
+}
+
+func (c *WSClient) dispatch(message []byte) {
+	trimmed := bytes.TrimSpace(message)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var responses []ethtypes.JSONRPCResponse
+		if err := json.Unmarshal(trimmed, &responses); err != nil {
+			c.logger.Warn("Invalid websocket batch response", zap.Error(err))
+			return
+		}
+		for i := range responses {
+			c.deliver(&responses[i])
+		}
+		return
+	}
+
+	var notification subscriptionNotification
+	if err := json.Unmarshal(trimmed, &notification); err == nil && notification.Method == "eth_subscription" {
+		// Send under the lock so drop cannot close the sink mid-send
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if sink, ok := c.subscriptions[notification.Params.Subscription]; ok {
+			select {
+			case sink <- notification.Params.Result:
+			default:
+				// The consumer only needs the newest head; drop if it is busy
+			}
+		}
+		return
+	}
+
+	var response ethtypes.JSONRPCResponse
+	if err := json.Unmarshal(trimmed, &response); err != nil {
+		c.logger.Warn("Invalid websocket response", zap.Error(err))
+		return
+	}
+	c.deliver(&response)
+}
+
+func (c *WSClient) deliver(response *ethtypes.JSONRPCResponse) {
+	c.mutex.Lock()
+	wait, ok := c.pending[response.ID]
+	delete(c.pending, response.ID)
+	c.mutex.Unlock()
+
+	if ok {
+		wait <- response
+	}
+}
+
+// drop tears down a failed connection, failing in-flight calls and ending
+// its subscriptions so their owners can resubscribe.
+func (c *WSClient) drop(conn *websocket.Conn, cause error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn != conn {
+		return
+	}
+	c.conn = nil
+	conn.Close()
+
+	for id, wait := range c.pending {
+		close(wait)
+		delete(c.pending, id)
+	}
+	for id, sink := range c.subscriptions {
+		close(sink)
+		delete(c.subscriptions, id)
+	}
+
+	c.logger.Warn("WebSocket connection lost",
+		zap.String("url", c.url),
+		zap.Error(cause),
+	)
+}
+
+// Close shuts the current connection down.
+func (c *WSClient) Close() {
+	c.mutex.Lock()
+	conn := c.conn
+	c.mutex.Unlock()
+
+	if conn != nil {
+		c.drop(conn, errors.New("client closed"))
+	}
+}
+
+// SubscribeNewHeads streams new chain heads until the context ends. When the
+// connection drops it reconnects with backoff, resubscribes and then emits
+// the current head, so the consumer can fill any gap it missed. It returns
+// ethtypes.ErrSubscriptionsUnsupported if the node rejects eth_subscribe.
+func (c *WSClient) SubscribeNewHeads(ctx context.Context) (<-chan entity.BlockHeader, error) {
+	sink, err := c.subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	heads := make(chan entity.BlockHeader, 1)
+	go func() {
+		defer close(heads)
+		defer c.Close()
+
+		for attempt := 1; ; attempt = 1 {
+			for raw := range sink {
+				header, err := decodeHeader(raw)
+				if err != nil {
+					c.logger.Warn("Invalid newHeads notification", zap.Error(err))
+					continue
+				}
+				publishHead(heads, header)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			// The connection dropped; resubscribe, then announce the current
+			// head so blocks produced while disconnected are caught up
+			for {
+				if err := sleep(ctx, c.retry.backoff(attempt)); err != nil {
+					return
+				}
+				sink, err = c.subscribe(ctx)
+				if err == nil {
+					break
+				}
+				attempt++
+				c.logger.Warn("Resubscribing to new heads failed", zap.Error(err))
+			}
+			c.logger.Info("Resubscribed to new heads", zap.String("url", c.url))
+
+			if header, err := c.latestHeader(ctx); err == nil {
+				publishHead(heads, header)
+			}
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		c.Close()
+	}()
+
+	return heads, nil
+}
+
+// subscribe registers a newHeads subscription on the current connection.
+func (c *WSClient) subscribe(ctx context.Context) (chan json.RawMessage, error) {
+	response, err := c.MakeRPCCall(ctx, "eth_subscribe", []interface{}{"newHeads"})
+	if err != nil {
+		if ethtypes.IsMethodUnsupported(err, "eth_subscribe") {
+			return nil, fmt.Errorf("%w: %v", ethtypes.ErrSubscriptionsUnsupported, err)
+		}
+		return nil, err
+	}
+
+	subscriptionID, ok := response.Result.(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid subscription id: %v", response.Result)
+	}
+
+	sink := make(chan json.RawMessage, 16)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == nil {
+		// Lost the connection between subscribing and registering the sink
+		return nil, errConnectionLost
+	}
+	c.subscriptions[subscriptionID] = sink
+	return sink, nil
+}
+
+func (c *WSClient) latestHeader(ctx context.Context) (entity.BlockHeader, error) {
+	response, err := c.MakeRPCCall(ctx, "eth_getBlockByNumber", []interface{}{"latest", false})
+	if err != nil {
+		return entity.BlockHeader{}, err
+	}
+	raw, err := json.Marshal(response.Result)
+	if err != nil {
+		return entity.BlockHeader{}, err
+	}
+	return decodeHeader(raw)
+}
+
+func decodeHeader(raw json.RawMessage) (entity.BlockHeader, error) {
+	var head struct {
+		Number     string `json:"number"`
+		Hash       string `json:"hash"`
+		ParentHash string `json:"parentHash"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return entity.BlockHeader{}, err
+	}
+
+	var number int
+	if _, err := fmt.Sscanf(head.Number, "0x%x", &number); err != nil {
+		return entity.BlockHeader{}, fmt.Errorf("invalid block number format: %v", err)
+	}
+	return entity.BlockHeader{Number: number, Hash: head.Hash, ParentHash: head.ParentHash}, nil
+}
+
+// publishHead hands the newest head to the consumer, replacing an unread
+// older one so a slow consumer never falls behind on stale heads.
+func publishHead(heads chan entity.BlockHeader, header entity.BlockHeader) {
+	for {
+		select {
+		case heads <- header:
+			return
+		default:
+		}
+		select {
+		case <-heads:
+		default:
+		}
+	}
+}
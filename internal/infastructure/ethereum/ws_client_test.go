@@ -0,0 +1,260 @@
+package ethereum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	ethtypes "github.com/grokkos/ether-tx-parser/pkg/ethereum"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// wsNode is a stand-in WebSocket node that answers eth_subscribe and
+// eth_getBlockByNumber and lets tests push heads or drop the connection.
+type wsNode struct {
+	server      *httptest.Server
+	unsupported bool
+	latest      int
+
+	mutex         sync.Mutex
+	conn          *websocket.Conn
+	subscriptions int
+	subscribed    chan struct{}
+	// stall is how many connections stop reading, and so stop answering
+	// pings, after their first request, as a peer that died silently
+	stall   int
+	release chan struct{}
+}
+
+func newWSNode(t *testing.T, latest int, unsupported bool) *wsNode {
+	node := &wsNode{latest: latest, unsupported: unsupported, subscribed: make(chan struct{}, 10), release: make(chan struct{})}
+	upgrader := websocket.Upgrader{}
+	node.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade() error = %v", err)
+			return
+		}
+		node.mutex.Lock()
+		node.conn = conn
+		node.mutex.Unlock()
+
+		for {
+			var request ethtypes.JSONRPCRequest
+			if err := conn.ReadJSON(&request); err != nil {
+				return
+			}
+			node.answer(conn, request)
+			if node.stalls() {
+				<-node.release
+				return
+			}
+		}
+	}))
+	t.Cleanup(node.server.Close)
+	t.Cleanup(func() { close(node.release) })
+	return node
+}
+
+func (n *wsNode) url() string {
+	return "ws" + strings.TrimPrefix(n.server.URL, "http")
+}
+
+func (n *wsNode) answer(conn *websocket.Conn, request ethtypes.JSONRPCRequest) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	switch {
+	case request.Method == "eth_subscribe" && n.unsupported:
+		fmt.Fprint(writer(conn), errorReply(request.ID, -32601, "the method eth_subscribe does not exist/is not available"))
+		return
+	case request.Method == "eth_subscribe":
+		n.subscriptions++
+		fmt.Fprintf(writer(conn), `{"jsonrpc":"2.0","id":%d,"result":"0xsub%d"}`, request.ID, n.subscriptions)
+		n.subscribed <- struct{}{}
+	case request.Method == "eth_getBlockByNumber":
+		fmt.Fprintf(writer(conn), `{"jsonrpc":"2.0","id":%d,"result":{"number":"0x%x","hash":"0xhead"}}`, request.ID, n.latest)
+	default:
+		fmt.Fprintf(writer(conn), `{"jsonrpc":"2.0","id":%d,"result":"0x%x"}`, request.ID, n.latest)
+	}
+}
+
+func (n *wsNode) stalls() bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.stall == 0 {
+		return false
+	}
+	n.stall--
+	return true
+}
+
+// pushHead notifies the current subscription of a new head.
+func (n *wsNode) pushHead(number int) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	message := fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0xsub%d","result":{"number":"0x%x","hash":"0x%x"}}}`,
+		n.subscriptions, number, number)
+	n.conn.WriteMessage(websocket.TextMessage, []byte(message))
+}
+
+// disconnect drops the current connection from the server side.
+func (n *wsNode) disconnect() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.conn.Close()
+}
+
+func errorReply(id, code int, message string) string {
+	reply, _ := json.Marshal(ethtypes.JSONRPCResponse{
+		JsonRPC: "2.0",
+		ID:      id,
+		Error:   &ethtypes.JSONRPCError{Code: code, Message: message},
+	})
+	return string(reply)
+}
+
+type messageWriter struct {
+	conn *websocket.Conn
+}
+
+func writer(conn *websocket.Conn) messageWriter {
+	return messageWriter{conn: conn}
+}
+
+func (w messageWriter) Write(p []byte) (int, error) {
+	return len(p), w.conn.WriteMessage(websocket.TextMessage, p)
+}
+
+func waitFor(t *testing.T, signal <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-signal:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for %s", what)
+	}
+}
+
+func nextHead(t *testing.T, heads <-chan entity.BlockHeader) entity.BlockHeader {
+	t.Helper()
+	select {
+	case head, ok := <-heads:
+		if !ok {
+			t.Fatal("Head channel closed unexpectedly")
+		}
+		return head
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a head")
+	}
+	return entity.BlockHeader{}
+}
+
+func TestWSClient_SubscribeNewHeads(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node := newWSNode(t, 0x64, false)
+	client := NewWSClient(node.url(), RetryPolicy{Attempts: 3, BaseDelay: 10 * time.Millisecond}, time.Second)
+
+	heads, err := client.SubscribeNewHeads(ctx)
+	if err != nil {
+		t.Fatalf("SubscribeNewHeads() error = %v", err)
+	}
+	waitFor(t, node.subscribed, "subscription")
+
+	node.pushHead(0x65)
+	if head := nextHead(t, heads); head.Number != 0x65 {
+		t.Errorf("Head number = %d, want %d", head.Number, 0x65)
+	}
+
+	// RPC calls share the connection with the subscription
+	response, err := client.MakeRPCCall(ctx, "eth_blockNumber", []interface{}{})
+	if err != nil {
+		t.Fatalf("MakeRPCCall() error = %v", err)
+	}
+	if response.Result != "0x64" {
+		t.Errorf("MakeRPCCall() result = %v, want 0x64", response.Result)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-heads:
+		if ok {
+			// A buffered head may still be pending; the channel must close next
+			if _, ok := <-heads; ok {
+				t.Error("Head channel still open after cancel")
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Head channel was not closed after cancel")
+	}
+}
+
+func TestWSClient_ResubscribesAfterDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node := newWSNode(t, 0x70, false)
+	client := NewWSClient(node.url(), RetryPolicy{Attempts: 3, BaseDelay: 10 * time.Millisecond}, time.Second)
+
+	heads, err := client.SubscribeNewHeads(ctx)
+	if err != nil {
+		t.Fatalf("SubscribeNewHeads() error = %v", err)
+	}
+	waitFor(t, node.subscribed, "subscription")
+
+	node.disconnect()
+	waitFor(t, node.subscribed, "resubscription")
+
+	// The latest head is announced after reconnecting so gaps get filled
+	if head := nextHead(t, heads); head.Number != 0x70 {
+		t.Errorf("Head after reconnect = %d, want latest %d", head.Number, 0x70)
+	}
+
+	node.pushHead(0x71)
+	if head := nextHead(t, heads); head.Number != 0x71 {
+		t.Errorf("Head on new subscription = %d, want %d", head.Number, 0x71)
+	}
+}
+
+func TestWSClient_ResubscribesAfterSilentConnection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node := newWSNode(t, 0x80, false)
+	node.stall = 1
+	client := NewWSClient(node.url(), RetryPolicy{Attempts: 3, BaseDelay: 10 * time.Millisecond}, time.Second)
+	client.pingInterval = 20 * time.Millisecond
+	client.pongWait = 100 * time.Millisecond
+
+	heads, err := client.SubscribeNewHeads(ctx)
+	if err != nil {
+		t.Fatalf("SubscribeNewHeads() error = %v", err)
+	}
+	waitFor(t, node.subscribed, "subscription")
+
+	// The node keeps the socket open but no longer answers pings
+	waitFor(t, node.subscribed, "resubscription")
+	if head := nextHead(t, heads); head.Number != 0x80 {
+		t.Errorf("Head after reconnect = %d, want latest %d", head.Number, 0x80)
+	}
+}
+
+func TestWSClient_SubscriptionsUnsupported(t *testing.T) {
+	node := newWSNode(t, 0x64, true)
+	client := NewWSClient(node.url(), RetryPolicy{Attempts: 1, BaseDelay: 10 * time.Millisecond}, time.Second)
+	defer client.Close()
+
+	_, err := client.SubscribeNewHeads(context.Background())
+	if !errors.Is(err, ethtypes.ErrSubscriptionsUnsupported) {
+		t.Errorf("SubscribeNewHeads() error = %v, want ErrSubscriptionsUnsupported", err)
+	}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileCheckpoint keeps the parser checkpoint in a small JSON file. Each save
+// writes a temporary file and renames it over the old one, so a crash leaves
+// either the previous or the new checkpoint, never a torn one.
+type FileCheckpoint struct {
+	path  string
+	mutex sync.Mutex
+}
+
+type checkpointFile struct {
+	Block      int       `json:"block"`
+	Hash       string    `json:"hash"`
+	ParentHash string    `json:"parent_hash"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func NewFileCheckpoint(path string) (*FileCheckpoint, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating checkpoint directory: %w", err)
+	}
+	return &FileCheckpoint{path: path}, nil
+}
+
+func (c *FileCheckpoint) Load(ctx context.Context) (entity.BlockHeader, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return entity.BlockHeader{}, false, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return entity.BlockHeader{}, false, nil
+	}
+	if err != nil {
+		return entity.BlockHeader{}, false, fmt.Errorf("error reading checkpoint: %w", err)
+	}
+
+	var saved checkpointFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return entity.BlockHeader{}, false, fmt.Errorf("error decoding checkpoint %s: %w", c.path, err)
+	}
+	return entity.BlockHeader{Number: saved.Block, Hash: saved.Hash, ParentHash: saved.ParentHash}, true, nil
+}
+
+func (c *FileCheckpoint) Save(ctx context.Context, header entity.BlockHeader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(checkpointFile{
+		Block:      header.Number,
+		Hash:       header.Hash,
+		ParentHash: header.ParentHash,
+		UpdatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("error replacing checkpoint: %w", err)
+	}
+	return nil
+}
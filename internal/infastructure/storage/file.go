@@ -0,0 +1,619 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/logger"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	logFileName      = "store.log"
+	snapshotFileName = "snapshot.json"
+
+	// DefaultSnapshotInterval is how many log records are written before
+	// the log is compacted into a snapshot.
+	DefaultSnapshotInterval = 10000
+)
+
+// errStoreClosed is returned for changes made after Close.
+var errStoreClosed = errors.New("store is closed")
+
+// Log record operations, one per Store method that changes state.
+const (
+	opSetCurrentBlock        = "set_current_block"
+	opSubscribe              = "subscribe"
+	opAddTransaction         = "add_transaction"
+	opMergeTransactions      = "merge_transactions"
+	opAddTokenTransfer       = "add_token_transfer"
+	opMergeTokenTransfers    = "merge_token_transfers"
+	opAddNFTTransfer         = "add_nft_transfer"
+	opMergeNFTTransfers      = "merge_nft_transfers"
+	opAddInternalTransfer    = "add_internal_transfer"
+	opMergeInternalTransfers = "merge_internal_transfers"
+	opAddWithdrawal          = "add_withdrawal"
+	opMergeWithdrawals       = "merge_withdrawals"
+	opSaveContractABI        = "save_contract_abi"
+	opSaveBlockHeader        = "save_block_header"
+	opPruneBlockHeaders      = "prune_block_headers"
+	opRollbackTo             = "rollback_to"
+	opCommitBlock            = "commit_block"
+)
+
+// FileStore is a MemoryStore made durable by an append-only log in a
+// directory. Every change is appended to the log and synced before it is
+// applied in memory, so reads never see a change that could be lost. After
+// snapshotInterval records the whole state is written to a snapshot and the
+// log starts over. Opening the store loads the snapshot and replays the log;
+// a last record torn by a crash is dropped.
+type FileStore struct {
+	*MemoryStore
+
+	dir              string
+	snapshotInterval int
+	logger           *zap.Logger
+
+	// mutex serializes changes so the log and memory apply them in the
+	// same order
+	mutex sync.Mutex
+	log   *os.File
+	// seq numbers log records; the snapshot remembers the last one it
+	// includes so records left over from a crash during compaction are
+	// not applied twice
+	seq     uint64
+	records int
+}
+
+type logRecord struct {
+	Seq               uint64                    `json:"seq"`
+	Op                string                    `json:"op"`
+	Address           string                    `json:"address,omitempty"`
+	Block             int                       `json:"block,omitempty"`
+	Subscriptions     []string                  `json:"subscriptions,omitempty"`
+	Transactions      []entity.Transaction      `json:"transactions,omitempty"`
+	TokenTransfers    []entity.TokenTransfer    `json:"token_transfers,omitempty"`
+	NFTTransfers      []entity.NFTTransfer      `json:"nft_transfers,omitempty"`
+	InternalTransfers []entity.InternalTransfer `json:"internal_transfers,omitempty"`
+	Withdrawals       []entity.Withdrawal       `json:"withdrawals,omitempty"`
+	ABI               []byte                    `json:"abi,omitempty"`
+	Header            *entity.BlockHeader       `json:"header,omitempty"`
+}
+
+type snapshotFile struct {
+	Seq                 uint64                               `json:"seq"`
+	CurrentBlock        int                                  `json:"current_block"`
+	Subscribers         []string                             `json:"subscribers"`
+	Transactions        map[string][]entity.Transaction      `json:"transactions"`
+	TokenTransfers      map[string][]entity.TokenTransfer    `json:"token_transfers"`
+	NFTTransfers        map[string][]entity.NFTTransfer      `json:"nft_transfers"`
+	InternalTransfers   map[string][]entity.InternalTransfer `json:"internal_transfers"`
+	Withdrawals         map[string][]entity.Withdrawal       `json:"withdrawals"`
+	ABIs                map[string][]byte                    `json:"abis"`
+	Headers             []entity.BlockHeader                 `json:"headers"`
+	Truncated           []string                             `json:"truncated,omitempty"`
+	CommitSubscriptions map[string]int                       `json:"commit_subscriptions,omitempty"`
+	BlockTimes          blockTimes                           `json:"block_times"`
+}
+
+// NewFileStore opens the store kept in dir, creating it when it does not
+// exist yet, and restores its state. A snapshotInterval of zero or less
+// uses DefaultSnapshotInterval.
+func NewFileStore(dir string, snapshotInterval int, options ...MemoryOption) (*FileStore, error) {
+	if snapshotInterval <= 0 {
+		snapshotInterval = DefaultSnapshotInterval
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating store directory: %w", err)
+	}
+
+	s := &FileStore{
+		MemoryStore:      NewMemoryStore(options...),
+		dir:              dir,
+		snapshotInterval: snapshotInterval,
+		logger:           logger.GetLogger(),
+	}
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening store log: %w", err)
+	}
+	if err := s.replay(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.log = file
+
+	s.logger.Info("Opened file store",
+		zap.String("dir", dir),
+		zap.Int("current_block", s.currentBlock),
+		zap.Int("replayed_records", s.records),
+	)
+	return s, nil
+}
+
+// Close compacts the log into a snapshot, so the next start does not have to
+// replay it, and closes the log. Later changes fail.
+func (s *FileStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.log == nil {
+		return nil
+	}
+	err := s.compact()
+	if closeErr := s.log.Close(); err == nil {
+		err = closeErr
+	}
+	s.log = nil
+	return err
+}
+
+func (s *FileStore) SetCurrentBlock(ctx context.Context, block int) error {
+	_, err := s.commit(ctx, logRecord{Op: opSetCurrentBlock, Block: block})
+	return err
+}
+
+func (s *FileStore) Subscribe(ctx context.Context, address string) (bool, error) {
+	if address == "" {
+		return false, nil
+	}
+	_, err := s.commit(ctx, logRecord{Op: opSubscribe, Address: address})
+	return err == nil, err
+}
+
+func (s *FileStore) AddTransaction(ctx context.Context, tx entity.Transaction) error {
+	_, err := s.commit(ctx, logRecord{Op: opAddTransaction, Transactions: []entity.Transaction{tx}})
+	return err
+}
+
+func (s *FileStore) MergeTransactions(ctx context.Context, address string, txs []entity.Transaction) (int, error) {
+	return s.commit(ctx, logRecord{Op: opMergeTransactions, Address: address, Transactions: txs})
+}
+
+func (s *FileStore) AddTokenTransfer(ctx context.Context, transfer entity.TokenTransfer) error {
+	_, err := s.commit(ctx, logRecord{Op: opAddTokenTransfer, TokenTransfers: []entity.TokenTransfer{transfer}})
+	return err
+}
+
+func (s *FileStore) MergeTokenTransfers(ctx context.Context, address string, transfers []entity.TokenTransfer) (int, error) {
+	return s.commit(ctx, logRecord{Op: opMergeTokenTransfers, Address: address, TokenTransfers: transfers})
+}
+
+func (s *FileStore) AddNFTTransfer(ctx context.Context, transfer entity.NFTTransfer) error {
+	_, err := s.commit(ctx, logRecord{Op: opAddNFTTransfer, NFTTransfers: []entity.NFTTransfer{transfer}})
+	return err
+}
+
+func (s *FileStore) MergeNFTTransfers(ctx context.Context, address string, transfers []entity.NFTTransfer) (int, error) {
+	return s.commit(ctx, logRecord{Op: opMergeNFTTransfers, Address: address, NFTTransfers: transfers})
+}
+
+func (s *FileStore) AddInternalTransfer(ctx context.Context, transfer entity.InternalTransfer) error {
+	_, err := s.commit(ctx, logRecord{Op: opAddInternalTransfer, InternalTransfers: []entity.InternalTransfer{transfer}})
+	return err
+}
+
+func (s *FileStore) MergeInternalTransfers(ctx context.Context, address string, transfers []entity.InternalTransfer) (int, error) {
+	return s.commit(ctx, logRecord{Op: opMergeInternalTransfers, Address: address, InternalTransfers: transfers})
+}
+
+func (s *FileStore) AddWithdrawal(ctx context.Context, withdrawal entity.Withdrawal) error {
+	_, err := s.commit(ctx, logRecord{Op: opAddWithdrawal, Withdrawals: []entity.Withdrawal{withdrawal}})
+	return err
+}
+
+func (s *FileStore) MergeWithdrawals(ctx context.Context, address string, withdrawals []entity.Withdrawal) (int, error) {
+	return s.commit(ctx, logRecord{Op: opMergeWithdrawals, Address: address, Withdrawals: withdrawals})
+}
+
+func (s *FileStore) SaveContractABI(ctx context.Context, address string, abi []byte) error {
+	_, err := s.commit(ctx, logRecord{Op: opSaveContractABI, Address: address, ABI: abi})
+	return err
+}
+
+func (s *FileStore) SaveBlockHeader(ctx context.Context, header entity.BlockHeader) error {
+	_, err := s.commit(ctx, logRecord{Op: opSaveBlockHeader, Header: &header})
+	return err
+}
+
+func (s *FileStore) PruneBlockHeaders(ctx context.Context, before int) error {
+	_, err := s.commit(ctx, logRecord{Op: opPruneBlockHeaders, Block: before})
+	return err
+}
+
+func (s *FileStore) RollbackTo(ctx context.Context, block int) error {
+	_, err := s.commit(ctx, logRecord{Op: opRollbackTo, Block: block})
+	return err
+}
+
+// CommitBlock logs the whole block as one record, so replaying the log
+// applies it completely or, when the record was torn, not at all.
+func (s *FileStore) CommitBlock(ctx context.Context, commit entity.BlockCommit) error {
+	_, err := s.commit(ctx, logRecord{
+		Op:                opCommitBlock,
+		Header:            &commit.Header,
+		Subscriptions:     commit.Subscriptions,
+		Transactions:      commit.Transactions,
+		TokenTransfers:    commit.TokenTransfers,
+		NFTTransfers:      commit.NFTTransfers,
+		InternalTransfers: commit.InternalTransfers,
+		Withdrawals:       commit.Withdrawals,
+	})
+	return err
+}
+
+// commit appends the record to the log, applies it in memory and compacts
+// the log once it has grown past the snapshot interval. It returns what the
+// change reports as added.
+func (s *FileStore) commit(ctx context.Context, record logRecord) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.log == nil {
+		return 0, errStoreClosed
+	}
+
+	record.Seq = s.seq + 1
+	if err := s.append(record); err != nil {
+		return 0, err
+	}
+	s.seq = record.Seq
+	s.records++
+
+	added, err := s.apply(record)
+	if err != nil {
+		return 0, err
+	}
+
+	if s.records >= s.snapshotInterval {
+		// The log still holds every change, so a failed compaction only
+		// delays the next one
+		if err := s.compact(); err != nil {
+			s.logger.Warn("Failed to compact store log",
+				zap.String("dir", s.dir),
+				zap.Error(err),
+			)
+		}
+	}
+	return added, nil
+}
+
+// append writes the record as one line and syncs it. A failed write is cut
+// off again so the log never continues after a partial record.
+func (s *FileStore) append(record logRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error encoding store record: %w", err)
+	}
+	data = append(data, '\n')
+
+	offset, err := s.log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("error writing store log: %w", err)
+	}
+	if _, err := s.log.Write(data); err != nil {
+		s.truncate(offset)
+		return fmt.Errorf("error writing store log: %w", err)
+	}
+	if err := s.log.Sync(); err != nil {
+		s.truncate(offset)
+		return fmt.Errorf("error syncing store log: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) truncate(offset int64) {
+	if err := s.log.Truncate(offset); err != nil {
+		s.logger.Error("Failed to truncate store log", zap.Error(err))
+		return
+	}
+	s.log.Seek(offset, io.SeekStart)
+}
+
+// apply performs the record's change on the in-memory state.
+func (s *FileStore) apply(record logRecord) (int, error) {
+	ctx := context.Background()
+	memory := s.MemoryStore
+
+	switch record.Op {
+	case opSetCurrentBlock:
+		return 0, memory.SetCurrentBlock(ctx, record.Block)
+	case opSubscribe:
+		_, err := memory.Subscribe(ctx, record.Address)
+		return 0, err
+	case opAddTransaction:
+		for _, tx := range record.Transactions {
+			if err := memory.AddTransaction(ctx, tx); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+	case opMergeTransactions:
+		return memory.MergeTransactions(ctx, record.Address, record.Transactions)
+	case opAddTokenTransfer:
+		for _, transfer := range record.TokenTransfers {
+			if err := memory.AddTokenTransfer(ctx, transfer); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+	case opMergeTokenTransfers:
+		return memory.MergeTokenTransfers(ctx, record.Address, record.TokenTransfers)
+	case opAddNFTTransfer:
+		for _, transfer := range record.NFTTransfers {
+			if err := memory.AddNFTTransfer(ctx, transfer); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+	case opMergeNFTTransfers:
+		return memory.MergeNFTTransfers(ctx, record.Address, record.NFTTransfers)
+	case opAddInternalTransfer:
+		for _, transfer := range record.InternalTransfers {
+			if err := memory.AddInternalTransfer(ctx, transfer); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+	case opMergeInternalTransfers:
+		return memory.MergeInternalTransfers(ctx, record.Address, record.InternalTransfers)
+	case opAddWithdrawal:
+		for _, withdrawal := range record.Withdrawals {
+			if err := memory.AddWithdrawal(ctx, withdrawal); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+	case opMergeWithdrawals:
+		return memory.MergeWithdrawals(ctx, record.Address, record.Withdrawals)
+	case opSaveContractABI:
+		return 0, memory.SaveContractABI(ctx, record.Address, record.ABI)
+	case opSaveBlockHeader:
+		if record.Header == nil {
+			return 0, fmt.Errorf("store record %d has no header", record.Seq)
+		}
+		return 0, memory.SaveBlockHeader(ctx, *record.Header)
+	case opPruneBlockHeaders:
+		return 0, memory.PruneBlockHeaders(ctx, record.Block)
+	case opRollbackTo:
+		return 0, memory.RollbackTo(ctx, record.Block)
+	case opCommitBlock:
+		if record.Header == nil {
+			return 0, fmt.Errorf("store record %d has no header", record.Seq)
+		}
+		return 0, memory.CommitBlock(ctx, entity.BlockCommit{
+			Header:            *record.Header,
+			Subscriptions:     record.Subscriptions,
+			Transactions:      record.Transactions,
+			TokenTransfers:    record.TokenTransfers,
+			NFTTransfers:      record.NFTTransfers,
+			InternalTransfers: record.InternalTransfers,
+			Withdrawals:       record.Withdrawals,
+		})
+	default:
+		return 0, fmt.Errorf("unknown store operation %q in record %d", record.Op, record.Seq)
+	}
+}
+
+// replay applies the log's records that are newer than the snapshot. An
+// incomplete or undecodable last record is what a crash during a write
+// leaves behind; it is cut off. Damage anywhere else is an error.
+func (s *FileStore) replay(file *os.File) error {
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return s.dropTornRecord(file, offset, len(line))
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading store log: %w", err)
+		}
+
+		var record logRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &record); err != nil {
+			if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+				return s.dropTornRecord(file, offset, len(line))
+			}
+			return fmt.Errorf("corrupt store log record at offset %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+
+		if record.Seq <= s.seq {
+			// Already part of the snapshot
+			continue
+		}
+		if _, err := s.apply(record); err != nil {
+			return fmt.Errorf("error replaying store log: %w", err)
+		}
+		s.seq = record.Seq
+		s.records++
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("error reading store log: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) dropTornRecord(file *os.File, offset int64, size int) error {
+	s.logger.Warn("Dropping incomplete store log record",
+		zap.Int64("offset", offset),
+		zap.Int("bytes", size),
+	)
+	if err := file.Truncate(offset); err != nil {
+		return fmt.Errorf("error truncating store log: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("error truncating store log: %w", err)
+	}
+	return file.Sync()
+}
+
+// compact writes the current state to a new snapshot, replacing the old one
+// atomically, and empties the log.
+func (s *FileStore) compact() error {
+	data, err := json.Marshal(s.snapshot())
+	if err != nil {
+		return fmt.Errorf("error encoding snapshot: %w", err)
+	}
+
+	path := filepath.Join(s.dir, snapshotFileName)
+	tmp := path + ".tmp"
+	if err := writeSynced(tmp, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error replacing snapshot: %w", err)
+	}
+	syncDir(s.dir)
+
+	// Records already in the snapshot would be skipped on replay anyway;
+	// dropping them keeps the next start fast
+	if err := s.log.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating store log: %w", err)
+	}
+	if _, err := s.log.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error truncating store log: %w", err)
+	}
+	s.records = 0
+	return s.log.Sync()
+}
+
+// snapshot copies the in-memory state. Changes are blocked by the caller.
+func (s *FileStore) snapshot() snapshotFile {
+	memory := s.MemoryStore
+	memory.mutex.RLock()
+	defer memory.mutex.RUnlock()
+
+	snapshot := snapshotFile{
+		Seq:                 s.seq,
+		CurrentBlock:        memory.currentBlock,
+		Subscribers:         make([]string, 0, len(memory.subscribers)),
+		Transactions:        memory.transactions,
+		TokenTransfers:      memory.tokenTransfers,
+		NFTTransfers:        memory.nftTransfers,
+		InternalTransfers:   memory.internalTransfers,
+		Withdrawals:         memory.withdrawals,
+		ABIs:                memory.abis,
+		Headers:             make([]entity.BlockHeader, 0, len(memory.headers)),
+		CommitSubscriptions: memory.commitSubscriptions,
+		BlockTimes:          memory.blockTimes,
+	}
+	for address, subscribed := range memory.subscribers {
+		if subscribed {
+			snapshot.Subscribers = append(snapshot.Subscribers, address)
+		}
+	}
+	sort.Strings(snapshot.Subscribers)
+	for address := range memory.truncated {
+		snapshot.Truncated = append(snapshot.Truncated, address)
+	}
+	sort.Strings(snapshot.Truncated)
+	for _, header := range memory.headers {
+		snapshot.Headers = append(snapshot.Headers, header)
+	}
+	sort.Slice(snapshot.Headers, func(i, j int) bool {
+		return snapshot.Headers[i].Number < snapshot.Headers[j].Number
+	})
+	return snapshot
+}
+
+// loadSnapshot restores the state saved by the last compaction, if any.
+func (s *FileStore) loadSnapshot() error {
+	path := filepath.Join(s.dir, snapshotFileName)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading snapshot: %w", err)
+	}
+
+	var snapshot snapshotFile
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("error decoding snapshot %s: %w", path, err)
+	}
+
+	memory := s.MemoryStore
+	memory.currentBlock = snapshot.CurrentBlock
+	for _, address := range snapshot.Subscribers {
+		memory.subscribers[address] = true
+	}
+	for _, header := range snapshot.Headers {
+		memory.headers[header.Number] = header
+	}
+	for _, address := range snapshot.Truncated {
+		memory.truncated[address] = true
+	}
+	if snapshot.Transactions != nil {
+		memory.transactions = snapshot.Transactions
+	}
+	if snapshot.TokenTransfers != nil {
+		memory.tokenTransfers = snapshot.TokenTransfers
+	}
+	if snapshot.NFTTransfers != nil {
+		memory.nftTransfers = snapshot.NFTTransfers
+	}
+	if snapshot.InternalTransfers != nil {
+		memory.internalTransfers = snapshot.InternalTransfers
+	}
+	if snapshot.Withdrawals != nil {
+		memory.withdrawals = snapshot.Withdrawals
+	}
+	if snapshot.ABIs != nil {
+		memory.abis = snapshot.ABIs
+	}
+	if snapshot.CommitSubscriptions != nil {
+		memory.commitSubscriptions = snapshot.CommitSubscriptions
+	}
+	memory.blockTimes = snapshot.BlockTimes
+	memory.reindex()
+	s.seq = snapshot.Seq
+	return nil
+}
+
+func writeSynced(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("error syncing snapshot: %w", err)
+	}
+	return file.Close()
+}
+
+// syncDir makes a rename in dir durable. Not every platform supports
+// syncing a directory, so failures are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
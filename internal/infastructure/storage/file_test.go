@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"context"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testAddress = "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+
+// fill makes the changes a parsed block and a backfill would make.
+func fill(t *testing.T, store *FileStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	steps := []func() error{
+		func() error { _, err := store.Subscribe(ctx, "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"); return err },
+		func() error {
+			return store.AddTransaction(ctx, entity.Transaction{
+				Hash: "0xa", From: testAddress, To: "0x1", Value: big.NewInt(7), BlockNumber: 10,
+			})
+		},
+		func() error {
+			_, err := store.MergeTransactions(ctx, testAddress, []entity.Transaction{
+				{Hash: "0xb", From: "0x1", To: testAddress, Value: new(big.Int).Lsh(big.NewInt(1), 100), BlockNumber: 5},
+			})
+			return err
+		},
+		func() error {
+			return store.AddWithdrawal(ctx, entity.Withdrawal{Index: 3, Address: testAddress, Amount: big.NewInt(1), BlockNumber: 10})
+		},
+		func() error { return store.SaveContractABI(ctx, "0x1", []byte(`[]`)) },
+		func() error {
+			return store.SaveBlockHeader(ctx, entity.BlockHeader{Number: 10, Hash: "0x10", Timestamp: 100})
+		},
+		func() error { return store.SetCurrentBlock(ctx, 10) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("Step %d error = %v", i, err)
+		}
+	}
+}
+
+// assertFilled checks that the state written by fill was restored.
+func assertFilled(t *testing.T, store *FileStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	if block, _ := store.GetCurrentBlock(ctx); block != 10 {
+		t.Errorf("GetCurrentBlock() = %d, want 10", block)
+	}
+	if subscribed, _ := store.IsSubscribed(ctx, testAddress); !subscribed {
+		t.Error("IsSubscribed() = false, want true")
+	}
+	txs, _ := store.GetTransactions(ctx, testAddress)
+	if len(txs) != 2 || txs[0].Hash != "0xb" || txs[1].Hash != "0xa" {
+		t.Fatalf("GetTransactions() = %+v, want 0xb then 0xa", txs)
+	}
+	if want := new(big.Int).Lsh(big.NewInt(1), 100); txs[0].Value.Cmp(want) != 0 {
+		t.Errorf("Restored value = %s, want %s", txs[0].Value, want)
+	}
+	if withdrawals, _ := store.GetWithdrawals(ctx, testAddress); len(withdrawals) != 1 {
+		t.Errorf("GetWithdrawals() returned %d withdrawals, want 1", len(withdrawals))
+	}
+	if abi, ok, _ := store.GetContractABI(ctx, "0x1"); !ok || string(abi) != "[]" {
+		t.Errorf("GetContractABI() = %q, %v, want [] and true", abi, ok)
+	}
+	if header, ok, _ := store.GetBlockHeader(ctx, 10); !ok || header.Timestamp != 100 {
+		t.Errorf("GetBlockHeader() = %+v, %v, want timestamp 100", header, ok)
+	}
+}
+
+func TestFileStore_RestoresFromLog(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	fill(t, store)
+
+	// Reopen without Close, as after a crash, so only the log is there
+	reopened, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() after crash error = %v", err)
+	}
+	assertFilled(t, reopened)
+}
+
+func TestFileStore_RestoresFromSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	// Compact after every other record, so the state is split between the
+	// snapshot and the log
+	store, err := NewFileStore(dir, 2)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	fill(t, store)
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); err != nil {
+		t.Fatalf("Snapshot not written: %v", err)
+	}
+
+	reopened, err := NewFileStore(dir, 2)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	assertFilled(t, reopened)
+
+	if err := reopened.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := reopened.SetCurrentBlock(context.Background(), 11); err == nil {
+		t.Error("SetCurrentBlock() after Close succeeded, want error")
+	}
+	if info, _ := os.Stat(filepath.Join(dir, logFileName)); info.Size() != 0 {
+		t.Errorf("Log size after Close = %d, want 0", info.Size())
+	}
+
+	again, err := NewFileStore(dir, 2)
+	if err != nil {
+		t.Fatalf("NewFileStore() after Close error = %v", err)
+	}
+	assertFilled(t, again)
+}
+
+func TestFileStore_SkipsRecordsInSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	fill(t, store)
+
+	// A crash between writing the snapshot and emptying the log leaves
+	// records the snapshot already includes
+	log, err := os.ReadFile(filepath.Join(dir, logFileName))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, logFileName), log, 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	reopened, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	assertFilled(t, reopened)
+}
+
+func TestFileStore_DropsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	fill(t, store)
+
+	// Simulate a crash in the middle of writing the next record
+	path := filepath.Join(dir, logFileName)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	file.WriteString(`{"seq":99,"op":"set_current_block","blo`)
+	file.Close()
+
+	reopened, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() with torn record error = %v", err)
+	}
+	assertFilled(t, reopened)
+
+	// Writing continues cleanly after the dropped record
+	if err := reopened.SetCurrentBlock(context.Background(), 11); err != nil {
+		t.Fatalf("SetCurrentBlock() error = %v", err)
+	}
+	again, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	if block, _ := again.GetCurrentBlock(context.Background()); block != 11 {
+		t.Errorf("GetCurrentBlock() = %d, want 11", block)
+	}
+}
+
+func TestFileStore_CorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	fill(t, store)
+
+	// Damage before the last record is not something a crash leaves behind
+	path := filepath.Join(dir, logFileName)
+	data, _ := os.ReadFile(path)
+	data[1] = '!'
+	os.WriteFile(path, data, 0o644)
+
+	if _, err := NewFileStore(dir, 0); err == nil {
+		t.Error("NewFileStore() with corrupt record succeeded, want error")
+	}
+}
+
+func TestFileStore_CommitBlock(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	store.Subscribe(ctx, testAddress)
+
+	commit := entity.BlockCommit{
+		Header:       entity.BlockHeader{Number: 10, Hash: "0x10", Timestamp: 100},
+		Transactions: []entity.Transaction{{Hash: "0xa", From: testAddress, BlockNumber: 10}},
+		Withdrawals:  []entity.Withdrawal{{Index: 1, Address: testAddress, BlockNumber: 10}},
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.CommitBlock(ctx, commit); err != nil {
+			t.Fatalf("CommitBlock() %d error = %v", i, err)
+		}
+	}
+
+	reopened, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	if block, _ := reopened.GetCurrentBlock(ctx); block != 10 {
+		t.Errorf("GetCurrentBlock() = %d, want 10", block)
+	}
+	if header, ok, _ := reopened.GetBlockHeader(ctx, 10); !ok || header != commit.Header {
+		t.Errorf("GetBlockHeader() = %+v, %v, want %+v", header, ok, commit.Header)
+	}
+	if txs, _ := reopened.GetTransactions(ctx, testAddress); len(txs) != 1 {
+		t.Errorf("GetTransactions() returned %d transactions, want 1", len(txs))
+	}
+	if withdrawals, _ := reopened.GetWithdrawals(ctx, testAddress); len(withdrawals) != 1 {
+		t.Errorf("GetWithdrawals() returned %d withdrawals, want 1", len(withdrawals))
+	}
+}
+
+func TestFileStore_CommitSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	store.Subscribe(ctx, testAddress)
+
+	contract := "0x5fbdb2315678afecb367f032d93f642f64180aa3"
+	direct := "0x28c6c06298d514db089934071355e5743bf21d60"
+	commit := entity.BlockCommit{
+		Header:        entity.BlockHeader{Number: 10, Hash: "0x10"},
+		Subscriptions: []string{contract, direct, testAddress},
+		Transactions:  []entity.Transaction{{Hash: "0xa", From: testAddress, CreatedContract: contract, BlockNumber: 10}},
+	}
+	if err := store.CommitBlock(ctx, commit); err != nil {
+		t.Fatalf("CommitBlock() error = %v", err)
+	}
+	store.Subscribe(ctx, direct)
+
+	reopened, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	if txs, _ := reopened.GetTransactions(ctx, contract); len(txs) != 1 {
+		t.Errorf("GetTransactions() for the contract returned %d transactions, want its creation", len(txs))
+	}
+
+	// Rolling the block back undoes only the subscription the commit made
+	if err := reopened.RollbackTo(ctx, 9); err != nil {
+		t.Fatalf("RollbackTo() error = %v", err)
+	}
+	want := []string{direct, testAddress}
+	if subscriptions, _ := reopened.GetSubscriptions(ctx); !reflect.DeepEqual(subscriptions, want) {
+		t.Errorf("GetSubscriptions() after rollback = %v, want %v", subscriptions, want)
+	}
+}
+
+func TestFileStore_AddReplacesDuplicates(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	store.Subscribe(ctx, testAddress)
+
+	// A self-transfer, stored again as when its block is re-processed
+	self := entity.Transaction{Hash: "0xa", From: testAddress, To: testAddress, Value: big.NewInt(1), BlockNumber: 10}
+	store.AddTransaction(ctx, entity.Transaction{Hash: "0x9", From: testAddress, BlockNumber: 9})
+	store.AddTransaction(ctx, self)
+	self.Receipt = &entity.Receipt{Status: entity.ReceiptStatusSuccess}
+	store.AddTransaction(ctx, self)
+	transfer := entity.TokenTransfer{Token: "0xt", From: testAddress, To: testAddress, TransactionHash: "0xa", LogIndex: 1, BlockNumber: 10}
+	store.AddTokenTransfer(ctx, transfer)
+	store.AddTokenTransfer(ctx, transfer)
+	internal := entity.InternalTransfer{TransactionHash: "0xa", TracePath: []int{0}, From: testAddress, To: "0x1", BlockNumber: 10}
+	store.AddInternalTransfer(ctx, internal)
+	store.AddInternalTransfer(ctx, internal)
+
+	reopened, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	txs, _ := reopened.GetTransactions(ctx, testAddress)
+	if len(txs) != 2 || txs[1].Hash != "0xa" || txs[1].Receipt == nil {
+		t.Errorf("GetTransactions() = %+v, want 0x9 and 0xa once with its receipt", txs)
+	}
+	if transfers, _ := reopened.GetTokenTransfers(ctx, testAddress); len(transfers) != 1 {
+		t.Errorf("GetTokenTransfers() returned %d transfers, want 1", len(transfers))
+	}
+	if transfers, _ := reopened.GetInternalTransfers(ctx, testAddress); len(transfers) != 1 {
+		t.Errorf("GetInternalTransfers() returned %d transfers, want 1", len(transfers))
+	}
+}
@@ -1,8 +1,13 @@
 package storage
 
 import (
+	"context"
+	"fmt"
 	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/logger"
 	"go.uber.org/zap"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -11,33 +16,86 @@ type MemoryStore struct {
 	currentBlock int
 	subscribers  map[string]bool
 	transactions map[string][]entity.Transaction
+	headers      map[int]entity.BlockHeader
 	mutex        *sync.RWMutex
 	logger       *zap.Logger
+
+	// tokenTransfers holds each subscribed address's token transfers
+	tokenTransfers map[string][]entity.TokenTransfer
+	// nftTransfers holds each subscribed address's NFT transfers
+	nftTransfers map[string][]entity.NFTTransfer
+	// internalTransfers holds each subscribed address's traced internal transfers
+	internalTransfers map[string][]entity.InternalTransfer
+	// withdrawals holds each subscribed address's beacon chain withdrawals
+	withdrawals map[string][]entity.Withdrawal
+	// abis holds uploaded contract ABIs by contract address
+	abis map[string][]byte
+	// commitSubscriptions holds the block whose commit subscribed an
+	// address, until the address is subscribed directly
+	commitSubscriptions map[string]int
+
+	retention RetentionPolicy
+	// truncated marks addresses whose history lost records to retention
+	truncated map[string]bool
+	// bytes is the estimated size of all records, kept while MaxBytes is set
+	bytes int64
+	// oldest orders the non-empty histories by their oldest record, kept
+	// while the policy evicts across addresses
+	oldest        oldestHeap
+	oldestEntries map[historyKey]*oldestEntry
+	// blockTimes dates records without a timestamp for MaxAge
+	blockTimes blockTimes
 }
 
-func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{
-		subscribers:  make(map[string]bool),
-		transactions: make(map[string][]entity.Transaction),
-		mutex:        &sync.RWMutex{},
+func NewMemoryStore(options ...MemoryOption) *MemoryStore {
+	s := &MemoryStore{
+		subscribers:         make(map[string]bool),
+		transactions:        make(map[string][]entity.Transaction),
+		tokenTransfers:      make(map[string][]entity.TokenTransfer),
+		nftTransfers:        make(map[string][]entity.NFTTransfer),
+		internalTransfers:   make(map[string][]entity.InternalTransfer),
+		withdrawals:         make(map[string][]entity.Withdrawal),
+		abis:                make(map[string][]byte),
+		commitSubscriptions: make(map[string]int),
+		headers:             make(map[int]entity.BlockHeader),
+		truncated:           make(map[string]bool),
+		mutex:               &sync.RWMutex{},
+		logger:              logger.GetLogger(),
+	}
+	for _, option := range options {
+		option(s)
 	}
+	return s
 }
 
-func (s *MemoryStore) GetCurrentBlock() int {
+func (s *MemoryStore) GetCurrentBlock(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
-	return s.currentBlock
+	return s.currentBlock, nil
 }
 
-func (s *MemoryStore) SetCurrentBlock(block int) {
+func (s *MemoryStore) SetCurrentBlock(ctx context.Context, block int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.currentBlock = block
+	s.retain()
+	return nil
 }
 
-func (s *MemoryStore) Subscribe(address string) bool {
+func (s *MemoryStore) Subscribe(ctx context.Context, address string) (bool, error) {
 	if s == nil || address == "" {
-		return false
+		return false, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
 	}
 
 	s.mutex.Lock()
@@ -49,63 +107,794 @@ func (s *MemoryStore) Subscribe(address string) bool {
 	// Normalize the address as without this we didn't match correctly in the processing
 	address = strings.ToLower(address)
 	s.subscribers[address] = true
-	return true
+	// A direct subscription outlives the rollback of the block that made it
+	delete(s.commitSubscriptions, address)
+	return true, nil
 }
 
-func (s *MemoryStore) IsSubscribed(address string) bool {
+func (s *MemoryStore) IsSubscribed(ctx context.Context, address string) (bool, error) {
 	if s == nil || address == "" {
-		return false
+		return false, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
 	}
 
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
 	if s.subscribers == nil {
-		return false
+		return false, nil
 	}
 
 	address = strings.ToLower(address)
-	return s.subscribers[address]
+	return s.subscribers[address], nil
 }
 
-func (s *MemoryStore) AddTransaction(tx entity.Transaction) {
+func (s *MemoryStore) GetSubscriptions(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	addresses := make([]string, 0, len(s.subscribers))
+	for address := range s.subscribers {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+func (s *MemoryStore) AddTransaction(ctx context.Context, tx entity.Transaction) error {
 	if s == nil {
-		return
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	s.addTransaction(tx)
+	s.retain()
+	return nil
+}
+
+// addTransaction stores the transaction under whichever of its addresses are
+// subscribed. The caller holds the mutex.
+func (s *MemoryStore) addTransaction(tx entity.Transaction) {
 	if s.transactions == nil {
 		s.transactions = make(map[string][]entity.Transaction)
 	}
 
 	from := strings.ToLower(tx.From)
 	to := strings.ToLower(tx.To)
+	if tx.IsContractCreation() {
+		// A deployed contract's history starts with its creation
+		to = strings.ToLower(tx.CreatedContract)
+	}
 
 	if s.subscribers[from] {
-		s.transactions[from] = append(s.transactions[from], tx)
+		transactionRecords.put(s, from, tx)
 	}
 	if s.subscribers[to] {
-		s.transactions[to] = append(s.transactions[to], tx)
+		transactionRecords.put(s, to, tx)
+	}
+}
+
+func (s *MemoryStore) MergeTransactions(ctx context.Context, address string, txs []entity.Transaction) (int, error) {
+	if s == nil || address == "" {
+		return 0, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.transactions == nil {
+		s.transactions = make(map[string][]entity.Transaction)
+	}
+
+	address = strings.ToLower(address)
+	existing := s.transactions[address]
+	known := make(map[string]bool, len(existing))
+	for _, tx := range existing {
+		known[tx.Hash] = true
+	}
+
+	merged := make([]entity.Transaction, len(existing), len(existing)+len(txs))
+	copy(merged, existing)
+	added := 0
+	for _, tx := range txs {
+		if known[tx.Hash] {
+			continue
+		}
+		known[tx.Hash] = true
+		merged = append(merged, tx)
+		added++
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].BlockNumber < merged[j].BlockNumber
+	})
+	transactionRecords.set(s, address, merged)
+	s.retain()
+	return added, nil
+}
+
+// IsHistoryTruncated reports whether retention evicted any of the address's
+// records.
+func (s *MemoryStore) IsHistoryTruncated(ctx context.Context, address string) (bool, error) {
+	if s == nil || address == "" {
+		return false, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
 	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.truncated[strings.ToLower(address)], nil
 }
 
-func (s *MemoryStore) GetTransactions(address string) []entity.Transaction {
+func (s *MemoryStore) GetTransactions(ctx context.Context, address string) ([]entity.Transaction, error) {
 	if s == nil || address == "" {
-		return []entity.Transaction{}
+		return []entity.Transaction{}, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
 	if s.transactions == nil {
-		return []entity.Transaction{}
+		return []entity.Transaction{}, nil
 	}
 
 	address = strings.ToLower(address)
 	if transactions, exists := s.transactions[address]; exists {
-		return transactions
+		return transactions, nil
+	}
+	return []entity.Transaction{}, nil
+}
+
+func (s *MemoryStore) AddTokenTransfer(ctx context.Context, transfer entity.TokenTransfer) error {
+	if s == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.addTokenTransfer(transfer)
+	s.retain()
+	return nil
+}
+
+// addTokenTransfer stores the token transfer under whichever of its addresses
+// are subscribed. The caller holds the mutex.
+func (s *MemoryStore) addTokenTransfer(transfer entity.TokenTransfer) {
+	if s.tokenTransfers == nil {
+		s.tokenTransfers = make(map[string][]entity.TokenTransfer)
+	}
+
+	from := strings.ToLower(transfer.From)
+	to := strings.ToLower(transfer.To)
+
+	if s.subscribers[from] {
+		tokenTransferRecords.put(s, from, transfer)
+	}
+	if s.subscribers[to] {
+		tokenTransferRecords.put(s, to, transfer)
+	}
+}
+
+func (s *MemoryStore) MergeTokenTransfers(ctx context.Context, address string, transfers []entity.TokenTransfer) (int, error) {
+	if s == nil || address == "" {
+		return 0, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.tokenTransfers == nil {
+		s.tokenTransfers = make(map[string][]entity.TokenTransfer)
+	}
+
+	type logKey struct {
+		hash  string
+		index int
+	}
+
+	address = strings.ToLower(address)
+	existing := s.tokenTransfers[address]
+	known := make(map[logKey]bool, len(existing))
+	for _, transfer := range existing {
+		known[logKey{transfer.TransactionHash, transfer.LogIndex}] = true
+	}
+
+	merged := make([]entity.TokenTransfer, len(existing), len(existing)+len(transfers))
+	copy(merged, existing)
+	added := 0
+	for _, transfer := range transfers {
+		key := logKey{transfer.TransactionHash, transfer.LogIndex}
+		if known[key] {
+			continue
+		}
+		known[key] = true
+		merged = append(merged, transfer)
+		added++
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].BlockNumber < merged[j].BlockNumber
+	})
+	tokenTransferRecords.set(s, address, merged)
+	s.retain()
+	return added, nil
+}
+
+func (s *MemoryStore) GetTokenTransfers(ctx context.Context, address string) ([]entity.TokenTransfer, error) {
+	if s == nil || address == "" {
+		return []entity.TokenTransfer{}, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	address = strings.ToLower(address)
+	if transfers, exists := s.tokenTransfers[address]; exists {
+		return transfers, nil
+	}
+	return []entity.TokenTransfer{}, nil
+}
+
+func (s *MemoryStore) AddNFTTransfer(ctx context.Context, transfer entity.NFTTransfer) error {
+	if s == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.addNFTTransfer(transfer)
+	s.retain()
+	return nil
+}
+
+// addNFTTransfer stores the NFT transfer under whichever of its addresses are
+// subscribed. The caller holds the mutex.
+func (s *MemoryStore) addNFTTransfer(transfer entity.NFTTransfer) {
+	if s.nftTransfers == nil {
+		s.nftTransfers = make(map[string][]entity.NFTTransfer)
+	}
+
+	from := strings.ToLower(transfer.From)
+	to := strings.ToLower(transfer.To)
+
+	if s.subscribers[from] {
+		nftTransferRecords.put(s, from, transfer)
+	}
+	if s.subscribers[to] {
+		nftTransferRecords.put(s, to, transfer)
+	}
+}
+
+func (s *MemoryStore) MergeNFTTransfers(ctx context.Context, address string, transfers []entity.NFTTransfer) (int, error) {
+	if s == nil || address == "" {
+		return 0, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.nftTransfers == nil {
+		s.nftTransfers = make(map[string][]entity.NFTTransfer)
+	}
+
+	type logKey struct {
+		hash  string
+		index int
+	}
+
+	address = strings.ToLower(address)
+	existing := s.nftTransfers[address]
+	known := make(map[logKey]bool, len(existing))
+	for _, transfer := range existing {
+		known[logKey{transfer.TransactionHash, transfer.LogIndex}] = true
+	}
+
+	merged := make([]entity.NFTTransfer, len(existing), len(existing)+len(transfers))
+	copy(merged, existing)
+	added := 0
+	for _, transfer := range transfers {
+		key := logKey{transfer.TransactionHash, transfer.LogIndex}
+		if known[key] {
+			continue
+		}
+		known[key] = true
+		merged = append(merged, transfer)
+		added++
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].BlockNumber < merged[j].BlockNumber
+	})
+	nftTransferRecords.set(s, address, merged)
+	s.retain()
+	return added, nil
+}
+
+func (s *MemoryStore) GetNFTTransfers(ctx context.Context, address string) ([]entity.NFTTransfer, error) {
+	if s == nil || address == "" {
+		return []entity.NFTTransfer{}, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	address = strings.ToLower(address)
+	if transfers, exists := s.nftTransfers[address]; exists {
+		return transfers, nil
+	}
+	return []entity.NFTTransfer{}, nil
+}
+
+func (s *MemoryStore) AddInternalTransfer(ctx context.Context, transfer entity.InternalTransfer) error {
+	if s == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.addInternalTransfer(transfer)
+	s.retain()
+	return nil
+}
+
+// addInternalTransfer stores the internal transfer under whichever of its
+// addresses are subscribed. The caller holds the mutex.
+func (s *MemoryStore) addInternalTransfer(transfer entity.InternalTransfer) {
+	if s.internalTransfers == nil {
+		s.internalTransfers = make(map[string][]entity.InternalTransfer)
+	}
+
+	from := strings.ToLower(transfer.From)
+	to := strings.ToLower(transfer.To)
+
+	if s.subscribers[from] {
+		internalTransferRecords.put(s, from, transfer)
+	}
+	if s.subscribers[to] {
+		internalTransferRecords.put(s, to, transfer)
+	}
+}
+
+func (s *MemoryStore) MergeInternalTransfers(ctx context.Context, address string, transfers []entity.InternalTransfer) (int, error) {
+	if s == nil || address == "" {
+		return 0, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.internalTransfers == nil {
+		s.internalTransfers = make(map[string][]entity.InternalTransfer)
+	}
+
+	type traceKey struct {
+		hash string
+		path string
+	}
+
+	address = strings.ToLower(address)
+	existing := s.internalTransfers[address]
+	known := make(map[traceKey]bool, len(existing))
+	for _, transfer := range existing {
+		known[traceKey{transfer.TransactionHash, fmt.Sprint(transfer.TracePath)}] = true
+	}
+
+	merged := make([]entity.InternalTransfer, len(existing), len(existing)+len(transfers))
+	copy(merged, existing)
+	added := 0
+	for _, transfer := range transfers {
+		key := traceKey{transfer.TransactionHash, fmt.Sprint(transfer.TracePath)}
+		if known[key] {
+			continue
+		}
+		known[key] = true
+		merged = append(merged, transfer)
+		added++
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].BlockNumber < merged[j].BlockNumber
+	})
+	internalTransferRecords.set(s, address, merged)
+	s.retain()
+	return added, nil
+}
+
+func (s *MemoryStore) GetInternalTransfers(ctx context.Context, address string) ([]entity.InternalTransfer, error) {
+	if s == nil || address == "" {
+		return []entity.InternalTransfer{}, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	address = strings.ToLower(address)
+	if transfers, exists := s.internalTransfers[address]; exists {
+		return transfers, nil
+	}
+	return []entity.InternalTransfer{}, nil
+}
+
+func (s *MemoryStore) AddWithdrawal(ctx context.Context, withdrawal entity.Withdrawal) error {
+	if s == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.addWithdrawal(withdrawal)
+	s.retain()
+	return nil
+}
+
+// addWithdrawal stores the withdrawal under its address when that is
+// subscribed. The caller holds the mutex.
+func (s *MemoryStore) addWithdrawal(withdrawal entity.Withdrawal) {
+	if s.withdrawals == nil {
+		s.withdrawals = make(map[string][]entity.Withdrawal)
+	}
+
+	address := strings.ToLower(withdrawal.Address)
+	if s.subscribers[address] {
+		withdrawalRecords.put(s, address, withdrawal)
+	}
+}
+
+func (s *MemoryStore) MergeWithdrawals(ctx context.Context, address string, withdrawals []entity.Withdrawal) (int, error) {
+	if s == nil || address == "" {
+		return 0, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.withdrawals == nil {
+		s.withdrawals = make(map[string][]entity.Withdrawal)
+	}
+
+	address = strings.ToLower(address)
+	existing := s.withdrawals[address]
+	known := make(map[uint64]bool, len(existing))
+	for _, withdrawal := range existing {
+		known[withdrawal.Index] = true
+	}
+
+	merged := make([]entity.Withdrawal, len(existing), len(existing)+len(withdrawals))
+	copy(merged, existing)
+	added := 0
+	for _, withdrawal := range withdrawals {
+		if known[withdrawal.Index] {
+			continue
+		}
+		known[withdrawal.Index] = true
+		merged = append(merged, withdrawal)
+		added++
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].BlockNumber < merged[j].BlockNumber
+	})
+	withdrawalRecords.set(s, address, merged)
+	s.retain()
+	return added, nil
+}
+
+func (s *MemoryStore) GetWithdrawals(ctx context.Context, address string) ([]entity.Withdrawal, error) {
+	if s == nil || address == "" {
+		return []entity.Withdrawal{}, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	address = strings.ToLower(address)
+	if withdrawals, exists := s.withdrawals[address]; exists {
+		return withdrawals, nil
+	}
+	return []entity.Withdrawal{}, nil
+}
+
+func (s *MemoryStore) SaveContractABI(ctx context.Context, address string, abi []byte) error {
+	if s == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.abis == nil {
+		s.abis = make(map[string][]byte)
+	}
+	s.abis[strings.ToLower(address)] = append([]byte(nil), abi...)
+	return nil
+}
+
+func (s *MemoryStore) GetContractABI(ctx context.Context, address string) ([]byte, bool, error) {
+	if s == nil {
+		return nil, false, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	abi, exists := s.abis[strings.ToLower(address)]
+	return abi, exists, nil
+}
+
+func (s *MemoryStore) GetContractABIs(ctx context.Context) (map[string][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	return []entity.Transaction{}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	abis := make(map[string][]byte, len(s.abis))
+	for address, abi := range s.abis {
+		abis[address] = abi
+	}
+	return abis, nil
+}
+
+func (s *MemoryStore) SaveBlockHeader(ctx context.Context, header entity.BlockHeader) error {
+	if s == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.headers == nil {
+		s.headers = make(map[int]entity.BlockHeader)
+	}
+	s.headers[header.Number] = header
+	return nil
+}
+
+func (s *MemoryStore) GetBlockHeader(ctx context.Context, number int) (entity.BlockHeader, bool, error) {
+	if s == nil {
+		return entity.BlockHeader{}, false, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return entity.BlockHeader{}, false, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	header, exists := s.headers[number]
+	return header, exists, nil
+}
+
+func (s *MemoryStore) PruneBlockHeaders(ctx context.Context, before int) error {
+	if s == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for number := range s.headers {
+		if number < before {
+			delete(s.headers, number)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) CommitBlock(ctx context.Context, commit entity.BlockCommit) error {
+	if s == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.headers == nil {
+		s.headers = make(map[int]entity.BlockHeader)
+	}
+	if stored, exists := s.headers[commit.Header.Number]; exists &&
+		stored.Hash == commit.Header.Hash && s.currentBlock >= commit.Header.Number {
+		// Already committed
+		return nil
+	}
+
+	if s.commitSubscriptions == nil {
+		s.commitSubscriptions = make(map[string]int)
+	}
+	for _, address := range commit.Subscriptions {
+		address = strings.ToLower(address)
+		if address == "" || s.subscribers[address] {
+			continue
+		}
+		s.subscribers[address] = true
+		s.commitSubscriptions[address] = commit.Header.Number
+	}
+
+	for _, tx := range commit.Transactions {
+		s.addTransaction(tx)
+	}
+	for _, transfer := range commit.TokenTransfers {
+		s.addTokenTransfer(transfer)
+	}
+	for _, transfer := range commit.NFTTransfers {
+		s.addNFTTransfer(transfer)
+	}
+	for _, transfer := range commit.InternalTransfers {
+		s.addInternalTransfer(transfer)
+	}
+	for _, withdrawal := range commit.Withdrawals {
+		s.addWithdrawal(withdrawal)
+	}
+	s.headers[commit.Header.Number] = commit.Header
+	s.currentBlock = commit.Header.Number
+	if s.retention.MaxAge > 0 {
+		s.blockTimes.observe(commit.Header.Number, commit.Header.Timestamp, s.retention.MaxAge)
+	}
+	s.retain()
+	return nil
+}
+
+func (s *MemoryStore) RollbackTo(ctx context.Context, block int) error {
+	if s == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	transactionRecords.keep(s, block)
+	tokenTransferRecords.keep(s, block)
+	nftTransferRecords.keep(s, block)
+	internalTransferRecords.keep(s, block)
+	withdrawalRecords.keep(s, block)
+	s.blockTimes.forget(block)
+
+	for number := range s.headers {
+		if number > block {
+			delete(s.headers, number)
+		}
+	}
+
+	for address, subscribed := range s.commitSubscriptions {
+		if subscribed > block {
+			delete(s.subscribers, address)
+			delete(s.commitSubscriptions, address)
+			transactionRecords.remove(s, address)
+			tokenTransferRecords.remove(s, address)
+			nftTransferRecords.remove(s, address)
+			internalTransferRecords.remove(s, address)
+			withdrawalRecords.remove(s, address)
+			delete(s.truncated, address)
+		}
+	}
+
+	if s.currentBlock > block {
+		s.currentBlock = block
+	}
+	return nil
+}
+
+// upsert replaces the record in history that has the same key, or appends
+// it when there is none. History is ordered by block number and a key
+// belongs to a single block, so only the trailing records from that block
+// are searched. A replaced record is written to a copy, as earlier reads may
+// still hold the old slice, and returned along with the new history.
+func upsert[T any](history []T, record T, key func(T) (int, string)) ([]T, T, bool) {
+	block, id := key(record)
+	for i := len(history) - 1; i >= 0; i-- {
+		storedBlock, storedID := key(history[i])
+		if storedBlock < block {
+			break
+		}
+		if storedID == id {
+			updated := make([]T, len(history))
+			copy(updated, history)
+			replaced := updated[i]
+			updated[i] = record
+			return updated, replaced, true
+		}
+	}
+	var none T
+	return append(history, record), none, false
+}
+
+// The key functions return a record's block number and what identifies it
+// within the chain.
+
+func transactionKey(tx entity.Transaction) (int, string) {
+	return tx.BlockNumber, tx.Hash
+}
+
+func tokenTransferKey(transfer entity.TokenTransfer) (int, string) {
+	return transfer.BlockNumber, fmt.Sprintf("%s/%d", transfer.TransactionHash, transfer.LogIndex)
+}
+
+func nftTransferKey(transfer entity.NFTTransfer) (int, string) {
+	return transfer.BlockNumber, fmt.Sprintf("%s/%d", transfer.TransactionHash, transfer.LogIndex)
+}
+
+func internalTransferKey(transfer entity.InternalTransfer) (int, string) {
+	return transfer.BlockNumber, fmt.Sprintf("%s/%v", transfer.TransactionHash, transfer.TracePath)
+}
+
+func withdrawalKey(withdrawal entity.Withdrawal) (int, string) {
+	return withdrawal.BlockNumber, strconv.FormatUint(withdrawal.Index, 10)
 }
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// migration is one versioned schema change. Statements may use {{uint256}}
+// for exact unsigned 256-bit amounts and {{json}} for JSON documents; they
+// are replaced with the dialect's column types.
+type migration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+// migrations lists every schema change in order. Released migrations must
+// never change; add a new version instead.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create tables",
+		statements: []string{
+			`CREATE TABLE parser_state (
+				id            INTEGER PRIMARY KEY,
+				current_block BIGINT NOT NULL
+			)`,
+			`CREATE TABLE subscriptions (
+				address    TEXT PRIMARY KEY,
+				created_at BIGINT NOT NULL
+			)`,
+			`CREATE TABLE transactions (
+				address                  TEXT NOT NULL,
+				hash                     TEXT NOT NULL,
+				from_address             TEXT NOT NULL,
+				to_address               TEXT NOT NULL,
+				value                    {{uint256}} NOT NULL,
+				block_number             BIGINT NOT NULL,
+				block_hash               TEXT NOT NULL,
+				block_timestamp          BIGINT NOT NULL,
+				transaction_index        INTEGER NOT NULL,
+				nonce                    BIGINT NOT NULL,
+				gas                      BIGINT NOT NULL,
+				gas_price                TEXT NOT NULL,
+				max_fee_per_gas          TEXT NOT NULL,
+				max_priority_fee_per_gas TEXT NOT NULL,
+				input                    TEXT NOT NULL,
+				type                     INTEGER NOT NULL,
+				chain_id                 BIGINT NOT NULL,
+				created_contract         TEXT NOT NULL,
+				receipt                  {{json}},
+				PRIMARY KEY (address, hash)
+			)`,
+			`CREATE TABLE token_transfers (
+				address          TEXT NOT NULL,
+				transaction_hash TEXT NOT NULL,
+				log_index        INTEGER NOT NULL,
+				token            TEXT NOT NULL,
+				from_address     TEXT NOT NULL,
+				to_address       TEXT NOT NULL,
+				amount           {{uint256}} NOT NULL,
+				block_number     BIGINT NOT NULL,
+				block_hash       TEXT NOT NULL,
+				PRIMARY KEY (address, transaction_hash, log_index)
+			)`,
+			`CREATE TABLE nft_transfers (
+				address          TEXT NOT NULL,
+				transaction_hash TEXT NOT NULL,
+				log_index        INTEGER NOT NULL,
+				contract         TEXT NOT NULL,
+				standard         TEXT NOT NULL,
+				operator         TEXT NOT NULL,
+				from_address     TEXT NOT NULL,
+				to_address       TEXT NOT NULL,
+				token_ids        {{json}} NOT NULL,
+				quantities       {{json}} NOT NULL,
+				block_number     BIGINT NOT NULL,
+				block_hash       TEXT NOT NULL,
+				PRIMARY KEY (address, transaction_hash, log_index)
+			)`,
+			`CREATE TABLE internal_transfers (
+				address          TEXT NOT NULL,
+				transaction_hash TEXT NOT NULL,
+				trace_path       TEXT NOT NULL,
+				call_type        TEXT NOT NULL,
+				from_address     TEXT NOT NULL,
+				to_address       TEXT NOT NULL,
+				value            {{uint256}} NOT NULL,
+				block_number     BIGINT NOT NULL,
+				block_hash       TEXT NOT NULL,
+				PRIMARY KEY (address, transaction_hash, trace_path)
+			)`,
+			`CREATE TABLE withdrawals (
+				address          TEXT NOT NULL,
+				withdrawal_index BIGINT NOT NULL,
+				validator_index  BIGINT NOT NULL,
+				amount           {{uint256}} NOT NULL,
+				block_number     BIGINT NOT NULL,
+				block_hash       TEXT NOT NULL,
+				block_timestamp  BIGINT NOT NULL,
+				PRIMARY KEY (address, withdrawal_index)
+			)`,
+			`CREATE TABLE contract_abis (
+				address TEXT PRIMARY KEY,
+				abi     TEXT NOT NULL
+			)`,
+			`CREATE TABLE block_headers (
+				number      BIGINT PRIMARY KEY,
+				hash        TEXT NOT NULL,
+				parent_hash TEXT NOT NULL,
+				timestamp   BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version:     2,
+		description: "index addresses, blocks and hashes",
+		statements: []string{
+			`CREATE INDEX transactions_address_block ON transactions (address, block_number)`,
+			`CREATE INDEX transactions_block ON transactions (block_number)`,
+			`CREATE INDEX transactions_hash ON transactions (hash)`,
+			`CREATE INDEX token_transfers_address_block ON token_transfers (address, block_number)`,
+			`CREATE INDEX token_transfers_block ON token_transfers (block_number)`,
+			`CREATE INDEX token_transfers_hash ON token_transfers (transaction_hash)`,
+			`CREATE INDEX nft_transfers_address_block ON nft_transfers (address, block_number)`,
+			`CREATE INDEX nft_transfers_block ON nft_transfers (block_number)`,
+			`CREATE INDEX nft_transfers_hash ON nft_transfers (transaction_hash)`,
+			`CREATE INDEX internal_transfers_address_block ON internal_transfers (address, block_number)`,
+			`CREATE INDEX internal_transfers_block ON internal_transfers (block_number)`,
+			`CREATE INDEX internal_transfers_hash ON internal_transfers (transaction_hash)`,
+			`CREATE INDEX withdrawals_address_block ON withdrawals (address, block_number)`,
+			`CREATE INDEX withdrawals_block ON withdrawals (block_number)`,
+		},
+	},
+	{
+		version:     3,
+		description: "record the block that subscribed an address",
+		statements: []string{
+			`ALTER TABLE subscriptions ADD COLUMN commit_block BIGINT`,
+		},
+	},
+}
+
+// migrate applies the migrations the database has not seen yet, each in its
+// own transaction together with recording its version.
+func (s *SQLStore) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version     INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at  BIGINT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("error reading schema version: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		err := s.inTx(ctx, func(tx *sql.Tx) error {
+			for _, statement := range m.statements {
+				if _, err := tx.ExecContext(ctx, s.dialect.columnTypes(statement)); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, s.rebind(
+				`INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)`),
+				m.version, m.description, time.Now().Unix())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("error applying migration %d (%s): %w", m.version, m.description, err)
+		}
+		s.logger.Info("Applied schema migration",
+			zap.Int("version", m.version),
+			zap.String("description", m.description),
+		)
+	}
+	return nil
+}
+
+// dialect covers the differences between the supported databases.
+type dialect struct {
+	// numberedPlaceholders uses $1, $2, ... instead of ?
+	numberedPlaceholders bool
+	uint256Type          string
+	jsonType             string
+}
+
+var (
+	postgresDialect = dialect{numberedPlaceholders: true, uint256Type: "NUMERIC(78, 0)", jsonType: "JSONB"}
+	// SQLite stores amounts as text, as its numeric types cannot hold
+	// 256-bit integers exactly
+	sqliteDialect = dialect{uint256Type: "TEXT", jsonType: "TEXT"}
+)
+
+func dialectFor(driver string) (dialect, error) {
+	switch driver {
+	case "postgres", "pgx":
+		return postgresDialect, nil
+	case "sqlite3", "sqlite":
+		return sqliteDialect, nil
+	default:
+		return dialect{}, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+func (d dialect) columnTypes(statement string) string {
+	return strings.NewReplacer("{{uint256}}", d.uint256Type, "{{json}}", d.jsonType).Replace(statement)
+}
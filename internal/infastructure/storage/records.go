@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"go.uber.org/zap"
+)
+
+// Record kinds, in the order of recordKinds.
+const (
+	kindTransactions = iota
+	kindTokenTransfers
+	kindNFTTransfers
+	kindInternalTransfers
+	kindWithdrawals
+)
+
+// recordKind gives the MemoryStore uniform access to one kind of
+// per-address history, ordered by block number. Every change goes through
+// it so retention's byte total and oldest-record heap stay current. The
+// caller of every method holds the mutex.
+type recordKind[T any] struct {
+	index   int
+	name    string
+	records func(s *MemoryStore) map[string][]T
+	key     func(record T) (int, string)
+	size    func(record T) int64
+	// timestamp returns the record's block time, or zero when the record
+	// does not carry one
+	timestamp func(record T) int64
+}
+
+// historyKind is the part of a recordKind retention uses without knowing
+// the record type.
+type historyKind interface {
+	kindName() string
+	addresses(s *MemoryStore) []string
+	length(s *MemoryStore, address string) int
+	block(s *MemoryStore, address string, i int) int
+	recordTimestamp(s *MemoryStore, address string, i int) int64
+	recordSize(s *MemoryStore, address string, i int) int64
+	evict(s *MemoryStore, address string, count int, reason string)
+}
+
+var (
+	transactionRecords = recordKind[entity.Transaction]{
+		index:     kindTransactions,
+		name:      "transactions",
+		records:   func(s *MemoryStore) map[string][]entity.Transaction { return s.transactions },
+		key:       transactionKey,
+		size:      transactionSize,
+		timestamp: func(tx entity.Transaction) int64 { return tx.BlockTimestamp },
+	}
+	tokenTransferRecords = recordKind[entity.TokenTransfer]{
+		index:   kindTokenTransfers,
+		name:    "token transfers",
+		records: func(s *MemoryStore) map[string][]entity.TokenTransfer { return s.tokenTransfers },
+		key:     tokenTransferKey,
+		size:    tokenTransferSize,
+	}
+	nftTransferRecords = recordKind[entity.NFTTransfer]{
+		index:   kindNFTTransfers,
+		name:    "NFT transfers",
+		records: func(s *MemoryStore) map[string][]entity.NFTTransfer { return s.nftTransfers },
+		key:     nftTransferKey,
+		size:    nftTransferSize,
+	}
+	internalTransferRecords = recordKind[entity.InternalTransfer]{
+		index:   kindInternalTransfers,
+		name:    "internal transfers",
+		records: func(s *MemoryStore) map[string][]entity.InternalTransfer { return s.internalTransfers },
+		key:     internalTransferKey,
+		size:    internalTransferSize,
+	}
+	withdrawalRecords = recordKind[entity.Withdrawal]{
+		index:     kindWithdrawals,
+		name:      "withdrawals",
+		records:   func(s *MemoryStore) map[string][]entity.Withdrawal { return s.withdrawals },
+		key:       withdrawalKey,
+		size:      withdrawalSize,
+		timestamp: func(withdrawal entity.Withdrawal) int64 { return withdrawal.BlockTimestamp },
+	}
+)
+
+// recordKinds lists every kind by index.
+var recordKinds = []historyKind{
+	transactionRecords,
+	tokenTransferRecords,
+	nftTransferRecords,
+	internalTransferRecords,
+	withdrawalRecords,
+}
+
+// put stores the record in the address's history, replacing one with the
+// same key, and applies MaxPerAddress.
+func (k recordKind[T]) put(s *MemoryStore, address string, record T) {
+	records := k.records(s)
+	history, replaced, ok := upsert(records[address], record, k.key)
+	records[address] = history
+	if s.retention.MaxBytes > 0 {
+		if ok {
+			s.bytes -= k.size(replaced)
+		}
+		s.bytes += k.size(record)
+	}
+	k.observe(s, record)
+	k.changed(s, address)
+}
+
+// set replaces the address's history and applies MaxPerAddress.
+func (k recordKind[T]) set(s *MemoryStore, address string, history []T) {
+	records := k.records(s)
+	if s.retention.MaxBytes > 0 {
+		s.bytes += k.sizeOf(history) - k.sizeOf(records[address])
+	}
+	records[address] = history
+	for _, record := range history {
+		k.observe(s, record)
+	}
+	k.changed(s, address)
+}
+
+// remove drops the address's history.
+func (k recordKind[T]) remove(s *MemoryStore, address string) {
+	records := k.records(s)
+	if s.retention.MaxBytes > 0 {
+		s.bytes -= k.sizeOf(records[address])
+	}
+	delete(records, address)
+	s.touch(k.index, address)
+}
+
+// keep drops the records above the given block from every history.
+func (k recordKind[T]) keep(s *MemoryStore, block int) {
+	for address, history := range k.records(s) {
+		kept := make([]T, 0, len(history))
+		for _, record := range history {
+			if number, _ := k.key(record); number <= block {
+				kept = append(kept, record)
+			}
+		}
+		if len(kept) != len(history) {
+			k.set(s, address, kept)
+		}
+	}
+}
+
+// changed updates the heap after the address's history changed and applies
+// MaxPerAddress.
+func (k recordKind[T]) changed(s *MemoryStore, address string) {
+	s.touch(k.index, address)
+	if limit := s.retention.MaxPerAddress; limit > 0 && len(k.records(s)[address]) > limit {
+		k.evict(s, address, len(k.records(s)[address])-limit, evictedMaxPerAddress)
+	}
+}
+
+// observe samples the record's block time for MaxAge.
+func (k recordKind[T]) observe(s *MemoryStore, record T) {
+	if k.timestamp == nil || s.retention.MaxAge <= 0 {
+		return
+	}
+	block, _ := k.key(record)
+	s.blockTimes.observe(block, k.timestamp(record), s.retention.MaxAge)
+}
+
+func (k recordKind[T]) sizeOf(history []T) int64 {
+	var size int64
+	for _, record := range history {
+		size += k.size(record)
+	}
+	return size
+}
+
+func (k recordKind[T]) kindName() string {
+	return k.name
+}
+
+func (k recordKind[T]) addresses(s *MemoryStore) []string {
+	records := k.records(s)
+	addresses := make([]string, 0, len(records))
+	for address := range records {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+func (k recordKind[T]) length(s *MemoryStore, address string) int {
+	return len(k.records(s)[address])
+}
+
+func (k recordKind[T]) block(s *MemoryStore, address string, i int) int {
+	block, _ := k.key(k.records(s)[address][i])
+	return block
+}
+
+func (k recordKind[T]) recordTimestamp(s *MemoryStore, address string, i int) int64 {
+	if k.timestamp == nil {
+		return 0
+	}
+	return k.timestamp(k.records(s)[address][i])
+}
+
+func (k recordKind[T]) recordSize(s *MemoryStore, address string, i int) int64 {
+	return k.size(k.records(s)[address][i])
+}
+
+// evict drops the address's count oldest records and marks its history as
+// truncated.
+func (k recordKind[T]) evict(s *MemoryStore, address string, count int, reason string) {
+	if count <= 0 {
+		return
+	}
+	records := k.records(s)
+	history := records[address]
+	if s.retention.MaxBytes > 0 {
+		s.bytes -= k.sizeOf(history[:count])
+	}
+	// Copy, as earlier reads may still hold the old slice
+	records[address] = append([]T(nil), history[count:]...)
+	s.touch(k.index, address)
+	s.truncated[address] = true
+	evictedRecords.Add(reason, int64(count))
+	s.logger.Debug("Evicted records",
+		zap.String("address", address),
+		zap.String("kind", k.name),
+		zap.Int("count", count),
+		zap.String("reason", reason),
+	)
+}
@@ -0,0 +1,337 @@
+package storage
+
+import (
+	"container/heap"
+	"expvar"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"math/big"
+	"math/bits"
+	"time"
+	"unsafe"
+)
+
+// Eviction reasons, used as keys of the evictedRecords metric.
+const (
+	evictedMaxPerAddress = "max_per_address"
+	evictedMaxAge        = "max_age"
+	evictedMaxBytes      = "max_bytes"
+)
+
+// evictedRecords counts transactions, transfers and withdrawals dropped by
+// retention, by reason. Published under /debug/vars.
+var evictedRecords = expvar.NewMap("storage_evicted_records")
+
+// maxBlockTimeSamples bounds how many block times are sampled for MaxAge.
+const maxBlockTimeSamples = 1024
+
+// RetentionPolicy bounds the history a MemoryStore keeps: transactions,
+// token, NFT and internal transfers and withdrawals. When a limit is exceeded
+// the oldest records are evicted and the history of their address is marked
+// as truncated. Zero fields are unlimited.
+type RetentionPolicy struct {
+	// MaxPerAddress is the most records of each kind kept for one address.
+	MaxPerAddress int
+	// MaxAgeBlocks evicts records more than this many blocks below the
+	// current block.
+	MaxAgeBlocks int
+	// MaxAge evicts records whose block is older than this. Records without
+	// a timestamp of their own are dated by the block times the store has
+	// seen in headers, transactions and withdrawals.
+	MaxAge time.Duration
+	// MaxBytes is a rough budget for all records together. Records are
+	// measured with their fields and contents, but map and spare slice
+	// capacity is not counted, while a record stored for two addresses
+	// counts twice although the copies share their strings. It is a
+	// heuristic, and the process usually uses noticeably more.
+	MaxBytes int64
+}
+
+func (p RetentionPolicy) limitsAge() bool {
+	return p.MaxAgeBlocks > 0 || p.MaxAge > 0
+}
+
+// evictsOldest reports whether the policy evicts across addresses, oldest
+// records first, which needs the oldest-record heap.
+func (p RetentionPolicy) evictsOldest() bool {
+	return p.limitsAge() || p.MaxBytes > 0
+}
+
+// MemoryOption configures a MemoryStore.
+type MemoryOption func(*MemoryStore)
+
+// WithRetention bounds the history the store keeps.
+func WithRetention(policy RetentionPolicy) MemoryOption {
+	return func(s *MemoryStore) {
+		s.retention = policy
+	}
+}
+
+// retain evicts expired records and then the oldest records until the
+// estimated size is within MaxBytes. Histories are taken from the heap in
+// order of their oldest record, so only histories that lose records are
+// visited. The caller holds the mutex.
+func (s *MemoryStore) retain() {
+	if !s.retention.evictsOldest() {
+		return
+	}
+
+	if s.retention.limitsAge() {
+		now := time.Now()
+		expiredBlock := s.blockTimes.expire(now, s.retention.MaxAge)
+		for len(s.oldest) > 0 {
+			entry := s.oldest[0]
+			kind := recordKinds[entry.kind]
+			expired := 0
+			for expired < kind.length(s, entry.address) &&
+				s.expired(kind.block(s, entry.address, expired), kind.recordTimestamp(s, entry.address, expired), expiredBlock, now) {
+				expired++
+			}
+			if expired == 0 {
+				// Later blocks are younger, so nothing else has expired
+				break
+			}
+			kind.evict(s, entry.address, expired, evictedMaxAge)
+		}
+	}
+
+	limit := s.retention.MaxBytes
+	for limit > 0 && s.bytes > limit && len(s.oldest) > 0 {
+		// Evict from the history holding the oldest record, up to the
+		// oldest block of any other history so a run is evicted at once
+		entry := s.oldest[0]
+		next := -1
+		for _, child := range []int{1, 2} {
+			if child < len(s.oldest) && (next < 0 || s.oldest[child].block < next) {
+				next = s.oldest[child].block
+			}
+		}
+
+		kind := recordKinds[entry.kind]
+		count, freed := 0, int64(0)
+		for count < kind.length(s, entry.address) && s.bytes-freed > limit &&
+			(count == 0 || next < 0 || kind.block(s, entry.address, count) <= next) {
+			freed += kind.recordSize(s, entry.address, count)
+			count++
+		}
+		kind.evict(s, entry.address, count, evictedMaxBytes)
+	}
+}
+
+// expired reports whether a record from the block has aged out. A record
+// without a timestamp is dated by expiredBlock, the newest block known to be
+// older than MaxAge.
+func (s *MemoryStore) expired(block int, timestamp int64, expiredBlock int, now time.Time) bool {
+	if limit := s.retention.MaxAgeBlocks; limit > 0 && block < s.currentBlock-limit {
+		return true
+	}
+	if limit := s.retention.MaxAge; limit > 0 {
+		if timestamp > 0 {
+			return now.Sub(time.Unix(timestamp, 0)) > limit
+		}
+		return block <= expiredBlock
+	}
+	return false
+}
+
+// historyKey identifies one kind of history of an address.
+type historyKey struct {
+	kind    int
+	address string
+}
+
+// oldestEntry is a non-empty history in the oldest-record heap.
+type oldestEntry struct {
+	historyKey
+	// block is the block of the history's oldest record
+	block int
+	index int
+}
+
+// oldestHeap orders histories by the block of their oldest record.
+type oldestHeap []*oldestEntry
+
+func (h oldestHeap) Len() int           { return len(h) }
+func (h oldestHeap) Less(i, j int) bool { return h[i].block < h[j].block }
+
+func (h oldestHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *oldestHeap) Push(x interface{}) {
+	entry := x.(*oldestEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *oldestHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// touch updates the history's place in the oldest-record heap after it
+// changed. The caller holds the mutex.
+func (s *MemoryStore) touch(kind int, address string) {
+	if !s.retention.evictsOldest() {
+		return
+	}
+	if s.oldestEntries == nil {
+		s.oldestEntries = make(map[historyKey]*oldestEntry)
+	}
+
+	key := historyKey{kind: kind, address: address}
+	entry, ok := s.oldestEntries[key]
+	if recordKinds[kind].length(s, address) == 0 {
+		if ok {
+			heap.Remove(&s.oldest, entry.index)
+			delete(s.oldestEntries, key)
+		}
+		return
+	}
+
+	block := recordKinds[kind].block(s, address, 0)
+	if !ok {
+		entry = &oldestEntry{historyKey: key, block: block}
+		s.oldestEntries[key] = entry
+		heap.Push(&s.oldest, entry)
+		return
+	}
+	if entry.block != block {
+		entry.block = block
+		heap.Fix(&s.oldest, entry.index)
+	}
+}
+
+// reindex rebuilds the byte total and the oldest-record heap after the
+// histories were replaced wholesale. The caller holds the mutex.
+func (s *MemoryStore) reindex() {
+	s.bytes = 0
+	s.oldest = nil
+	s.oldestEntries = nil
+	for index, kind := range recordKinds {
+		for _, address := range kind.addresses(s) {
+			if s.retention.MaxBytes > 0 {
+				for i := 0; i < kind.length(s, address); i++ {
+					s.bytes += kind.recordSize(s, address, i)
+				}
+			}
+			s.touch(index, address)
+		}
+	}
+}
+
+// blockTimes samples block timestamps so MaxAge can date records that carry
+// no timestamp. Block times grow with block numbers, so a record is older
+// than MaxAge once any block at or above its own is.
+type blockTimes struct {
+	// Expired is the newest block known to be older than MaxAge
+	Expired int         `json:"expired"`
+	Samples []blockTime `json:"samples,omitempty"`
+}
+
+type blockTime struct {
+	Block     int   `json:"block"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+// observe records the block's time when it is newer than the last sample by
+// a fraction of maxAge, which bounds the samples to maxBlockTimeSamples.
+func (t *blockTimes) observe(block int, timestamp int64, maxAge time.Duration) {
+	if timestamp <= 0 {
+		return
+	}
+	if n := len(t.Samples); n > 0 {
+		last := t.Samples[n-1]
+		spacing := int64(maxAge / time.Second / maxBlockTimeSamples)
+		if block <= last.Block || timestamp < last.Timestamp+spacing {
+			return
+		}
+	}
+	t.Samples = append(t.Samples, blockTime{Block: block, Timestamp: timestamp})
+}
+
+// expire moves samples older than maxAge into Expired and returns it.
+func (t *blockTimes) expire(now time.Time, maxAge time.Duration) int {
+	if maxAge <= 0 {
+		return t.Expired
+	}
+	expired := 0
+	for expired < len(t.Samples) && now.Sub(time.Unix(t.Samples[expired].Timestamp, 0)) > maxAge {
+		t.Expired = t.Samples[expired].Block
+		expired++
+	}
+	if expired > 0 {
+		t.Samples = append([]blockTime(nil), t.Samples[expired:]...)
+	}
+	return t.Expired
+}
+
+// forget drops samples above the block, which was rolled back to.
+func (t *blockTimes) forget(block int) {
+	kept := len(t.Samples)
+	for kept > 0 && t.Samples[kept-1].Block > block {
+		kept--
+	}
+	t.Samples = t.Samples[:kept]
+}
+
+// The size functions estimate the bytes a stored record takes: its struct,
+// which holds the string and slice headers, and what they point to. Strings
+// and values shared by a record stored for two addresses are counted for
+// each.
+
+func transactionSize(tx entity.Transaction) int64 {
+	size := int64(unsafe.Sizeof(tx)) + int64(len(tx.Hash)+len(tx.From)+len(tx.To)+len(tx.GasPrice)+
+		len(tx.MaxFeePerGas)+len(tx.MaxPriorityFeePerGas)+len(tx.Input)+len(tx.BlockHash)+len(tx.CreatedContract))
+	size += bigIntSize(tx.Value)
+	if receipt := tx.Receipt; receipt != nil {
+		size += int64(unsafe.Sizeof(*receipt)) + int64(len(receipt.EffectiveGasPrice)+len(receipt.ContractAddress))
+		size += int64(cap(receipt.Logs)) * int64(unsafe.Sizeof(entity.Log{}))
+		for _, log := range receipt.Logs {
+			size += int64(len(log.Address)+len(log.Data)) + stringsSize(log.Topics)
+		}
+	}
+	return size
+}
+
+func tokenTransferSize(transfer entity.TokenTransfer) int64 {
+	return int64(unsafe.Sizeof(transfer)) + int64(len(transfer.Token)+len(transfer.From)+len(transfer.To)+
+		len(transfer.Amount)+len(transfer.TransactionHash)+len(transfer.BlockHash))
+}
+
+func nftTransferSize(transfer entity.NFTTransfer) int64 {
+	return int64(unsafe.Sizeof(transfer)) + int64(len(transfer.Contract)+len(transfer.Standard)+
+		len(transfer.Operator)+len(transfer.From)+len(transfer.To)+len(transfer.TransactionHash)+
+		len(transfer.BlockHash)) + stringsSize(transfer.TokenIDs) + stringsSize(transfer.Quantities)
+}
+
+func internalTransferSize(transfer entity.InternalTransfer) int64 {
+	return int64(unsafe.Sizeof(transfer)) + int64(len(transfer.TransactionHash)+len(transfer.CallType)+
+		len(transfer.From)+len(transfer.To)+len(transfer.BlockHash)) +
+		int64(cap(transfer.TracePath))*int64(unsafe.Sizeof(int(0))) + bigIntSize(transfer.Value)
+}
+
+func withdrawalSize(withdrawal entity.Withdrawal) int64 {
+	return int64(unsafe.Sizeof(withdrawal)) + int64(len(withdrawal.Address)+len(withdrawal.BlockHash)) +
+		bigIntSize(withdrawal.Amount)
+}
+
+func bigIntSize(value *big.Int) int64 {
+	if value == nil {
+		return 0
+	}
+	return int64(unsafe.Sizeof(*value)) + int64(cap(value.Bits())*bits.UintSize/8)
+}
+
+// stringsSize is the backing array of a string slice and the strings' contents.
+func stringsSize(values []string) int64 {
+	size := int64(cap(values)) * int64(unsafe.Sizeof(""))
+	for _, value := range values {
+		size += int64(len(value))
+	}
+	return size
+}
@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const otherAddress = "0x1111111111111111111111111111111111111111"
+
+func evictions(reason string) int64 {
+	if count, ok := evictedRecords.Get(reason).(*expvar.Int); ok {
+		return count.Value()
+	}
+	return 0
+}
+
+// blocksOf returns the block numbers of the address's stored transactions.
+func blocksOf(t *testing.T, store *MemoryStore, address string) []int {
+	t.Helper()
+	txs, err := store.GetTransactions(context.Background(), address)
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+	blocks := []int{}
+	for _, tx := range txs {
+		blocks = append(blocks, tx.BlockNumber)
+	}
+	return blocks
+}
+
+func TestMemoryStore_RetentionMaxPerAddress(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(WithRetention(RetentionPolicy{MaxPerAddress: 3}))
+	store.Subscribe(ctx, testAddress)
+	store.Subscribe(ctx, otherAddress)
+	before := evictions(evictedMaxPerAddress)
+
+	for block := 1; block <= 5; block++ {
+		store.AddTransaction(ctx, entity.Transaction{Hash: fmt.Sprintf("0x%x", block), From: testAddress, BlockNumber: block})
+	}
+	store.AddTransaction(ctx, entity.Transaction{Hash: "0xo", From: otherAddress, BlockNumber: 5})
+
+	if got := blocksOf(t, store, testAddress); !reflect.DeepEqual(got, []int{3, 4, 5}) {
+		t.Errorf("Kept blocks = %v, want [3 4 5]", got)
+	}
+	if truncated, _ := store.IsHistoryTruncated(ctx, testAddress); !truncated {
+		t.Error("IsHistoryTruncated() = false, want true")
+	}
+	if truncated, _ := store.IsHistoryTruncated(ctx, otherAddress); truncated {
+		t.Error("IsHistoryTruncated() for untouched address = true, want false")
+	}
+	if got := evictions(evictedMaxPerAddress) - before; got != 2 {
+		t.Errorf("Evictions metric grew by %d, want 2", got)
+	}
+}
+
+func TestMemoryStore_RetentionMaxAge(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+	store := NewMemoryStore(WithRetention(RetentionPolicy{MaxAgeBlocks: 10, MaxAge: time.Hour}))
+	store.Subscribe(ctx, testAddress)
+
+	store.AddTransaction(ctx, entity.Transaction{Hash: "0xa", From: testAddress, BlockNumber: 1, BlockTimestamp: now - 7200})
+	store.AddTransaction(ctx, entity.Transaction{Hash: "0xb", From: testAddress, BlockNumber: 5, BlockTimestamp: now})
+	store.AddTransaction(ctx, entity.Transaction{Hash: "0xc", From: testAddress, BlockNumber: 12, BlockTimestamp: now})
+	if got := blocksOf(t, store, testAddress); !reflect.DeepEqual(got, []int{5, 12}) {
+		t.Errorf("Kept blocks = %v, want [5 12] after the hour-old one expired", got)
+	}
+
+	// Advancing the current block ages out the rest without new transactions
+	store.SetCurrentBlock(ctx, 16)
+	if got := blocksOf(t, store, testAddress); !reflect.DeepEqual(got, []int{12}) {
+		t.Errorf("Kept blocks = %v, want [12]", got)
+	}
+	store.CommitBlock(ctx, entity.BlockCommit{Header: entity.BlockHeader{Number: 30, Hash: "0x30"}})
+	if got := blocksOf(t, store, testAddress); len(got) != 0 {
+		t.Errorf("Kept blocks = %v, want none", got)
+	}
+}
+
+func TestMemoryStore_RetentionMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	size := transactionSize(entity.Transaction{Hash: "0xa", From: testAddress, BlockNumber: 3})
+	store := NewMemoryStore(WithRetention(RetentionPolicy{MaxBytes: 4 * size}))
+	store.Subscribe(ctx, testAddress)
+	store.Subscribe(ctx, otherAddress)
+	before := evictions(evictedMaxBytes)
+
+	store.CommitBlock(ctx, entity.BlockCommit{
+		Header: entity.BlockHeader{Number: 3, Hash: "0x3"},
+		Transactions: []entity.Transaction{
+			{Hash: "0xa", From: testAddress, BlockNumber: 3},
+			{Hash: "0xb", From: otherAddress, BlockNumber: 3},
+		},
+	})
+	store.MergeTransactions(ctx, testAddress, []entity.Transaction{
+		{Hash: "0xc", From: testAddress, BlockNumber: 1},
+		{Hash: "0xd", From: testAddress, BlockNumber: 2},
+	})
+	store.MergeTransactions(ctx, otherAddress, []entity.Transaction{
+		{Hash: "0xe", From: otherAddress, BlockNumber: 2},
+	})
+
+	// The oldest transaction goes first, whichever address holds it
+	if got := blocksOf(t, store, testAddress); !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Errorf("Kept blocks for first address = %v, want [2 3]", got)
+	}
+	if got := blocksOf(t, store, otherAddress); !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Errorf("Kept blocks for second address = %v, want [2 3]", got)
+	}
+	if truncated, _ := store.IsHistoryTruncated(ctx, otherAddress); truncated {
+		t.Error("IsHistoryTruncated() for second address = true, want false")
+	}
+
+	// A transaction the size of two makes room by evicting two
+	large := entity.Transaction{Hash: "0xf", From: otherAddress, BlockNumber: 4}
+	large.Input = strings.Repeat("0", int(2*size-transactionSize(large)))
+	store.AddTransaction(ctx, large)
+	if got := blocksOf(t, store, testAddress); !reflect.DeepEqual(got, []int{3}) {
+		t.Errorf("Kept blocks for first address = %v, want [3]", got)
+	}
+	if got := blocksOf(t, store, otherAddress); !reflect.DeepEqual(got, []int{3, 4}) {
+		t.Errorf("Kept blocks for second address = %v, want [3 4]", got)
+	}
+	if got := evictions(evictedMaxBytes) - before; got != 3 {
+		t.Errorf("Evictions metric grew by %d, want 3", got)
+	}
+}
+
+func TestFileStore_RestoresTruncation(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	retention := WithRetention(RetentionPolicy{MaxPerAddress: 1})
+	store, err := NewFileStore(dir, 0, retention)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	store.Subscribe(ctx, testAddress)
+	store.AddTransaction(ctx, entity.Transaction{Hash: "0xa", From: testAddress, BlockNumber: 1})
+	store.AddTransaction(ctx, entity.Transaction{Hash: "0xb", From: testAddress, BlockNumber: 2})
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reopened, err := NewFileStore(dir, 0, retention)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	if got := blocksOf(t, reopened.MemoryStore, testAddress); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("Kept blocks = %v, want [2]", got)
+	}
+	if truncated, _ := reopened.IsHistoryTruncated(ctx, testAddress); !truncated {
+		t.Error("IsHistoryTruncated() after reopening = false, want true")
+	}
+}
+
+// keyBlocks returns the block numbers of records, by their key function.
+func keyBlocks[T any](records []T, key func(T) (int, string)) []int {
+	blocks := []int{}
+	for _, record := range records {
+		block, _ := key(record)
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func TestMemoryStore_RetentionMaxPerAddressTransfers(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(WithRetention(RetentionPolicy{MaxPerAddress: 2}))
+	store.Subscribe(ctx, testAddress)
+	before := evictions(evictedMaxPerAddress)
+
+	for block := 1; block <= 3; block++ {
+		hash := fmt.Sprintf("0x%x", block)
+		store.AddTokenTransfer(ctx, entity.TokenTransfer{TransactionHash: hash, From: testAddress, BlockNumber: block})
+		store.AddNFTTransfer(ctx, entity.NFTTransfer{TransactionHash: hash, To: testAddress, BlockNumber: block})
+		store.AddInternalTransfer(ctx, entity.InternalTransfer{TransactionHash: hash, From: testAddress, BlockNumber: block})
+		store.AddWithdrawal(ctx, entity.Withdrawal{Index: uint64(block), Address: testAddress, BlockNumber: block})
+	}
+
+	want := []int{2, 3}
+	tokenTransfers, _ := store.GetTokenTransfers(ctx, testAddress)
+	if got := keyBlocks(tokenTransfers, tokenTransferKey); !reflect.DeepEqual(got, want) {
+		t.Errorf("Kept token transfer blocks = %v, want %v", got, want)
+	}
+	nftTransfers, _ := store.GetNFTTransfers(ctx, testAddress)
+	if got := keyBlocks(nftTransfers, nftTransferKey); !reflect.DeepEqual(got, want) {
+		t.Errorf("Kept NFT transfer blocks = %v, want %v", got, want)
+	}
+	internalTransfers, _ := store.GetInternalTransfers(ctx, testAddress)
+	if got := keyBlocks(internalTransfers, internalTransferKey); !reflect.DeepEqual(got, want) {
+		t.Errorf("Kept internal transfer blocks = %v, want %v", got, want)
+	}
+	withdrawals, _ := store.GetWithdrawals(ctx, testAddress)
+	if got := keyBlocks(withdrawals, withdrawalKey); !reflect.DeepEqual(got, want) {
+		t.Errorf("Kept withdrawal blocks = %v, want %v", got, want)
+	}
+	if truncated, _ := store.IsHistoryTruncated(ctx, testAddress); !truncated {
+		t.Error("IsHistoryTruncated() = false, want true")
+	}
+	if got := evictions(evictedMaxPerAddress) - before; got != 4 {
+		t.Errorf("Evictions metric grew by %d, want 4", got)
+	}
+}
+
+func TestMemoryStore_RetentionMaxBytesAcrossKinds(t *testing.T) {
+	ctx := context.Background()
+	withdrawal := entity.Withdrawal{Index: 1, Address: otherAddress, BlockNumber: 1}
+	tokenTransfer := entity.TokenTransfer{TransactionHash: "0xb", From: testAddress, BlockNumber: 2}
+	internalTransfer := entity.InternalTransfer{TransactionHash: "0xc", From: testAddress, BlockNumber: 3}
+	store := NewMemoryStore(WithRetention(RetentionPolicy{
+		MaxBytes: tokenTransferSize(tokenTransfer) + internalTransferSize(internalTransfer),
+	}))
+	store.Subscribe(ctx, testAddress)
+	store.Subscribe(ctx, otherAddress)
+
+	store.AddWithdrawal(ctx, withdrawal)
+	store.AddTokenTransfer(ctx, tokenTransfer)
+	if withdrawals, _ := store.GetWithdrawals(ctx, otherAddress); len(withdrawals) != 1 {
+		t.Fatalf("Kept %d withdrawals within the budget, want 1", len(withdrawals))
+	}
+
+	// The oldest record goes first, whatever its kind
+	store.AddInternalTransfer(ctx, internalTransfer)
+	if withdrawals, _ := store.GetWithdrawals(ctx, otherAddress); len(withdrawals) != 0 {
+		t.Errorf("Kept %d withdrawals over the budget, want 0", len(withdrawals))
+	}
+	if truncated, _ := store.IsHistoryTruncated(ctx, otherAddress); !truncated {
+		t.Error("IsHistoryTruncated() for the withdrawal's address = false, want true")
+	}
+	tokenTransfers, _ := store.GetTokenTransfers(ctx, testAddress)
+	internalTransfers, _ := store.GetInternalTransfers(ctx, testAddress)
+	if len(tokenTransfers) != 1 || len(internalTransfers) != 1 {
+		t.Errorf("Kept %d token and %d internal transfers, want 1 each", len(tokenTransfers), len(internalTransfers))
+	}
+	if truncated, _ := store.IsHistoryTruncated(ctx, testAddress); truncated {
+		t.Error("IsHistoryTruncated() for the transfers' address = true, want false")
+	}
+}
+
+func TestMemoryStore_RetentionMaxAgeTransfers(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+	store := NewMemoryStore(WithRetention(RetentionPolicy{MaxAge: time.Hour}))
+	store.Subscribe(ctx, testAddress)
+
+	// Transfers carry no timestamp, so they are dated by their block header
+	store.CommitBlock(ctx, entity.BlockCommit{
+		Header:         entity.BlockHeader{Number: 1, Hash: "0x1", Timestamp: now - 7200},
+		TokenTransfers: []entity.TokenTransfer{{TransactionHash: "0xa", From: testAddress, BlockNumber: 1}},
+		Withdrawals:    []entity.Withdrawal{{Index: 1, Address: testAddress, BlockNumber: 1, BlockTimestamp: now - 7200}},
+	})
+	store.CommitBlock(ctx, entity.BlockCommit{
+		Header:         entity.BlockHeader{Number: 2, Hash: "0x2", Timestamp: now},
+		TokenTransfers: []entity.TokenTransfer{{TransactionHash: "0xb", From: testAddress, BlockNumber: 2}},
+		Withdrawals:    []entity.Withdrawal{{Index: 2, Address: testAddress, BlockNumber: 2, BlockTimestamp: now}},
+	})
+
+	tokenTransfers, _ := store.GetTokenTransfers(ctx, testAddress)
+	if got := keyBlocks(tokenTransfers, tokenTransferKey); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("Kept token transfer blocks = %v, want [2]", got)
+	}
+	withdrawals, _ := store.GetWithdrawals(ctx, testAddress)
+	if got := keyBlocks(withdrawals, withdrawalKey); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("Kept withdrawal blocks = %v, want [2]", got)
+	}
+	if truncated, _ := store.IsHistoryTruncated(ctx, testAddress); !truncated {
+		t.Error("IsHistoryTruncated() = false, want true")
+	}
+}
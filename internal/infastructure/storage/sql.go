@@ -0,0 +1,887 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/pkg/logger"
+	"go.uber.org/zap"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLStore keeps the parser's state in a relational database through
+// database/sql. PostgreSQL and SQLite are supported; the caller registers the
+// driver. The schema is migrated to the latest version when the store is
+// opened. Every history row is keyed by the subscribed address it belongs to
+// and the record's identity, so storing a record again updates the row
+// instead of adding a duplicate.
+type SQLStore struct {
+	db      *sql.DB
+	dialect dialect
+	logger  *zap.Logger
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// NewSQLStore connects to the database with the named driver and data source
+// and migrates its schema.
+func NewSQLStore(ctx context.Context, driver, dsn string) (*SQLStore, error) {
+	d, err := dialectFor(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	if driver == "sqlite3" || driver == "sqlite" {
+		// SQLite allows one writer at a time
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error connecting to database: %w", err)
+	}
+
+	s := &SQLStore{db: db, dialect: d, logger: logger.GetLogger()}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// rebind rewrites ? placeholders for dialects that number them.
+func (s *SQLStore) rebind(query string) string {
+	if !s.dialect.numberedPlaceholders {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// inTx runs fn in a transaction, committing when it succeeds.
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetCurrentBlock(ctx context.Context) (int, error) {
+	var block int
+	err := s.db.QueryRowContext(ctx, `SELECT current_block FROM parser_state WHERE id = 1`).Scan(&block)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return block, err
+}
+
+func (s *SQLStore) SetCurrentBlock(ctx context.Context, block int) error {
+	return s.setCurrentBlock(ctx, s.db, block)
+}
+
+func (s *SQLStore) setCurrentBlock(ctx context.Context, q queryer, block int) error {
+	_, err := q.ExecContext(ctx, s.rebind(`INSERT INTO parser_state (id, current_block) VALUES (1, ?)
+		ON CONFLICT (id) DO UPDATE SET current_block = excluded.current_block`), block)
+	return err
+}
+
+func (s *SQLStore) Subscribe(ctx context.Context, address string) (bool, error) {
+	if address == "" {
+		return false, nil
+	}
+	// A direct subscription outlives the rollback of the block that made it
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO subscriptions (address, created_at) VALUES (?, ?)
+		ON CONFLICT (address) DO UPDATE SET commit_block = NULL`), strings.ToLower(address), time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SQLStore) IsSubscribed(ctx context.Context, address string) (bool, error) {
+	if address == "" {
+		return false, nil
+	}
+	return isSubscribed(ctx, s.db, s.rebind, address)
+}
+
+func (s *SQLStore) GetSubscriptions(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT address FROM subscriptions ORDER BY address`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := []string{}
+	for rows.Next() {
+		var address string
+		if err := rows.Scan(&address); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, rows.Err()
+}
+
+func isSubscribed(ctx context.Context, q queryer, rebind func(string) string, address string) (bool, error) {
+	var found int
+	err := q.QueryRowContext(ctx, rebind(`SELECT 1 FROM subscriptions WHERE address = ?`),
+		strings.ToLower(address)).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// subscribedOf returns which of the addresses are subscribed, lowercased and
+// without repeats.
+func (s *SQLStore) subscribedOf(ctx context.Context, q queryer, addresses ...string) ([]string, error) {
+	var subscribed []string
+	seen := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		address = strings.ToLower(address)
+		if address == "" || seen[address] {
+			continue
+		}
+		seen[address] = true
+		ok, err := isSubscribed(ctx, q, s.rebind, address)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			subscribed = append(subscribed, address)
+		}
+	}
+	return subscribed, nil
+}
+
+const transactionColumns = `hash, from_address, to_address, value, block_number, block_hash, block_timestamp,
+	transaction_index, nonce, gas, gas_price, max_fee_per_gas, max_priority_fee_per_gas, input, type,
+	chain_id, created_contract, receipt`
+
+func (s *SQLStore) AddTransaction(ctx context.Context, tx entity.Transaction) error {
+	return s.inTx(ctx, func(sqlTx *sql.Tx) error {
+		return s.addTransaction(ctx, sqlTx, tx)
+	})
+}
+
+// addTransaction stores the transaction under whichever of its addresses are
+// subscribed.
+func (s *SQLStore) addTransaction(ctx context.Context, q queryer, tx entity.Transaction) error {
+	to := tx.To
+	if tx.IsContractCreation() {
+		// A deployed contract's history starts with its creation
+		to = tx.CreatedContract
+	}
+	addresses, err := s.subscribedOf(ctx, q, tx.From, to)
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if _, err := s.insertTransaction(ctx, q, address, tx, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) MergeTransactions(ctx context.Context, address string, txs []entity.Transaction) (int, error) {
+	if address == "" {
+		return 0, nil
+	}
+	added := 0
+	err := s.inTx(ctx, func(sqlTx *sql.Tx) error {
+		for _, tx := range txs {
+			inserted, err := s.insertTransaction(ctx, sqlTx, strings.ToLower(address), tx, false)
+			if err != nil {
+				return err
+			}
+			if inserted {
+				added++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// insertTransaction stores the transaction for the address and reports
+// whether it was added. A stored transaction with the same hash is replaced
+// when replace is set and kept otherwise.
+func (s *SQLStore) insertTransaction(ctx context.Context, q queryer, address string, tx entity.Transaction, replace bool) (bool, error) {
+	var receipt sql.NullString
+	if tx.Receipt != nil {
+		data, err := json.Marshal(tx.Receipt)
+		if err != nil {
+			return false, fmt.Errorf("error encoding receipt: %w", err)
+		}
+		receipt = sql.NullString{String: string(data), Valid: true}
+	}
+
+	result, err := q.ExecContext(ctx, s.rebind(`INSERT INTO transactions (address, `+transactionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`+conflictClause("address, hash", transactionColumns, replace)),
+		address, tx.Hash, tx.From, tx.To, tx.ValueOrZero().String(), tx.BlockNumber, tx.BlockHash,
+		tx.BlockTimestamp, tx.TransactionIndex, int64(tx.Nonce), int64(tx.Gas), tx.GasPrice,
+		tx.MaxFeePerGas, tx.MaxPriorityFeePerGas, tx.Input, tx.Type, int64(tx.ChainID),
+		tx.CreatedContract, receipt)
+	return inserted(result, err)
+}
+
+// IsHistoryTruncated is always false, as the SQL store applies no retention.
+func (s *SQLStore) IsHistoryTruncated(ctx context.Context, address string) (bool, error) {
+	return false, nil
+}
+
+func (s *SQLStore) GetTransactions(ctx context.Context, address string) ([]entity.Transaction, error) {
+	transactions := []entity.Transaction{}
+	if address == "" {
+		return transactions, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+transactionColumns+` FROM transactions
+		WHERE address = ? ORDER BY block_number, transaction_index, hash`), strings.ToLower(address))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tx entity.Transaction
+		var value string
+		var nonce, gas, chainID int64
+		var receipt sql.NullString
+		if err := rows.Scan(&tx.Hash, &tx.From, &tx.To, &value, &tx.BlockNumber, &tx.BlockHash,
+			&tx.BlockTimestamp, &tx.TransactionIndex, &nonce, &gas, &tx.GasPrice, &tx.MaxFeePerGas,
+			&tx.MaxPriorityFeePerGas, &tx.Input, &tx.Type, &chainID, &tx.CreatedContract, &receipt); err != nil {
+			return nil, err
+		}
+		tx.Nonce, tx.Gas, tx.ChainID = uint64(nonce), uint64(gas), uint64(chainID)
+		if tx.Value, err = parseAmount(value); err != nil {
+			return nil, err
+		}
+		if receipt.Valid {
+			tx.Receipt = &entity.Receipt{}
+			if err := json.Unmarshal([]byte(receipt.String), tx.Receipt); err != nil {
+				return nil, fmt.Errorf("error decoding receipt of %s: %w", tx.Hash, err)
+			}
+		}
+		transactions = append(transactions, tx)
+	}
+	return transactions, rows.Err()
+}
+
+func (s *SQLStore) AddTokenTransfer(ctx context.Context, transfer entity.TokenTransfer) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.addTokenTransfer(ctx, tx, transfer)
+	})
+}
+
+// addTokenTransfer stores the token transfer under whichever of its addresses are subscribed.
+func (s *SQLStore) addTokenTransfer(ctx context.Context, q queryer, transfer entity.TokenTransfer) error {
+	addresses, err := s.subscribedOf(ctx, q, transfer.From, transfer.To)
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if _, err := s.insertTokenTransfer(ctx, q, address, transfer, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) MergeTokenTransfers(ctx context.Context, address string, transfers []entity.TokenTransfer) (int, error) {
+	if address == "" {
+		return 0, nil
+	}
+	added := 0
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, transfer := range transfers {
+			inserted, err := s.insertTokenTransfer(ctx, tx, strings.ToLower(address), transfer, false)
+			if err != nil {
+				return err
+			}
+			if inserted {
+				added++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+const tokenTransferColumns = `transaction_hash, log_index, token, from_address, to_address, amount,
+	block_number, block_hash`
+
+func (s *SQLStore) insertTokenTransfer(ctx context.Context, q queryer, address string, transfer entity.TokenTransfer, replace bool) (bool, error) {
+	result, err := q.ExecContext(ctx, s.rebind(`INSERT INTO token_transfers (address, `+tokenTransferColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`+conflictClause("address, transaction_hash, log_index", tokenTransferColumns, replace)),
+		address, transfer.TransactionHash, transfer.LogIndex, transfer.Token, transfer.From,
+		transfer.To, transfer.Amount, transfer.BlockNumber, transfer.BlockHash)
+	return inserted(result, err)
+}
+
+func (s *SQLStore) GetTokenTransfers(ctx context.Context, address string) ([]entity.TokenTransfer, error) {
+	transfers := []entity.TokenTransfer{}
+	if address == "" {
+		return transfers, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT transaction_hash, log_index, token, from_address,
+		to_address, amount, block_number, block_hash FROM token_transfers
+		WHERE address = ? ORDER BY block_number, log_index`), strings.ToLower(address))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transfer entity.TokenTransfer
+		if err := rows.Scan(&transfer.TransactionHash, &transfer.LogIndex, &transfer.Token, &transfer.From,
+			&transfer.To, &transfer.Amount, &transfer.BlockNumber, &transfer.BlockHash); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, rows.Err()
+}
+
+func (s *SQLStore) AddNFTTransfer(ctx context.Context, transfer entity.NFTTransfer) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.addNFTTransfer(ctx, tx, transfer)
+	})
+}
+
+// addNFTTransfer stores the NFT transfer under whichever of its addresses are subscribed.
+func (s *SQLStore) addNFTTransfer(ctx context.Context, q queryer, transfer entity.NFTTransfer) error {
+	addresses, err := s.subscribedOf(ctx, q, transfer.From, transfer.To)
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if _, err := s.insertNFTTransfer(ctx, q, address, transfer, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) MergeNFTTransfers(ctx context.Context, address string, transfers []entity.NFTTransfer) (int, error) {
+	if address == "" {
+		return 0, nil
+	}
+	added := 0
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, transfer := range transfers {
+			inserted, err := s.insertNFTTransfer(ctx, tx, strings.ToLower(address), transfer, false)
+			if err != nil {
+				return err
+			}
+			if inserted {
+				added++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+const nftTransferColumns = `transaction_hash, log_index, contract, standard, operator, from_address,
+	to_address, token_ids, quantities, block_number, block_hash`
+
+func (s *SQLStore) insertNFTTransfer(ctx context.Context, q queryer, address string, transfer entity.NFTTransfer, replace bool) (bool, error) {
+	tokenIDs, err := json.Marshal(transfer.TokenIDs)
+	if err != nil {
+		return false, err
+	}
+	quantities, err := json.Marshal(transfer.Quantities)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := q.ExecContext(ctx, s.rebind(`INSERT INTO nft_transfers (address, `+nftTransferColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`+conflictClause("address, transaction_hash, log_index", nftTransferColumns, replace)),
+		address, transfer.TransactionHash, transfer.LogIndex, transfer.Contract, transfer.Standard,
+		transfer.Operator, transfer.From, transfer.To, string(tokenIDs), string(quantities),
+		transfer.BlockNumber, transfer.BlockHash)
+	return inserted(result, err)
+}
+
+func (s *SQLStore) GetNFTTransfers(ctx context.Context, address string) ([]entity.NFTTransfer, error) {
+	transfers := []entity.NFTTransfer{}
+	if address == "" {
+		return transfers, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT transaction_hash, log_index, contract, standard,
+		operator, from_address, to_address, token_ids, quantities, block_number, block_hash
+		FROM nft_transfers WHERE address = ? ORDER BY block_number, log_index`), strings.ToLower(address))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transfer entity.NFTTransfer
+		var tokenIDs, quantities string
+		if err := rows.Scan(&transfer.TransactionHash, &transfer.LogIndex, &transfer.Contract,
+			&transfer.Standard, &transfer.Operator, &transfer.From, &transfer.To, &tokenIDs, &quantities,
+			&transfer.BlockNumber, &transfer.BlockHash); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(tokenIDs), &transfer.TokenIDs); err != nil {
+			return nil, fmt.Errorf("error decoding token IDs: %w", err)
+		}
+		if err := json.Unmarshal([]byte(quantities), &transfer.Quantities); err != nil {
+			return nil, fmt.Errorf("error decoding quantities: %w", err)
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, rows.Err()
+}
+
+func (s *SQLStore) AddInternalTransfer(ctx context.Context, transfer entity.InternalTransfer) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.addInternalTransfer(ctx, tx, transfer)
+	})
+}
+
+// addInternalTransfer stores the internal transfer under whichever of its addresses are subscribed.
+func (s *SQLStore) addInternalTransfer(ctx context.Context, q queryer, transfer entity.InternalTransfer) error {
+	addresses, err := s.subscribedOf(ctx, q, transfer.From, transfer.To)
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if _, err := s.insertInternalTransfer(ctx, q, address, transfer, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) MergeInternalTransfers(ctx context.Context, address string, transfers []entity.InternalTransfer) (int, error) {
+	if address == "" {
+		return 0, nil
+	}
+	added := 0
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, transfer := range transfers {
+			inserted, err := s.insertInternalTransfer(ctx, tx, strings.ToLower(address), transfer, false)
+			if err != nil {
+				return err
+			}
+			if inserted {
+				added++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+const internalTransferColumns = `transaction_hash, trace_path, call_type, from_address, to_address,
+	value, block_number, block_hash`
+
+func (s *SQLStore) insertInternalTransfer(ctx context.Context, q queryer, address string, transfer entity.InternalTransfer, replace bool) (bool, error) {
+	result, err := q.ExecContext(ctx, s.rebind(`INSERT INTO internal_transfers (address, `+internalTransferColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`+conflictClause("address, transaction_hash, trace_path", internalTransferColumns, replace)),
+		address, transfer.TransactionHash, formatTracePath(transfer.TracePath), transfer.CallType,
+		transfer.From, transfer.To, amountString(transfer.Value), transfer.BlockNumber, transfer.BlockHash)
+	return inserted(result, err)
+}
+
+func (s *SQLStore) GetInternalTransfers(ctx context.Context, address string) ([]entity.InternalTransfer, error) {
+	transfers := []entity.InternalTransfer{}
+	if address == "" {
+		return transfers, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT transaction_hash, trace_path, call_type,
+		from_address, to_address, value, block_number, block_hash FROM internal_transfers
+		WHERE address = ? ORDER BY block_number, transaction_hash, trace_path`), strings.ToLower(address))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transfer entity.InternalTransfer
+		var path, value string
+		if err := rows.Scan(&transfer.TransactionHash, &path, &transfer.CallType, &transfer.From,
+			&transfer.To, &value, &transfer.BlockNumber, &transfer.BlockHash); err != nil {
+			return nil, err
+		}
+		if transfer.TracePath, err = parseTracePath(path); err != nil {
+			return nil, err
+		}
+		if transfer.Value, err = parseAmount(value); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, rows.Err()
+}
+
+func (s *SQLStore) AddWithdrawal(ctx context.Context, withdrawal entity.Withdrawal) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.addWithdrawal(ctx, tx, withdrawal)
+	})
+}
+
+// addWithdrawal stores the withdrawal under whichever of its addresses are subscribed.
+func (s *SQLStore) addWithdrawal(ctx context.Context, q queryer, withdrawal entity.Withdrawal) error {
+	addresses, err := s.subscribedOf(ctx, q, withdrawal.Address)
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if _, err := s.insertWithdrawal(ctx, q, address, withdrawal, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) MergeWithdrawals(ctx context.Context, address string, withdrawals []entity.Withdrawal) (int, error) {
+	if address == "" {
+		return 0, nil
+	}
+	added := 0
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, withdrawal := range withdrawals {
+			inserted, err := s.insertWithdrawal(ctx, tx, strings.ToLower(address), withdrawal, false)
+			if err != nil {
+				return err
+			}
+			if inserted {
+				added++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+const withdrawalColumns = `withdrawal_index, validator_index, amount, block_number, block_hash,
+	block_timestamp`
+
+func (s *SQLStore) insertWithdrawal(ctx context.Context, q queryer, address string, withdrawal entity.Withdrawal, replace bool) (bool, error) {
+	result, err := q.ExecContext(ctx, s.rebind(`INSERT INTO withdrawals (address, `+withdrawalColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		`+conflictClause("address, withdrawal_index", withdrawalColumns, replace)),
+		address, int64(withdrawal.Index), int64(withdrawal.ValidatorIndex), amountString(withdrawal.Amount),
+		withdrawal.BlockNumber, withdrawal.BlockHash, withdrawal.BlockTimestamp)
+	return inserted(result, err)
+}
+
+func (s *SQLStore) GetWithdrawals(ctx context.Context, address string) ([]entity.Withdrawal, error) {
+	withdrawals := []entity.Withdrawal{}
+	if address == "" {
+		return withdrawals, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT withdrawal_index, validator_index, amount,
+		block_number, block_hash, block_timestamp FROM withdrawals
+		WHERE address = ? ORDER BY block_number, withdrawal_index`), strings.ToLower(address))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		withdrawal := entity.Withdrawal{Address: strings.ToLower(address)}
+		var index, validatorIndex int64
+		var amount string
+		if err := rows.Scan(&index, &validatorIndex, &amount, &withdrawal.BlockNumber,
+			&withdrawal.BlockHash, &withdrawal.BlockTimestamp); err != nil {
+			return nil, err
+		}
+		withdrawal.Index, withdrawal.ValidatorIndex = uint64(index), uint64(validatorIndex)
+		if withdrawal.Amount, err = parseAmount(amount); err != nil {
+			return nil, err
+		}
+		withdrawals = append(withdrawals, withdrawal)
+	}
+	return withdrawals, rows.Err()
+}
+
+func (s *SQLStore) SaveContractABI(ctx context.Context, address string, abi []byte) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO contract_abis (address, abi) VALUES (?, ?)
+		ON CONFLICT (address) DO UPDATE SET abi = excluded.abi`), strings.ToLower(address), string(abi))
+	return err
+}
+
+func (s *SQLStore) GetContractABI(ctx context.Context, address string) ([]byte, bool, error) {
+	var abi string
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT abi FROM contract_abis WHERE address = ?`),
+		strings.ToLower(address)).Scan(&abi)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return []byte(abi), true, nil
+}
+
+func (s *SQLStore) GetContractABIs(ctx context.Context) (map[string][]byte, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT address, abi FROM contract_abis`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	abis := make(map[string][]byte)
+	for rows.Next() {
+		var address, abi string
+		if err := rows.Scan(&address, &abi); err != nil {
+			return nil, err
+		}
+		abis[address] = []byte(abi)
+	}
+	return abis, rows.Err()
+}
+
+func (s *SQLStore) SaveBlockHeader(ctx context.Context, header entity.BlockHeader) error {
+	return s.saveBlockHeader(ctx, s.db, header)
+}
+
+func (s *SQLStore) saveBlockHeader(ctx context.Context, q queryer, header entity.BlockHeader) error {
+	_, err := q.ExecContext(ctx, s.rebind(`INSERT INTO block_headers (number, hash, parent_hash, timestamp)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (number) DO UPDATE SET hash = excluded.hash, parent_hash = excluded.parent_hash,
+			timestamp = excluded.timestamp`),
+		header.Number, header.Hash, header.ParentHash, header.Timestamp)
+	return err
+}
+
+func (s *SQLStore) GetBlockHeader(ctx context.Context, number int) (entity.BlockHeader, bool, error) {
+	header := entity.BlockHeader{Number: number}
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT hash, parent_hash, timestamp FROM block_headers
+		WHERE number = ?`), number).Scan(&header.Hash, &header.ParentHash, &header.Timestamp)
+	if err == sql.ErrNoRows {
+		return entity.BlockHeader{}, false, nil
+	}
+	if err != nil {
+		return entity.BlockHeader{}, false, err
+	}
+	return header, true, nil
+}
+
+func (s *SQLStore) PruneBlockHeaders(ctx context.Context, before int) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM block_headers WHERE number < ?`), before)
+	return err
+}
+
+func (s *SQLStore) CommitBlock(ctx context.Context, commit entity.BlockCommit) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		committed, err := s.isCommitted(ctx, tx, commit.Header)
+		if err != nil || committed {
+			return err
+		}
+
+		for _, address := range commit.Subscriptions {
+			if address == "" {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO subscriptions (address, created_at, commit_block)
+				VALUES (?, ?, ?) ON CONFLICT (address) DO NOTHING`),
+				strings.ToLower(address), time.Now().Unix(), commit.Header.Number); err != nil {
+				return err
+			}
+		}
+		for _, transaction := range commit.Transactions {
+			if err := s.addTransaction(ctx, tx, transaction); err != nil {
+				return err
+			}
+		}
+		for _, transfer := range commit.TokenTransfers {
+			if err := s.addTokenTransfer(ctx, tx, transfer); err != nil {
+				return err
+			}
+		}
+		for _, transfer := range commit.NFTTransfers {
+			if err := s.addNFTTransfer(ctx, tx, transfer); err != nil {
+				return err
+			}
+		}
+		for _, transfer := range commit.InternalTransfers {
+			if err := s.addInternalTransfer(ctx, tx, transfer); err != nil {
+				return err
+			}
+		}
+		for _, withdrawal := range commit.Withdrawals {
+			if err := s.addWithdrawal(ctx, tx, withdrawal); err != nil {
+				return err
+			}
+		}
+		if err := s.saveBlockHeader(ctx, tx, commit.Header); err != nil {
+			return err
+		}
+		return s.setCurrentBlock(ctx, tx, commit.Header.Number)
+	})
+}
+
+// isCommitted reports whether the block was already committed: its header
+// is stored with the same hash and the current block has reached it.
+func (s *SQLStore) isCommitted(ctx context.Context, q queryer, header entity.BlockHeader) (bool, error) {
+	var hash string
+	var current int
+	err := q.QueryRowContext(ctx, s.rebind(`SELECT block_headers.hash, parser_state.current_block
+		FROM block_headers, parser_state WHERE block_headers.number = ? AND parser_state.id = 1`),
+		header.Number).Scan(&hash, &current)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return hash == header.Hash && current >= header.Number, nil
+}
+
+// historyTables are the tables holding per-block records.
+var historyTables = []string{"transactions", "token_transfers", "nft_transfers", "internal_transfers", "withdrawals"}
+
+func (s *SQLStore) RollbackTo(ctx context.Context, block int) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, table := range historyTables {
+			if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM `+table+` WHERE block_number > ?`), block); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM block_headers WHERE number > ?`), block); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM subscriptions WHERE commit_block > ?`), block); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, s.rebind(`UPDATE parser_state SET current_block = ?
+			WHERE id = 1 AND current_block > ?`), block, block)
+		return err
+	})
+}
+
+// conflictClause returns the ON CONFLICT clause for rows keyed by the key
+// columns. With replace a stored row takes the new values of the other
+// columns, otherwise it is kept as it is.
+func conflictClause(key, columns string, replace bool) string {
+	if !replace {
+		return "ON CONFLICT (" + key + ") DO NOTHING"
+	}
+	keyColumns := make(map[string]bool)
+	for _, column := range strings.Split(key, ",") {
+		keyColumns[strings.TrimSpace(column)] = true
+	}
+	var updates []string
+	for _, column := range strings.Split(columns, ",") {
+		column = strings.TrimSpace(column)
+		if !keyColumns[column] {
+			updates = append(updates, column+" = excluded."+column)
+		}
+	}
+	return "ON CONFLICT (" + key + ") DO UPDATE SET " + strings.Join(updates, ", ")
+}
+
+// inserted reports whether an INSERT ... ON CONFLICT DO NOTHING added a row.
+func inserted(result sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func amountString(amount *big.Int) string {
+	if amount == nil {
+		return "0"
+	}
+	return amount.String()
+}
+
+func parseAmount(value string) (*big.Int, error) {
+	amount, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid stored amount %q", value)
+	}
+	return amount, nil
+}
+
+// formatTracePath encodes a trace path as dot-separated indexes, with the
+// top-level call as the empty string.
+func formatTracePath(path []int) string {
+	parts := make([]string, len(path))
+	for i, index := range path {
+		parts[i] = strconv.Itoa(index)
+	}
+	return strings.Join(parts, ".")
+}
+
+func parseTracePath(value string) ([]int, error) {
+	if value == "" {
+		return []int{}, nil
+	}
+	parts := strings.Split(value, ".")
+	path := make([]int, len(parts))
+	for i, part := range parts {
+		index, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored trace path %q", value)
+		}
+		path[i] = index
+	}
+	return path, nil
+}
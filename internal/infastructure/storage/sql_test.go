@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"context"
+	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	_ "github.com/mattn/go-sqlite3"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestSQLStore(t *testing.T, path string) *SQLStore {
+	t.Helper()
+	store, err := NewSQLStore(context.Background(), "sqlite3", path)
+	if err != nil {
+		t.Fatalf("NewSQLStore() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLStore_Migrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db")
+	newTestSQLStore(t, path)
+
+	// Opening again finds the schema up to date
+	store := newTestSQLStore(t, path)
+	var applied, latest int
+	if err := store.db.QueryRow(`SELECT COUNT(*), MAX(version) FROM schema_migrations`).Scan(&applied, &latest); err != nil {
+		t.Fatalf("Reading schema_migrations error = %v", err)
+	}
+	if applied != len(migrations) || latest != migrations[len(migrations)-1].version {
+		t.Errorf("Applied %d migrations up to %d, want %d up to %d",
+			applied, latest, len(migrations), migrations[len(migrations)-1].version)
+	}
+}
+
+func TestSQLStore_Transactions(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLStore(t, filepath.Join(t.TempDir(), "store.db"))
+
+	if _, err := store.Subscribe(ctx, "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if subscribed, _ := store.IsSubscribed(ctx, testAddress); !subscribed {
+		t.Error("IsSubscribed() = false, want true")
+	}
+	if subscriptions, _ := store.GetSubscriptions(ctx); !reflect.DeepEqual(subscriptions, []string{testAddress}) {
+		t.Errorf("GetSubscriptions() = %v, want [%s]", subscriptions, testAddress)
+	}
+
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	live := entity.Transaction{
+		Hash: "0xa", From: testAddress, To: "0x1", Value: huge, BlockNumber: 12, BlockHash: "0xb12",
+		BlockTimestamp: 1704067200, Nonce: 3, Gas: 21000, GasPrice: "0x1", Type: 2, ChainID: 1,
+		Receipt: &entity.Receipt{Status: entity.ReceiptStatusSuccess, GasUsed: 21000, Logs: []entity.Log{}},
+	}
+	if err := store.AddTransaction(ctx, live); err != nil {
+		t.Fatalf("AddTransaction() error = %v", err)
+	}
+	// Not involving a subscribed address
+	store.AddTransaction(ctx, entity.Transaction{Hash: "0xc", From: "0x1", To: "0x2", BlockNumber: 12})
+
+	added, err := store.MergeTransactions(ctx, testAddress, []entity.Transaction{
+		{Hash: "0xa", From: testAddress, To: "0x1", BlockNumber: 12},
+		{Hash: "0xb", From: "0x1", To: testAddress, Value: big.NewInt(5), BlockNumber: 10},
+	})
+	if err != nil {
+		t.Fatalf("MergeTransactions() error = %v", err)
+	}
+	if added != 1 {
+		t.Errorf("MergeTransactions() added %d, want 1", added)
+	}
+
+	txs, err := store.GetTransactions(ctx, "0x742D35CC6634C0532925A3B844BC454E4438F44E")
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+	if len(txs) != 2 || txs[0].Hash != "0xb" || txs[1].Hash != "0xa" {
+		t.Fatalf("GetTransactions() = %+v, want 0xb then 0xa", txs)
+	}
+	if !reflect.DeepEqual(txs[1], live) {
+		t.Errorf("Stored transaction = %+v, want %+v", txs[1], live)
+	}
+}
+
+func TestSQLStore_Transfers(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLStore(t, filepath.Join(t.TempDir(), "store.db"))
+	store.Subscribe(ctx, testAddress)
+
+	token := entity.TokenTransfer{
+		Token: "0xusdc", From: "0x1", To: testAddress, Amount: "1000000",
+		TransactionHash: "0xa", LogIndex: 1, BlockNumber: 12, BlockHash: "0xb12",
+	}
+	nft := entity.NFTTransfer{
+		Contract: "0xnft", Standard: entity.StandardERC1155, Operator: "0x1", From: "0x1", To: testAddress,
+		TokenIDs: []string{"10", "11"}, Quantities: []string{"1", "5"},
+		TransactionHash: "0xa", LogIndex: 2, BlockNumber: 12, BlockHash: "0xb12",
+	}
+	internal := entity.InternalTransfer{
+		TransactionHash: "0xa", TracePath: []int{1, 0}, CallType: "CALL", From: "0x1", To: testAddress,
+		Value: big.NewInt(7), BlockNumber: 12, BlockHash: "0xb12",
+	}
+	withdrawal := entity.Withdrawal{
+		Index: 16, ValidatorIndex: 5, Address: testAddress, Amount: big.NewInt(1000000000),
+		BlockNumber: 12, BlockHash: "0xb12", BlockTimestamp: 1704067200,
+	}
+	for i, add := range []func() error{
+		func() error { return store.AddTokenTransfer(ctx, token) },
+		func() error { return store.AddNFTTransfer(ctx, nft) },
+		func() error { return store.AddInternalTransfer(ctx, internal) },
+		func() error { return store.AddWithdrawal(ctx, withdrawal) },
+	} {
+		if err := add(); err != nil {
+			t.Fatalf("Add %d error = %v", i, err)
+		}
+	}
+
+	if got, _ := store.GetTokenTransfers(ctx, testAddress); !reflect.DeepEqual(got, []entity.TokenTransfer{token}) {
+		t.Errorf("GetTokenTransfers() = %+v, want [%+v]", got, token)
+	}
+	if got, _ := store.GetNFTTransfers(ctx, testAddress); !reflect.DeepEqual(got, []entity.NFTTransfer{nft}) {
+		t.Errorf("GetNFTTransfers() = %+v, want [%+v]", got, nft)
+	}
+	if got, _ := store.GetInternalTransfers(ctx, testAddress); !reflect.DeepEqual(got, []entity.InternalTransfer{internal}) {
+		t.Errorf("GetInternalTransfers() = %+v, want [%+v]", got, internal)
+	}
+	if got, _ := store.GetWithdrawals(ctx, testAddress); !reflect.DeepEqual(got, []entity.Withdrawal{withdrawal}) {
+		t.Errorf("GetWithdrawals() = %+v, want [%+v]", got, withdrawal)
+	}
+
+	// Merging what is already stored adds nothing
+	if added, _ := store.MergeTokenTransfers(ctx, testAddress, []entity.TokenTransfer{token}); added != 0 {
+		t.Errorf("MergeTokenTransfers() added %d, want 0", added)
+	}
+	if added, _ := store.MergeNFTTransfers(ctx, testAddress, []entity.NFTTransfer{nft}); added != 0 {
+		t.Errorf("MergeNFTTransfers() added %d, want 0", added)
+	}
+	if added, _ := store.MergeInternalTransfers(ctx, testAddress, []entity.InternalTransfer{internal}); added != 0 {
+		t.Errorf("MergeInternalTransfers() added %d, want 0", added)
+	}
+	if added, _ := store.MergeWithdrawals(ctx, testAddress, []entity.Withdrawal{withdrawal}); added != 0 {
+		t.Errorf("MergeWithdrawals() added %d, want 0", added)
+	}
+}
+
+func TestSQLStore_BlocksAndRollback(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLStore(t, filepath.Join(t.TempDir(), "store.db"))
+	store.Subscribe(ctx, testAddress)
+
+	for block := 10; block <= 12; block++ {
+		store.AddTransaction(ctx, entity.Transaction{Hash: "0x" + string(rune('a'+block-10)), From: testAddress, BlockNumber: block})
+		store.AddWithdrawal(ctx, entity.Withdrawal{Index: uint64(block), Address: testAddress, BlockNumber: block})
+		store.SaveBlockHeader(ctx, entity.BlockHeader{Number: block, Hash: "0xh", ParentHash: "0xp", Timestamp: int64(block)})
+		store.SetCurrentBlock(ctx, block)
+	}
+
+	if header, ok, _ := store.GetBlockHeader(ctx, 11); !ok || header.Timestamp != 11 {
+		t.Errorf("GetBlockHeader(11) = %+v, %v, want timestamp 11", header, ok)
+	}
+	if err := store.PruneBlockHeaders(ctx, 11); err != nil {
+		t.Fatalf("PruneBlockHeaders() error = %v", err)
+	}
+	if _, ok, _ := store.GetBlockHeader(ctx, 10); ok {
+		t.Error("GetBlockHeader(10) found a pruned header")
+	}
+
+	if err := store.RollbackTo(ctx, 10); err != nil {
+		t.Fatalf("RollbackTo() error = %v", err)
+	}
+	if block, _ := store.GetCurrentBlock(ctx); block != 10 {
+		t.Errorf("GetCurrentBlock() = %d, want 10", block)
+	}
+	if txs, _ := store.GetTransactions(ctx, testAddress); len(txs) != 1 || txs[0].BlockNumber != 10 {
+		t.Errorf("GetTransactions() after rollback = %+v, want only block 10", txs)
+	}
+	if withdrawals, _ := store.GetWithdrawals(ctx, testAddress); len(withdrawals) != 1 {
+		t.Errorf("GetWithdrawals() after rollback returned %d, want 1", len(withdrawals))
+	}
+	if _, ok, _ := store.GetBlockHeader(ctx, 11); ok {
+		t.Error("GetBlockHeader(11) found an orphaned header")
+	}
+
+	if err := store.SaveContractABI(ctx, "0xABC", []byte(`[1]`)); err != nil {
+		t.Fatalf("SaveContractABI() error = %v", err)
+	}
+	store.SaveContractABI(ctx, "0xabc", []byte(`[2]`))
+	if abi, ok, _ := store.GetContractABI(ctx, "0xAbc"); !ok || string(abi) != "[2]" {
+		t.Errorf("GetContractABI() = %q, %v, want the replaced ABI", abi, ok)
+	}
+}
+
+func TestSQLStore_Rebind(t *testing.T) {
+	store := &SQLStore{dialect: postgresDialect}
+	got := store.rebind(`SELECT a FROM t WHERE b = ? AND c > ?`)
+	if want := `SELECT a FROM t WHERE b = $1 AND c > $2`; got != want {
+		t.Errorf("rebind() = %q, want %q", got, want)
+	}
+	if statement := postgresDialect.columnTypes(`value {{uint256}}, data {{json}}`); statement != `value NUMERIC(78, 0), data JSONB` {
+		t.Errorf("columnTypes() = %q", statement)
+	}
+}
+
+func TestSQLStore_CommitBlock(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLStore(t, filepath.Join(t.TempDir(), "store.db"))
+	store.Subscribe(ctx, testAddress)
+
+	commit := entity.BlockCommit{
+		Header:         entity.BlockHeader{Number: 10, Hash: "0x10", ParentHash: "0x9", Timestamp: 100},
+		Transactions:   []entity.Transaction{{Hash: "0xa", From: testAddress, BlockNumber: 10}},
+		TokenTransfers: []entity.TokenTransfer{{Token: "0xt", From: testAddress, Amount: "1", TransactionHash: "0xa", BlockNumber: 10}},
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.CommitBlock(ctx, commit); err != nil {
+			t.Fatalf("CommitBlock() %d error = %v", i, err)
+		}
+	}
+	if block, _ := store.GetCurrentBlock(ctx); block != 10 {
+		t.Errorf("GetCurrentBlock() = %d, want 10", block)
+	}
+	if header, ok, _ := store.GetBlockHeader(ctx, 10); !ok || header != commit.Header {
+		t.Errorf("GetBlockHeader() = %+v, %v, want %+v", header, ok, commit.Header)
+	}
+	if txs, _ := store.GetTransactions(ctx, testAddress); len(txs) != 1 {
+		t.Errorf("GetTransactions() returned %d transactions, want 1", len(txs))
+	}
+
+	// A failing statement rolls the whole block back
+	store.db.Exec(`DROP TABLE withdrawals`)
+	failing := entity.BlockCommit{
+		Header:       entity.BlockHeader{Number: 11, Hash: "0x11", ParentHash: "0x10"},
+		Transactions: []entity.Transaction{{Hash: "0xb", From: testAddress, BlockNumber: 11}},
+		Withdrawals:  []entity.Withdrawal{{Index: 1, Address: testAddress, BlockNumber: 11}},
+	}
+	if err := store.CommitBlock(ctx, failing); err == nil {
+		t.Fatal("CommitBlock() succeeded without a withdrawals table, want error")
+	}
+	if block, _ := store.GetCurrentBlock(ctx); block != 10 {
+		t.Errorf("GetCurrentBlock() after failed commit = %d, want 10", block)
+	}
+	if txs, _ := store.GetTransactions(ctx, testAddress); len(txs) != 1 {
+		t.Errorf("GetTransactions() after failed commit returned %d transactions, want 1", len(txs))
+	}
+}
+
+func TestSQLStore_CommitSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLStore(t, filepath.Join(t.TempDir(), "store.db"))
+	store.Subscribe(ctx, testAddress)
+
+	contract := "0x5fbdb2315678afecb367f032d93f642f64180aa3"
+	direct := "0x28c6c06298d514db089934071355e5743bf21d60"
+	commit := entity.BlockCommit{
+		Header:        entity.BlockHeader{Number: 10, Hash: "0x10"},
+		Subscriptions: []string{contract, direct, testAddress},
+		Transactions:  []entity.Transaction{{Hash: "0xa", From: testAddress, CreatedContract: contract, BlockNumber: 10}},
+	}
+	if err := store.CommitBlock(ctx, commit); err != nil {
+		t.Fatalf("CommitBlock() error = %v", err)
+	}
+	store.Subscribe(ctx, direct)
+	if txs, _ := store.GetTransactions(ctx, contract); len(txs) != 1 {
+		t.Errorf("GetTransactions() for the contract returned %d transactions, want its creation", len(txs))
+	}
+
+	// Rolling the block back undoes only the subscription the commit made
+	if err := store.RollbackTo(ctx, 9); err != nil {
+		t.Fatalf("RollbackTo() error = %v", err)
+	}
+	want := []string{direct, testAddress}
+	if subscriptions, _ := store.GetSubscriptions(ctx); !reflect.DeepEqual(subscriptions, want) {
+		t.Errorf("GetSubscriptions() after rollback = %v, want %v", subscriptions, want)
+	}
+}
+
+func TestSQLStore_AddReplacesDuplicates(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLStore(t, filepath.Join(t.TempDir(), "store.db"))
+	store.Subscribe(ctx, testAddress)
+
+	self := entity.Transaction{Hash: "0xa", From: testAddress, To: testAddress, Value: big.NewInt(1), BlockNumber: 10}
+	store.AddTransaction(ctx, self)
+	self.Receipt = &entity.Receipt{Status: entity.ReceiptStatusSuccess, Logs: []entity.Log{}}
+	if err := store.AddTransaction(ctx, self); err != nil {
+		t.Fatalf("AddTransaction() again error = %v", err)
+	}
+	txs, _ := store.GetTransactions(ctx, testAddress)
+	if len(txs) != 1 || txs[0].Receipt == nil {
+		t.Errorf("GetTransactions() = %+v, want 0xa once with its receipt", txs)
+	}
+
+	withdrawal := entity.Withdrawal{Index: 1, Address: testAddress, Amount: big.NewInt(1), BlockNumber: 10}
+	store.AddWithdrawal(ctx, withdrawal)
+	withdrawal.Amount = big.NewInt(2)
+	store.AddWithdrawal(ctx, withdrawal)
+	if withdrawals, _ := store.GetWithdrawals(ctx, testAddress); len(withdrawals) != 1 || withdrawals[0].Amount.Int64() != 2 {
+		t.Errorf("GetWithdrawals() = %+v, want one withdrawal of 2", withdrawals)
+	}
+}
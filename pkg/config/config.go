@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -9,29 +11,133 @@ import (
 type Config struct {
 	Server   ServerConfig
 	Ethereum EthereumConfig
+	Parser   ParserConfig
+	Storage  StorageConfig
 }
 
 type ServerConfig struct {
-	Port int    `mapstructure:"port"`
-	Host string `mapstructure:"host"`
+	Port           int           `mapstructure:"port"`
+	Host           string        `mapstructure:"host"`
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
 }
 
 type EthereumConfig struct {
-	RPCURL        string        `mapstructure:"rpc_url"`
-	RetryAttempts int           `mapstructure:"retry_attempts"`
-	RetryDelay    time.Duration `mapstructure:"retry_delay"`
+	RPCURL         string        `mapstructure:"rpc_url"`
+	RetryAttempts  int           `mapstructure:"retry_attempts"`
+	RetryDelay     time.Duration `mapstructure:"retry_delay"`
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+	// WSURL, when set, streams new heads over eth_subscribe instead of
+	// waiting for the next poll.
+	WSURL string `mapstructure:"ws_url"`
+
+	// Endpoints, when set, replaces RPCURL with a health-checked pool.
+	Endpoints           []EndpointConfig `mapstructure:"endpoints"`
+	HealthCheckInterval time.Duration    `mapstructure:"health_check_interval"`
+	MaxBlockLag         int              `mapstructure:"max_block_lag"`
+}
+
+type EndpointConfig struct {
+	URL    string `mapstructure:"url"`
+	Weight int    `mapstructure:"weight"`
+}
+
+type ParserConfig struct {
+	ConfirmationDepth int `mapstructure:"confirmation_depth"`
+	BatchSize         int `mapstructure:"batch_size"`
+	Workers           int `mapstructure:"workers"`
+
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+
+	// StartBlock is "checkpoint", "latest", "latest-N" or a block number.
+	StartBlock     string `mapstructure:"start_block"`
+	CheckpointPath string `mapstructure:"checkpoint_path"`
+	MaxResumeGap   int    `mapstructure:"max_resume_gap"`
+
+	// Tracing is "off", "debug" (debug_traceBlockByNumber), "trace"
+	// (trace_block) or "auto" and enables recording internal transfers.
+	Tracing string `mapstructure:"tracing"`
+	// AutoSubscribeContracts subscribes contracts deployed by subscribed
+	// addresses.
+	AutoSubscribeContracts bool `mapstructure:"auto_subscribe_contracts"`
+}
+
+type StorageConfig struct {
+	// Type is "memory", "file" or "sql".
+	Type string `mapstructure:"type"`
+	// Path is the directory the file store keeps its log and snapshot in.
+	Path string `mapstructure:"path"`
+	// SnapshotInterval is how many changes the file store logs before
+	// compacting them into a snapshot.
+	SnapshotInterval int `mapstructure:"snapshot_interval"`
+	// Driver is the database/sql driver of the SQL store, "postgres" or
+	// "sqlite3". Only cgo builds include "sqlite3".
+	Driver string `mapstructure:"driver"`
+	// DSN is the connection string the SQL store opens.
+	DSN string `mapstructure:"dsn"`
+	// Retention bounds the history the memory and file stores keep.
+	Retention RetentionConfig `mapstructure:"retention"`
+}
+
+// RetentionConfig limits stored history: transactions, token, NFT and
+// internal transfers and withdrawals. Zero is unlimited. The oldest records
+// are evicted first.
+type RetentionConfig struct {
+	// MaxPerAddress is the most records of each kind kept for one address.
+	MaxPerAddress int `mapstructure:"max_per_address"`
+	// MaxAgeBlocks drops records this many blocks below the current block.
+	MaxAgeBlocks int `mapstructure:"max_age_blocks"`
+	// MaxAge drops records from blocks older than this.
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// MaxBytes is a rough budget, in bytes, for the records of all addresses
+	// together. It is an estimate of the records' contents, not of the
+	// process's memory, which ends up noticeably larger.
+	MaxBytes int64 `mapstructure:"max_bytes"`
 }
 
 func LoadConfig() (*Config, error) {
 	viper.SetDefault("server.port", 8080)
 	viper.SetDefault("server.host", "0.0.0.0")
+	viper.SetDefault("server.request_timeout", "30s")
 	viper.SetDefault("ethereum.rpc_url", "https://ethereum-rpc.publicnode.com")
 	viper.SetDefault("ethereum.retry_attempts", 3)
 	viper.SetDefault("ethereum.retry_delay", "2s")
+	viper.SetDefault("ethereum.request_timeout", "10s")
+	viper.SetDefault("ethereum.health_check_interval", "15s")
+	viper.SetDefault("ethereum.max_block_lag", 3)
+	viper.SetDefault("parser.confirmation_depth", 12)
+	viper.SetDefault("parser.batch_size", 10)
+	viper.SetDefault("parser.workers", 4)
+	viper.SetDefault("parser.poll_interval", "15s")
+	viper.SetDefault("parser.start_block", "checkpoint")
+	viper.SetDefault("parser.checkpoint_path", "data/checkpoint.json")
+	viper.SetDefault("parser.max_resume_gap", 1000)
+	viper.SetDefault("parser.tracing", "off")
+	viper.SetDefault("parser.auto_subscribe_contracts", false)
+	viper.SetDefault("storage.type", "memory")
+	viper.SetDefault("storage.path", "data/store")
+	viper.SetDefault("storage.snapshot_interval", 10000)
+	viper.SetDefault("storage.driver", "postgres")
+	viper.SetDefault("storage.dsn", "")
+	viper.SetDefault("storage.retention.max_per_address", 0)
+	viper.SetDefault("storage.retention.max_age_blocks", 0)
+	viper.SetDefault("storage.retention.max_age", "0s")
+	viper.SetDefault("storage.retention.max_bytes", 0)
 
-	// Environment variables
-	viper.AutomaticEnv()
+	// Optional config.yaml in the working directory
+	viper.SetConfigName("config")
+	viper.SetConfigType("yaml")
+	viper.AddConfigPath(".")
+	if err := viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return nil, err
+		}
+	}
+
+	// Environment variables, e.g. ETH_PARSER_ETHEREUM_RPC_URL
 	viper.SetEnvPrefix("ETH_PARSER")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
 
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
@@ -29,6 +29,11 @@ func (e *AppError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Type, e.Message)
 }
 
+// Unwrap exposes the underlying error to errors.Is and errors.As.
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
 // Error constructors
 func NewValidationError(message string, err error) *AppError {
 	return &AppError{
@@ -0,0 +1,191 @@
+// Package abi decodes Solidity ABI-encoded call data. It parses contract ABIs
+// in their JSON form as well as bare signatures such as
+// "transfer(address,uint256)", and decodes static and dynamic types, tuples
+// and arrays.
+package abi
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/crypto/sha3"
+	"strings"
+)
+
+// Method is a contract function.
+type Method struct {
+	Name   string
+	Inputs []Argument
+	// Signature is the canonical form the selector is derived from, such as
+	// "transfer(address,uint256)".
+	Signature string
+	// Selector is the first four bytes of the signature's Keccak-256 hash,
+	// which prefix the call data of every call to the method.
+	Selector [4]byte
+}
+
+// NewMethod derives the method's signature and selector.
+func NewMethod(name string, inputs []Argument) Method {
+	signature := name + "(" + typeList(inputs) + ")"
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(signature))
+
+	method := Method{Name: name, Inputs: inputs, Signature: signature}
+	copy(method.Selector[:], hash.Sum(nil))
+	return method
+}
+
+// SelectorHex returns the selector as 0x-prefixed hex.
+func (m Method) SelectorHex() string {
+	return "0x" + hex.EncodeToString(m.Selector[:])
+}
+
+// DecodeInput decodes call data, which must start with the method's
+// selector, into one value per input. See DecodeArguments for the Go types
+// values are decoded into.
+func (m Method) DecodeInput(input []byte) ([]interface{}, error) {
+	if len(input) < len(m.Selector) || string(input[:len(m.Selector)]) != string(m.Selector[:]) {
+		return nil, fmt.Errorf("input does not call %s", m.Signature)
+	}
+	return DecodeArguments(m.Inputs, input[len(m.Selector):])
+}
+
+// ABI is a parsed contract ABI, limited to its functions.
+type ABI struct {
+	methods map[[4]byte]Method
+}
+
+// jsonArgument is an input or tuple component in a JSON ABI.
+type jsonArgument struct {
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Components []jsonArgument `json:"components"`
+}
+
+// Parse reads a JSON ABI as produced by the Solidity compiler. Entries other
+// than functions (events, errors, constructors) are ignored.
+func Parse(data []byte) (*ABI, error) {
+	var entries []struct {
+		Type   string         `json:"type"`
+		Name   string         `json:"name"`
+		Inputs []jsonArgument `json:"inputs"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid ABI JSON: %v", err)
+	}
+
+	abi := &ABI{methods: make(map[[4]byte]Method)}
+	for _, entry := range entries {
+		// Old compilers omit the type of functions
+		if entry.Type != "function" && entry.Type != "" {
+			continue
+		}
+		if entry.Name == "" {
+			return nil, fmt.Errorf("function without a name")
+		}
+		inputs, err := parseArguments(entry.Inputs)
+		if err != nil {
+			return nil, fmt.Errorf("function %s: %v", entry.Name, err)
+		}
+		method := NewMethod(entry.Name, inputs)
+		abi.methods[method.Selector] = method
+	}
+	return abi, nil
+}
+
+func parseArguments(raw []jsonArgument) ([]Argument, error) {
+	args := make([]Argument, 0, len(raw))
+	for _, arg := range raw {
+		components, err := parseArguments(arg.Components)
+		if err != nil {
+			return nil, err
+		}
+		typ, err := ParseType(arg.Type, components)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, Argument{Name: arg.Name, Type: typ})
+	}
+	return args, nil
+}
+
+// Methods returns the number of functions in the ABI.
+func (a *ABI) Methods() int {
+	return len(a.methods)
+}
+
+// MethodBySelector returns the function called by input, which starts with
+// its selector.
+func (a *ABI) MethodBySelector(input []byte) (Method, bool) {
+	if a == nil || len(input) < 4 {
+		return Method{}, false
+	}
+	var selector [4]byte
+	copy(selector[:], input)
+	method, ok := a.methods[selector]
+	return method, ok
+}
+
+// ParseSignature parses a bare signature such as
+// "swap((address,uint256),bytes[])" into a method with unnamed inputs.
+func ParseSignature(signature string) (Method, error) {
+	signature = strings.TrimSpace(signature)
+	open := strings.Index(signature, "(")
+	if open <= 0 || !strings.HasSuffix(signature, ")") {
+		return Method{}, fmt.Errorf("invalid signature %q", signature)
+	}
+
+	inputs, err := parseTypeList(signature[open+1 : len(signature)-1])
+	if err != nil {
+		return Method{}, fmt.Errorf("invalid signature %q: %v", signature, err)
+	}
+	return NewMethod(signature[:open], inputs), nil
+}
+
+// parseTypeList parses comma-separated types, where tuples are written as
+// parenthesized type lists.
+func parseTypeList(list string) ([]Argument, error) {
+	var args []Argument
+	for len(list) > 0 {
+		end, depth := 0, 0
+		for end < len(list) && (depth > 0 || list[end] != ',') {
+			switch list[end] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			end++
+		}
+		if depth != 0 {
+			return nil, fmt.Errorf("unbalanced parentheses")
+		}
+
+		item := list[:end]
+		var typ Type
+		var err error
+		if strings.HasPrefix(item, "(") {
+			closing := strings.LastIndex(item, ")")
+			components, err := parseTypeList(item[1:closing])
+			if err != nil {
+				return nil, err
+			}
+			typ, err = ParseType("tuple"+item[closing+1:], components)
+			if err != nil {
+				return nil, err
+			}
+		} else if typ, err = ParseType(item, nil); err != nil {
+			return nil, err
+		}
+		args = append(args, Argument{Type: typ})
+
+		if end == len(list) {
+			break
+		}
+		list = list[end+1:]
+		if list == "" {
+			return nil, fmt.Errorf("trailing comma")
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,184 @@
+package abi
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// encode concatenates hex words, each left-padded to 32 bytes unless it is
+// already longer.
+func encode(t *testing.T, words ...string) []byte {
+	t.Helper()
+	var data []byte
+	for _, word := range words {
+		if len(word) < 64 {
+			word = strings.Repeat("0", 64-len(word)) + word
+		}
+		decoded, err := hex.DecodeString(word)
+		if err != nil {
+			t.Fatalf("invalid test word %q: %v", word, err)
+		}
+		data = append(data, decoded...)
+	}
+	return data
+}
+
+func TestParseSignature_Selectors(t *testing.T) {
+	tests := []struct {
+		signature string
+		want      string
+	}{
+		{signature: "transfer(address,uint256)", want: "0xa9059cbb"},
+		{signature: "approve(address,uint256)", want: "0x095ea7b3"},
+		{signature: "safeBatchTransferFrom(address,address,uint256[],uint256[],bytes)", want: "0x2eb2c2d6"},
+		{signature: "exactInputSingle((address,address,uint24,address,uint256,uint256,uint256,uint160))", want: "0x414bf389"},
+		{signature: "multicall(bytes[])", want: "0xac9650d8"},
+		{signature: "deposit()", want: "0xd0e30db0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.signature, func(t *testing.T) {
+			method, err := ParseSignature(tt.signature)
+			if err != nil {
+				t.Fatalf("ParseSignature() error = %v", err)
+			}
+			if method.Signature != tt.signature {
+				t.Errorf("Signature = %q, want %q", method.Signature, tt.signature)
+			}
+			if got := method.SelectorHex(); got != tt.want {
+				t.Errorf("SelectorHex() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"transfer", "transfer(address,", "f((uint256)", "f(uint7)", "f(uint256,)"} {
+		if _, err := ParseSignature(invalid); err == nil {
+			t.Errorf("ParseSignature(%q) succeeded, want error", invalid)
+		}
+	}
+}
+
+func TestMethod_DecodeInput(t *testing.T) {
+	const abiJSON = `[
+        {"type": "event", "name": "Ignored", "inputs": [{"name": "x", "type": "uint256"}]},
+        {"type": "function", "name": "settle", "inputs": [
+            {"name": "ids", "type": "uint256[]"},
+            {"name": "memo", "type": "string"},
+            {"name": "payout", "type": "tuple", "components": [
+                {"name": "to", "type": "address"},
+                {"name": "data", "type": "bytes"}
+            ]},
+            {"name": "delta", "type": "int8"},
+            {"name": "flags", "type": "bool[2]"}
+        ]}
+    ]`
+	contract, err := Parse([]byte(abiJSON))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if contract.Methods() != 1 {
+		t.Fatalf("Methods() = %d, want 1", contract.Methods())
+	}
+
+	method, err := ParseSignature("settle(uint256[],string,(address,bytes),int8,bool[2])")
+	if err != nil {
+		t.Fatalf("ParseSignature() error = %v", err)
+	}
+	to := "1111111111111111111111111111111111111111"
+	input := append(method.Selector[:], encode(t,
+		// Head: offsets of ids, memo and payout, then delta and flags
+		"c0", "120", "160", strings.Repeat("f", 64), "1", "0",
+		// ids
+		"2", "7", "8",
+		// memo
+		"5", "68656c6c6f"+strings.Repeat("0", 54),
+		// payout: to, offset of data within the tuple, then data
+		to, "40", "3", "abcdef"+strings.Repeat("0", 58),
+	)...)
+
+	found, ok := contract.MethodBySelector(input)
+	if !ok {
+		t.Fatal("MethodBySelector() found no method")
+	}
+	if found.Name != "settle" || found.Inputs[2].Type.Components[0].Name != "to" {
+		t.Errorf("MethodBySelector() = %+v", found)
+	}
+
+	values, err := found.DecodeInput(input)
+	if err != nil {
+		t.Fatalf("DecodeInput() error = %v", err)
+	}
+	want := []interface{}{
+		[]interface{}{big.NewInt(7), big.NewInt(8)},
+		"hello",
+		[]interface{}{"0x" + to, []byte{0xab, 0xcd, 0xef}},
+		big.NewInt(-1),
+		[]interface{}{true, false},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("DecodeInput() = %v, want %v", values, want)
+	}
+
+	// Damaged copies of the input must fail rather than panic
+	damaged := map[string][]byte{
+		"truncated":         input[:len(input)-40],
+		"offset past end":   append(method.Selector[:4:4], encode(t, "ffff", "120", "160", "0", "1", "0")...),
+		"huge array length": append(input[:4+6*32:4+6*32], encode(t, strings.Repeat("f", 64))...),
+		"wrong selector":    append([]byte{0, 0, 0, 0}, input[4:]...),
+	}
+	for name, data := range damaged {
+		if _, err := method.DecodeInput(data); err == nil {
+			t.Errorf("DecodeInput(%s) succeeded, want error", name)
+		}
+	}
+}
+
+func TestMethod_DecodeInput_HugeArrays(t *testing.T) {
+	for _, signature := range []string{"f(uint256[576460752303423488])", "f(string[100000000])"} {
+		if _, err := ParseSignature(signature); err == nil {
+			t.Errorf("ParseSignature(%s) succeeded, want error", signature)
+		}
+	}
+
+	// Lengths within the cap must still fail on short data rather than
+	// allocate or overflow
+	for _, signature := range []string{
+		"f(uint256[65536][65536][65536][65536][65536])",
+		"f(string[65536])",
+		"f((uint256[65536][65536][65536][65536],uint256[65536][65536][65536][65536]))",
+	} {
+		method, err := ParseSignature(signature)
+		if err != nil {
+			t.Fatalf("ParseSignature(%s) error = %v", signature, err)
+		}
+		input := append(method.Selector[:], encode(t, "20", "1")...)
+		if _, err := method.DecodeInput(input); err == nil {
+			t.Errorf("DecodeInput() for %s succeeded, want error", signature)
+		}
+	}
+}
+
+func TestLookupSelector(t *testing.T) {
+	input := encode(t, "a9059cbb"+strings.Repeat("0", 56))[:4]
+	input = append(input, encode(t, "2222222222222222222222222222222222222222", fmt.Sprintf("%x", 1000000))...)
+
+	method, ok := LookupSelector(input)
+	if !ok {
+		t.Fatal("LookupSelector() found no method for transfer")
+	}
+	values, err := method.DecodeInput(input)
+	if err != nil {
+		t.Fatalf("DecodeInput() error = %v", err)
+	}
+	if values[0] != "0x2222222222222222222222222222222222222222" || values[1].(*big.Int).Int64() != 1000000 {
+		t.Errorf("DecodeInput() = %v", values)
+	}
+
+	if _, ok := LookupSelector([]byte{0xde, 0xad, 0xbe, 0xef}); ok {
+		t.Error("LookupSelector() matched an unknown selector")
+	}
+}
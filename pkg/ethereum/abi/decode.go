@@ -0,0 +1,154 @@
+package abi
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// DecodeArguments decodes ABI-encoded values, laid out as a tuple of the
+// arguments' types. Values are decoded as:
+//
+//   - uintN, intN: *big.Int
+//   - address: 0x-prefixed lowercase hex string
+//   - bool: bool
+//   - bytesN, bytes: []byte
+//   - string: string
+//   - arrays and tuples: []interface{} holding the elements or fields
+func DecodeArguments(args []Argument, data []byte) ([]interface{}, error) {
+	types := make([]Type, len(args))
+	for i, arg := range args {
+		types[i] = arg.Type
+	}
+	return decodeTuple(types, data)
+}
+
+// decodeTuple decodes consecutive values whose heads start at data[0].
+// Offsets of dynamic values are relative to the same start.
+func decodeTuple(types []Type, data []byte) ([]interface{}, error) {
+	values := make([]interface{}, len(types))
+	head := 0
+	for i, typ := range types {
+		if typ.headSize() > len(data)-head {
+			return nil, fmt.Errorf("data too short for %s", typ)
+		}
+
+		start := head
+		if typ.dynamic() {
+			offset, err := readLength(data[head:], len(data))
+			if err != nil {
+				return nil, fmt.Errorf("invalid offset for %s: %v", typ, err)
+			}
+			start = offset
+		}
+
+		var err error
+		if values[i], err = decodeValue(typ, data[start:]); err != nil {
+			return nil, err
+		}
+		head += typ.headSize()
+	}
+	return values, nil
+}
+
+func decodeValue(typ Type, data []byte) (interface{}, error) {
+	switch typ.Kind {
+	case TupleKind:
+		types := make([]Type, len(typ.Components))
+		for i, component := range typ.Components {
+			types[i] = component.Type
+		}
+		return decodeTuple(types, data)
+
+	case ArrayKind:
+		// Every element takes at least a word, so a longer array cannot fit
+		if typ.Size > len(data)/wordSize {
+			return nil, fmt.Errorf("data too short for %s", typ)
+		}
+		return decodeTuple(repeat(*typ.Elem, typ.Size), data)
+
+	case SliceKind:
+		length, err := readLength(data, len(data)/wordSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid length for %s: %v", typ, err)
+		}
+		return decodeTuple(repeat(*typ.Elem, length), data[wordSize:])
+
+	case BytesKind, StringKind:
+		length, err := readLength(data, len(data)-wordSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid length for %s: %v", typ, err)
+		}
+		content := data[wordSize : wordSize+length]
+		if typ.Kind == StringKind {
+			return string(content), nil
+		}
+		return append([]byte(nil), content...), nil
+	}
+
+	if len(data) < wordSize {
+		return nil, fmt.Errorf("data too short for %s", typ)
+	}
+	word := data[:wordSize]
+
+	switch typ.Kind {
+	case UintKind:
+		value := new(big.Int).SetBytes(word)
+		if value.BitLen() > typ.Size {
+			return nil, fmt.Errorf("value out of range for %s", typ)
+		}
+		return value, nil
+	case IntKind:
+		value := new(big.Int).SetBytes(word)
+		if word[0]&0x80 != 0 {
+			// Two's complement
+			value.Sub(value, new(big.Int).Lsh(big.NewInt(1), wordSize*8))
+		}
+		limit := new(big.Int).Lsh(big.NewInt(1), uint(typ.Size-1))
+		if value.Cmp(limit) >= 0 || value.Cmp(new(big.Int).Neg(limit)) < 0 {
+			return nil, fmt.Errorf("value out of range for %s", typ)
+		}
+		return value, nil
+	case AddressKind:
+		if !zero(word[:12]) {
+			return nil, fmt.Errorf("invalid address padding")
+		}
+		return fmt.Sprintf("0x%x", word[12:]), nil
+	case BoolKind:
+		if !zero(word[:wordSize-1]) || word[wordSize-1] > 1 {
+			return nil, fmt.Errorf("invalid bool")
+		}
+		return word[wordSize-1] == 1, nil
+	case FixedBytesKind:
+		return append([]byte(nil), word[:typ.Size]...), nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", typ)
+}
+
+// readLength reads a word holding a length or offset no larger than limit.
+func readLength(data []byte, limit int) (int, error) {
+	if len(data) < wordSize {
+		return 0, fmt.Errorf("data too short")
+	}
+	value := new(big.Int).SetBytes(data[:wordSize])
+	if limit < 0 || !value.IsInt64() || value.Int64() > int64(limit) {
+		return 0, fmt.Errorf("%s exceeds the data", value)
+	}
+	return int(value.Int64()), nil
+}
+
+func repeat(typ Type, n int) []Type {
+	types := make([]Type, n)
+	for i := range types {
+		types[i] = typ
+	}
+	return types
+}
+
+func zero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
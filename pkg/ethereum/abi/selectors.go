@@ -0,0 +1,67 @@
+package abi
+
+import "fmt"
+
+// builtinSignatures are widely used functions recognized without an uploaded
+// ABI: token standards, WETH, Safe and the common Uniswap routers.
+var builtinSignatures = []string{
+	// ERC-20
+	"transfer(address,uint256)",
+	"transferFrom(address,address,uint256)",
+	"approve(address,uint256)",
+	"increaseAllowance(address,uint256)",
+	"decreaseAllowance(address,uint256)",
+	"permit(address,address,uint256,uint256,uint8,bytes32,bytes32)",
+	"mint(address,uint256)",
+	"burn(uint256)",
+	// ERC-721 and ERC-1155
+	"safeTransferFrom(address,address,uint256)",
+	"safeTransferFrom(address,address,uint256,bytes)",
+	"safeTransferFrom(address,address,uint256,uint256,bytes)",
+	"safeBatchTransferFrom(address,address,uint256[],uint256[],bytes)",
+	"setApprovalForAll(address,bool)",
+	// WETH
+	"deposit()",
+	"withdraw(uint256)",
+	// Safe
+	"execTransaction(address,uint256,bytes,uint8,uint256,uint256,uint256,address,address,bytes)",
+	// Uniswap V2 router
+	"swapExactTokensForTokens(uint256,uint256,address[],address,uint256)",
+	"swapTokensForExactTokens(uint256,uint256,address[],address,uint256)",
+	"swapExactETHForTokens(uint256,address[],address,uint256)",
+	"swapTokensForExactETH(uint256,uint256,address[],address,uint256)",
+	"swapExactTokensForETH(uint256,uint256,address[],address,uint256)",
+	"swapETHForExactTokens(uint256,address[],address,uint256)",
+	"addLiquidity(address,address,uint256,uint256,uint256,uint256,address,uint256)",
+	"addLiquidityETH(address,uint256,uint256,uint256,address,uint256)",
+	"removeLiquidity(address,address,uint256,uint256,uint256,address,uint256)",
+	"removeLiquidityETH(address,uint256,uint256,uint256,address,uint256)",
+	// Uniswap V3 router
+	"exactInputSingle((address,address,uint24,address,uint256,uint256,uint256,uint160))",
+	"exactInput((bytes,address,uint256,uint256,uint256))",
+	"exactOutputSingle((address,address,uint24,address,uint256,uint256,uint256,uint160))",
+	"exactOutput((bytes,address,uint256,uint256,uint256))",
+	"multicall(bytes[])",
+	"multicall(uint256,bytes[])",
+	// Uniswap universal router
+	"execute(bytes,bytes[])",
+	"execute(bytes,bytes[],uint256)",
+}
+
+var builtin = func() *ABI {
+	abi := &ABI{methods: make(map[[4]byte]Method, len(builtinSignatures))}
+	for _, signature := range builtinSignatures {
+		method, err := ParseSignature(signature)
+		if err != nil {
+			panic(fmt.Sprintf("abi: invalid built-in signature: %v", err))
+		}
+		abi.methods[method.Selector] = method
+	}
+	return abi
+}()
+
+// LookupSelector returns the built-in method called by input, which starts
+// with its selector. Built-in methods have no argument names.
+func LookupSelector(input []byte) (Method, bool) {
+	return builtin.MethodBySelector(input)
+}
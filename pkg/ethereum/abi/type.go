@@ -0,0 +1,194 @@
+package abi
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Kind is the family of an ABI type.
+type Kind int
+
+const (
+	UintKind Kind = iota
+	IntKind
+	AddressKind
+	BoolKind
+	// FixedBytesKind is bytes1 to bytes32.
+	FixedBytesKind
+	BytesKind
+	StringKind
+	// SliceKind is a dynamic-length array such as uint256[].
+	SliceKind
+	// ArrayKind is a fixed-length array such as address[3].
+	ArrayKind
+	TupleKind
+)
+
+// wordSize is the size of one ABI-encoded slot.
+const wordSize = 32
+
+// maxArrayLength bounds fixed array lengths. ABIs are posted by clients, and
+// no call data fits an array anywhere near this long.
+const maxArrayLength = 1 << 16
+
+// Type is a parsed Solidity ABI type. Size is the bit width of integers, the
+// byte length of fixed bytes and the length of fixed arrays; Elem is the
+// element type of arrays and Components the fields of tuples.
+type Type struct {
+	Kind       Kind
+	Size       int
+	Elem       *Type
+	Components []Argument
+}
+
+// Argument is a named method input or tuple field. Built-in selectors have
+// no argument names.
+type Argument struct {
+	Name string
+	Type Type
+}
+
+// ParseType parses a type such as "uint256", "bytes32[]" or "tuple[2]".
+// components describes the fields when the base type is "tuple".
+func ParseType(s string, components []Argument) (Type, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "]") {
+		open := strings.LastIndex(s, "[")
+		if open < 0 {
+			return Type{}, fmt.Errorf("invalid type %q", s)
+		}
+		elem, err := ParseType(s[:open], components)
+		if err != nil {
+			return Type{}, err
+		}
+		length := s[open+1 : len(s)-1]
+		if length == "" {
+			return Type{Kind: SliceKind, Elem: &elem}, nil
+		}
+		size, err := strconv.Atoi(length)
+		if err != nil || size <= 0 || size > maxArrayLength {
+			return Type{}, fmt.Errorf("invalid array length in %q", s)
+		}
+		return Type{Kind: ArrayKind, Size: size, Elem: &elem}, nil
+	}
+
+	switch {
+	case s == "tuple":
+		return Type{Kind: TupleKind, Components: components}, nil
+	case s == "address":
+		return Type{Kind: AddressKind}, nil
+	case s == "bool":
+		return Type{Kind: BoolKind}, nil
+	case s == "string":
+		return Type{Kind: StringKind}, nil
+	case s == "bytes":
+		return Type{Kind: BytesKind}, nil
+	case s == "function":
+		// An address followed by a selector
+		return Type{Kind: FixedBytesKind, Size: 24}, nil
+	case strings.HasPrefix(s, "bytes"):
+		size, err := strconv.Atoi(strings.TrimPrefix(s, "bytes"))
+		if err != nil || size < 1 || size > wordSize {
+			return Type{}, fmt.Errorf("invalid type %q", s)
+		}
+		return Type{Kind: FixedBytesKind, Size: size}, nil
+	case strings.HasPrefix(s, "uint"), strings.HasPrefix(s, "int"):
+		kind, bits := UintKind, strings.TrimPrefix(s, "uint")
+		if !strings.HasPrefix(s, "uint") {
+			kind, bits = IntKind, strings.TrimPrefix(s, "int")
+		}
+		if bits == "" {
+			return Type{Kind: kind, Size: 256}, nil
+		}
+		size, err := strconv.Atoi(bits)
+		if err != nil || size < 8 || size > 256 || size%8 != 0 {
+			return Type{}, fmt.Errorf("invalid type %q", s)
+		}
+		return Type{Kind: kind, Size: size}, nil
+	}
+	return Type{}, fmt.Errorf("unsupported type %q", s)
+}
+
+// String returns the canonical type name used in method signatures, with
+// tuples spelled out as their component types.
+func (t Type) String() string {
+	switch t.Kind {
+	case UintKind:
+		return fmt.Sprintf("uint%d", t.Size)
+	case IntKind:
+		return fmt.Sprintf("int%d", t.Size)
+	case AddressKind:
+		return "address"
+	case BoolKind:
+		return "bool"
+	case FixedBytesKind:
+		return fmt.Sprintf("bytes%d", t.Size)
+	case BytesKind:
+		return "bytes"
+	case StringKind:
+		return "string"
+	case SliceKind:
+		return t.Elem.String() + "[]"
+	case ArrayKind:
+		return fmt.Sprintf("%s[%d]", t.Elem.String(), t.Size)
+	case TupleKind:
+		return "(" + typeList(t.Components) + ")"
+	}
+	return "unknown"
+}
+
+func typeList(args []Argument) string {
+	names := make([]string, len(args))
+	for i, arg := range args {
+		names[i] = arg.Type.String()
+	}
+	return strings.Join(names, ",")
+}
+
+// dynamic reports whether values of the type are encoded out of line, behind
+// an offset.
+func (t Type) dynamic() bool {
+	switch t.Kind {
+	case BytesKind, StringKind, SliceKind:
+		return true
+	case ArrayKind:
+		return t.Elem.dynamic()
+	case TupleKind:
+		for _, component := range t.Components {
+			if component.Type.dynamic() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headSize is how many bytes the type takes in its enclosing tuple's head.
+// Nested arrays can multiply past what an int holds, so the size saturates
+// at math.MaxInt, which no data is long enough for.
+func (t Type) headSize() int {
+	if t.dynamic() {
+		return wordSize
+	}
+	switch t.Kind {
+	case ArrayKind:
+		elem := t.Elem.headSize()
+		if elem != 0 && t.Size > math.MaxInt/elem {
+			return math.MaxInt
+		}
+		return t.Size * elem
+	case TupleKind:
+		size := 0
+		for _, component := range t.Components {
+			component := component.Type.headSize()
+			if size > math.MaxInt-component {
+				return math.MaxInt
+			}
+			size += component
+		}
+		return size
+	}
+	return wordSize
+}
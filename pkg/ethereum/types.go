@@ -1,5 +1,16 @@
 package ethereum
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrSubscriptionsUnsupported is returned when a node does not offer
+// eth_subscribe, so callers can fall back to polling.
+var ErrSubscriptionsUnsupported = errors.New("node does not support subscriptions")
+
 type JSONRPCRequest struct {
 	JsonRPC string        `json:"jsonrpc"`
 	Method  string        `json:"method"`
@@ -8,8 +19,60 @@ type JSONRPCRequest struct {
 }
 
 type JSONRPCResponse struct {
-	JsonRPC string      `json:"jsonrpc"`
-	Result  interface{} `json:"result"`
-	ID      int         `json:"id"`
-	Error   interface{} `json:"error,omitempty"`
+	JsonRPC string        `json:"jsonrpc"`
+	Result  interface{}   `json:"result"`
+	ID      int           `json:"id"`
+	Error   *JSONRPCError `json:"error,omitempty"`
+}
+
+// ErrCodeMissingResponse marks batch entries the node did not answer.
+const ErrCodeMissingResponse = -39001
+
+// ErrCodeMethodNotFound is the JSON-RPC code for an unknown method.
+const ErrCodeMethodNotFound = -32601
+
+// JSONRPCError is the error object a node returns in place of a result.
+type JSONRPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+// IsMethodUnsupported reports whether err is a node saying it does not offer
+// method. Callers switch features off for good on it, so only the
+// method-not-found code and messages naming the method count: nodes also say
+// "not available" or "does not exist" of pruned state and missing blocks,
+// which are no reason to give up on the method.
+func IsMethodUnsupported(err error, method string) bool {
+	var rpcErr *JSONRPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	if rpcErr.Code == ErrCodeMethodNotFound {
+		return true
+	}
+	message := strings.ToLower(rpcErr.Message)
+	method = strings.ToLower(method)
+	return strings.Contains(message, "method not found") ||
+		strings.Contains(message, "the method "+method+" does not exist") ||
+		strings.Contains(message, "the method "+method+" is not available")
+}
+
+// EndpointStatus reports the observed health of one RPC endpoint in a pool.
+type EndpointStatus struct {
+	URL         string    `json:"url"`
+	Weight      int       `json:"weight"`
+	Healthy     bool      `json:"healthy"`
+	Head        int       `json:"head"`
+	Lag         int       `json:"lag"`
+	LatencyMs   float64   `json:"latency_ms"`
+	ErrorRate   float64   `json:"error_rate"`
+	Requests    int64     `json:"requests"`
+	Failures    int64     `json:"failures"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastChecked time.Time `json:"last_checked"`
 }
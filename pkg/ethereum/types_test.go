@@ -0,0 +1,62 @@
+package ethereum
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestIsMethodUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "method not found code",
+			err:  &JSONRPCError{Code: ErrCodeMethodNotFound, Message: "notifications not supported"},
+			want: true,
+		},
+		{
+			name: "geth message naming the method",
+			err:  &JSONRPCError{Code: -32000, Message: "the method eth_getBlockReceipts does not exist/is not available"},
+			want: true,
+		},
+		{
+			name: "method not found message",
+			err:  fmt.Errorf("wrapped: %w", &JSONRPCError{Code: -32000, Message: "Method not found"}),
+			want: true,
+		},
+		{
+			name: "another method",
+			err:  &JSONRPCError{Code: -32000, Message: "the method trace_block does not exist/is not available"},
+		},
+		{
+			name: "pruned state",
+			err:  &JSONRPCError{Code: -32000, Message: "historical state not available in path scheme yet"},
+		},
+		{
+			name: "missing trie node",
+			err:  &JSONRPCError{Code: -32000, Message: "missing trie node 0x1f8a (path ) state 0x1f8a is not available"},
+		},
+		{
+			name: "required historical state",
+			err:  &JSONRPCError{Code: -32000, Message: "required historical state unavailable (reexec=128)"},
+		},
+		{
+			name: "missing block",
+			err:  &JSONRPCError{Code: -32000, Message: "block #18934566 does not exist"},
+		},
+		{
+			name: "not a json-rpc error",
+			err:  fmt.Errorf("the method eth_getBlockReceipts does not exist/is not available"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsMethodUnsupported(tt.err, "eth_getBlockReceipts"); got != tt.want {
+				t.Errorf("IsMethodUnsupported() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
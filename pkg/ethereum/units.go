@@ -0,0 +1,92 @@
+package ethereum
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Decimals of the common ether denominations, relative to wei.
+const (
+	GweiDecimals  = 9
+	EtherDecimals = 18
+)
+
+// ParseQuantity decodes a hex quantity such as "0x2386f26fc10000" exactly.
+// An empty string is zero.
+func ParseQuantity(s string) (*big.Int, error) {
+	if s == "" {
+		return new(big.Int), nil
+	}
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(digits) == len(s) || digits == "" {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	value, ok := new(big.Int).SetString(digits, 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	return value, nil
+}
+
+// FormatUnits renders value, an integer amount of the smallest unit, as a
+// decimal number of units with the given decimals, without rounding:
+// FormatUnits(10000000000000000, 18) is "0.01". Trailing zeros are dropped.
+func FormatUnits(value *big.Int, decimals int) string {
+	if value == nil {
+		return "0"
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	whole, fraction := new(big.Int).QuoRem(new(big.Int).Abs(value), scale, new(big.Int))
+
+	result := whole.String()
+	if fraction.Sign() != 0 {
+		digits := fraction.String()
+		digits = strings.Repeat("0", decimals-len(digits)) + digits
+		result += "." + strings.TrimRight(digits, "0")
+	}
+	if value.Sign() < 0 {
+		result = "-" + result
+	}
+	return result
+}
+
+// ParseUnits parses a non-negative decimal number of units, such as "1.5",
+// into an integer amount of the smallest unit. More fractional digits than
+// decimals is an error rather than a rounding.
+func ParseUnits(s string, decimals int) (*big.Int, error) {
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(fraction) > decimals {
+		return nil, fmt.Errorf("amount %q has more than %d decimals", s, decimals)
+	}
+	for _, digits := range []string{whole, fraction} {
+		if strings.Trim(digits, "0123456789") != "" {
+			return nil, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+
+	value, _ := new(big.Int).SetString(whole+fraction+strings.Repeat("0", decimals-len(fraction)), 10)
+	return value, nil
+}
+
+// ParseAmount parses an amount of ether into wei. A bare integer is wei;
+// a decimal number may carry a "wei", "gwei" or "ether" suffix, as in
+// "1.5ether" or "20 gwei".
+func ParseAmount(s string) (*big.Int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	decimals := 0
+	for _, unit := range []struct {
+		suffix   string
+		decimals int
+	}{{"gwei", GweiDecimals}, {"ether", EtherDecimals}, {"wei", 0}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			decimals = unit.decimals
+			break
+		}
+	}
+	return ParseUnits(s, decimals)
+}
@@ -0,0 +1,89 @@
+package ethereum
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: "0"},
+		{value: "0x0", want: "0"},
+		{value: "0x2386f26fc10000", want: "10000000000000000"},
+		{value: "0x18ee90ff6c373e0ee4e3f0ad2", want: "123456789012345678901234567890"},
+		{value: "2386f26fc10000", wantErr: true},
+		{value: "0x", wantErr: true},
+		{value: "0xzz", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseQuantity(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQuantity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("ParseQuantity() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatUnits(t *testing.T) {
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	tests := []struct {
+		value    *big.Int
+		decimals int
+		want     string
+	}{
+		{value: big.NewInt(10000000000000000), decimals: EtherDecimals, want: "0.01"},
+		{value: big.NewInt(1), decimals: EtherDecimals, want: "0.000000000000000001"},
+		{value: big.NewInt(1500000000), decimals: GweiDecimals, want: "1.5"},
+		{value: big.NewInt(-2000000000), decimals: GweiDecimals, want: "-2"},
+		{value: huge, decimals: EtherDecimals, want: "123456789012.34567890123456789"},
+		{value: new(big.Int), decimals: EtherDecimals, want: "0"},
+		{value: nil, decimals: EtherDecimals, want: "0"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatUnits(tt.value, tt.decimals); got != tt.want {
+			t.Errorf("FormatUnits(%v, %d) = %s, want %s", tt.value, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "1000", want: "1000"},
+		{value: "1000wei", want: "1000"},
+		{value: "1.5ether", want: "1500000000000000000"},
+		{value: "20 gwei", want: "20000000000"},
+		{value: ".5 Ether", want: "500000000000000000"},
+		{value: "123456789012.34567890123456789ether", want: "123456789012345678901234567890"},
+		{value: "0.0000000000000000001ether", wantErr: true},
+		{value: "1.5", wantErr: true},
+		{value: "-1ether", wantErr: true},
+		{value: "1e18", wantErr: true},
+		{value: "ether", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseAmount(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAmount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("ParseAmount() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"github.com/grokkos/ether-tx-parser/internal/domain/entity"
+	"github.com/grokkos/ether-tx-parser/internal/api/http/handler"
 	"io"
 	"net/http"
 	"os"
@@ -156,7 +156,7 @@ func testSuccessScenarios(t *testing.T) {
 			t.Errorf("expected status OK, got %v", resp.statusCode)
 		}
 
-		var transactions []entity.Transaction
+		var transactions []handler.TransactionResponse
 		if err := json.Unmarshal(resp.body, &transactions); err != nil {
 			t.Fatalf("Failed to unmarshal response: %v", err)
 		}